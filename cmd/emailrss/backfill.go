@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"emailrss/internal/config"
+	"emailrss/internal/db"
+	"emailrss/internal/processor"
+)
+
+const backfillDateLayout = "2006-01-02"
+
+type BackfillCmd struct {
+	Folder    string `long:"folder" required:"" help:"Folder to backfill"`
+	Since     string `long:"since" placeholder:"YYYY-MM-DD" help:"Only messages dated on or after this day"`
+	Until     string `long:"until" placeholder:"YYYY-MM-DD" help:"Only messages dated before this day"`
+	Limit     int    `long:"limit" help:"Process at most this many messages, newest first"`
+	ChunkSize int    `long:"chunk-size" default:"100" help:"Messages published and recorded together"`
+}
+
+func (c *BackfillCmd) Validate() error {
+	options, err := c.options()
+	if err != nil {
+		return err
+	}
+	if !options.Since.IsZero() && !options.Until.IsZero() && !options.Since.Before(options.Until) {
+		return fmt.Errorf("--since must be before --until")
+	}
+	if c.Limit < 0 || c.ChunkSize <= 0 {
+		return fmt.Errorf("--limit cannot be negative and --chunk-size must be positive")
+	}
+	return nil
+}
+
+// options converts the flags into backfill options, with dates in local time
+func (c *BackfillCmd) options() (processor.BackfillOptions, error) {
+	options := processor.BackfillOptions{Limit: c.Limit, ChunkSize: c.ChunkSize}
+	var err error
+	if c.Since != "" {
+		if options.Since, err = time.ParseInLocation(backfillDateLayout, c.Since, time.Local); err != nil {
+			return options, fmt.Errorf("invalid --since date: %v", err)
+		}
+	}
+	if c.Until != "" {
+		if options.Until, err = time.ParseInLocation(backfillDateLayout, c.Until, time.Local); err != nil {
+			return options, fmt.Errorf("invalid --until date: %v", err)
+		}
+	}
+	return options, nil
+}
+
+func runBackfill(cfg *config.Config, database db.Store, cmd BackfillCmd) error {
+	options, err := cmd.options()
+	if err != nil {
+		return err
+	}
+	options.Progress = func(progress processor.BackfillProgress) {
+		fmt.Printf("%s: %d/%d messages (%d%%), %d added, %s elapsed, ETA %s\n",
+			progress.Folder, progress.Done, progress.Total, progress.Done*100/progress.Total, progress.Added,
+			progress.Elapsed.Round(time.Second), progress.ETA.Round(time.Second))
+	}
+
+	proc, folders, closeClient, err := newProcessor(cfg, database)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	// Interrupting stops once the messages being fetched are recorded; everything before is kept
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	defer proc.WaitNotifications()
+
+	progress, err := proc.Backfill(ctx, folders, cmd.Folder, options)
+	if ctx.Err() != nil {
+		fmt.Printf("Interrupted after %d of %d messages; run the same command again to resume\n", progress.Done, progress.Total)
+	}
+	if err != nil {
+		return err
+	}
+
+	if progress.Total == 0 {
+		fmt.Printf("%s: nothing to backfill\n", cmd.Folder)
+	} else {
+		fmt.Printf("%s: backfilled %d messages into feed %s in %s\n", cmd.Folder, progress.Added, progress.Feed, progress.Elapsed.Round(time.Second))
+	}
+	return nil
+}
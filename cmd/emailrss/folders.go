@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"emailrss/internal/config"
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+)
+
+type FoldersCmd struct {
+	JSON bool `long:"json" help:"Print JSON instead of a table"`
+}
+
+// folderInfo describes a server mailbox and how it is published
+type folderInfo struct {
+	Name       string     `json:"name"`
+	Messages   uint32     `json:"messages"`
+	Unseen     uint32     `json:"unseen"`
+	SpecialUse []string   `json:"special_use,omitempty"`
+	Configured bool       `json:"configured"`
+	Discovered bool       `json:"discovered,omitempty"`
+	Feed       string     `json:"feed,omitempty"`
+	LastSync   *time.Time `json:"last_sync,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+func runFolders(cfg *config.Config, database db.Store, jsonOutput bool) error {
+	imapClient, err := newIMAPClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer imapClient.Close()
+
+	ctx := context.Background()
+	mailboxes, err := imapClient.ListMailboxes(ctx)
+	if err != nil {
+		return err
+	}
+
+	states, err := database.GetFolderStates(ctx)
+	if err != nil {
+		return err
+	}
+
+	folders := describeFolders(ctx, cfg, mailboxes, states)
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(folders)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAILBOX\tMESSAGES\tUNSEEN\tSPECIAL-USE\tCONFIGURED\tFEED\tLAST SYNC")
+	for _, folder := range folders {
+		configured := "no"
+		if folder.Discovered {
+			configured = "discovered"
+		} else if folder.Configured {
+			configured = "yes"
+		}
+		lastSync := "never"
+		if folder.LastSync != nil {
+			lastSync = folder.LastSync.Format(time.RFC3339)
+			if folder.LastError != "" {
+				lastSync += " (failed)"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			folder.Name, folder.Messages, folder.Unseen, orDash(strings.Join(folder.SpecialUse, " ")),
+			configured, orDash(folder.Feed), lastSync)
+	}
+	return w.Flush()
+}
+
+// describeFolders joins the server's mailboxes with the configured and discovered feeds
+// and the sync state recorded in the database
+func describeFolders(ctx context.Context, cfg *config.Config, mailboxes []imap.Mailbox, states []db.FolderState) []folderInfo {
+	static, discovery := folderDiscovery(cfg.IMAP)
+
+	names := make([]string, 0, len(mailboxes))
+	for _, mbox := range mailboxes {
+		names = append(names, mbox.Name)
+	}
+	reserved := make([]string, 0, len(cfg.Searches))
+	for name := range cfg.Searches {
+		reserved = append(reserved, name)
+	}
+	feeds := discovery.Expand(ctx, names, static, reserved)
+
+	stateByFolder := make(map[string]db.FolderState, len(states))
+	for _, state := range states {
+		stateByFolder[state.Folder] = state
+	}
+
+	folders := make([]folderInfo, 0, len(mailboxes))
+	for _, mbox := range mailboxes {
+		feed, configured := feeds[mbox.Name]
+		_, named := static[mbox.Name]
+		folder := folderInfo{
+			Name:       mbox.Name,
+			Messages:   mbox.Messages,
+			Unseen:     mbox.Unseen,
+			SpecialUse: mbox.SpecialUse,
+			Configured: configured,
+			Discovered: configured && !named,
+			Feed:       feed,
+		}
+		if state, ok := stateByFolder[mbox.Name]; ok && !state.LastSyncAt.IsZero() {
+			lastSync := state.LastSyncAt
+			folder.LastSync = &lastSync
+			folder.LastError = state.LastError
+		}
+		folders = append(folders, folder)
+	}
+
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Name < folders[j].Name })
+	return folders
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"emailrss/internal/config"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+type InspectCmd struct {
+	Folder string `long:"folder" help:"Folder containing the message"`
+	UID    uint32 `long:"uid" help:"UID of the message in the folder"`
+	File   string `long:"file" type:"existingfile" help:"Read the message from an .eml file instead of the server"`
+}
+
+func (c *InspectCmd) Validate() error {
+	if c.File == "" && (c.Folder == "" || c.UID == 0) {
+		return fmt.Errorf("either --file or both --folder and --uid are required")
+	}
+	if c.File != "" && c.UID != 0 {
+		return fmt.Errorf("--file and --uid cannot be combined")
+	}
+	return nil
+}
+
+// runInspect runs one message through content extraction and feed item generation and
+// prints every stage. Nothing is written to the database, the feeds or the server.
+func runInspect(cfg *config.Config, cmd InspectCmd) error {
+	ctx := context.Background()
+
+	var inspection *imap.Inspection
+	folder := cmd.Folder
+	if cmd.File != "" {
+		raw, err := os.ReadFile(cmd.File)
+		if err != nil {
+			return fmt.Errorf("failed to read message file: %v", err)
+		}
+		if inspection, err = imap.InspectRaw(ctx, raw); err != nil {
+			return err
+		}
+		if folder == "" {
+			folder = strings.TrimSuffix(filepath.Base(cmd.File), filepath.Ext(cmd.File))
+		}
+	} else {
+		imapClient, err := newIMAPClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer imapClient.Close()
+
+		if inspection, err = imapClient.InspectMessage(ctx, cmd.Folder, cmd.UID); err != nil {
+			return err
+		}
+	}
+
+	msg := rss.EmailMessage{
+		UID:      inspection.Message.UID,
+		Subject:  inspection.Message.Subject,
+		From:     inspection.Message.From,
+		Date:     inspection.Message.Date,
+		TextBody: inspection.Content.TextBody,
+		HTMLBody: inspection.Content.HTMLBody,
+	}
+	preview, err := newRSSGenerator(cfg).PreviewItem(folder, msg, nil)
+	if err != nil {
+		return err
+	}
+
+	printInspection(os.Stdout, inspection, preview)
+	return nil
+}
+
+func printInspection(w io.Writer, inspection *imap.Inspection, preview *rss.ItemPreview) {
+	fmt.Fprintln(w, "== Message ==")
+	fmt.Fprintf(w, "Subject: %s\nFrom:    %s\nDate:    %s\n", inspection.Message.Subject, inspection.Message.From,
+		inspection.Message.Date.Format(time.RFC1123Z))
+
+	fmt.Fprintln(w, "\n== MIME tree ==")
+	for _, part := range inspection.Parts {
+		path := part.Path
+		if path == "" {
+			path = "(root)"
+		}
+		fmt.Fprintf(w, "%s%s %s%s", strings.Repeat("  ", part.Depth), path, part.MediaType, formatParams(part.Params))
+		if !strings.HasPrefix(part.MediaType, "multipart/") {
+			fmt.Fprintf(w, " encoding=%s size=%d", part.Encoding, part.Size)
+		}
+		fmt.Fprintln(w)
+	}
+
+	for _, part := range inspection.Parts {
+		if part.Decoded == "" && part.DecodeErr == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\n== Decoded part %s (%s) ==\n", part.Path, part.MediaType)
+		if part.DecodeErr != "" {
+			fmt.Fprintf(w, "(decode error: %s)\n", part.DecodeErr)
+		}
+		fmt.Fprintln(w, part.Decoded)
+	}
+
+	fmt.Fprintln(w, "\n== Extracted text body ==")
+	fmt.Fprintln(w, inspection.Content.TextBody)
+	fmt.Fprintln(w, "\n== Extracted HTML body ==")
+	fmt.Fprintln(w, inspection.Content.HTMLBody)
+
+	fmt.Fprintln(w, "\n== Sanitized HTML ==")
+	fmt.Fprintln(w, preview.JSONItem.ContentHTML)
+	fmt.Fprintln(w, "\n== Sanitized text ==")
+	fmt.Fprintln(w, preview.JSONItem.ContentText)
+	fmt.Fprintln(w, "\n== Summary ==")
+	fmt.Fprintln(w, preview.JSONItem.Summary)
+
+	fmt.Fprintln(w, "\n== RSS item ==")
+	fmt.Fprintln(w, preview.RSSItem)
+	fmt.Fprintln(w, "\n== JSON Feed item ==")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(preview.JSONItem)
+}
+
+func formatParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "; %s=%s", key, params[key])
+	}
+	return b.String()
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -13,78 +19,247 @@ import (
 	"emailrss/internal/config"
 	"emailrss/internal/db"
 	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+	"emailrss/internal/notify"
 	"emailrss/internal/processor"
 	"emailrss/internal/rss"
 	"emailrss/internal/server"
+	"emailrss/internal/source"
 )
 
+var logger = logging.For("main")
+
 type CLI struct {
 	Config string `short:"c" long:"config" default:"config.yaml" help:"Configuration file path"`
 
-	Serve   ServeCmd   `cmd:"" help:"Start the RSS server"`
-	Process ProcessCmd `cmd:"" help:"Process emails and generate RSS feeds"`
-	Reset   ResetCmd   `cmd:"" help:"Reset folder history"`
+	Serve    ServeCmd    `cmd:"" help:"Start the RSS server"`
+	Process  ProcessCmd  `cmd:"" help:"Process emails and generate RSS feeds"`
+	Reset    ResetCmd    `cmd:"" help:"Reset folder history"`
+	Token    TokenCmd    `cmd:"" help:"Manage per-feed access tokens"`
+	Migrate  MigrateCmd  `cmd:"" help:"Manage database schema migrations"`
+	Folders  FoldersCmd  `cmd:"" help:"List server mailboxes with their feed and sync status"`
+	Inspect  InspectCmd  `cmd:"" help:"Dry-run one message through the pipeline and print each stage"`
+	Backfill BackfillCmd `cmd:"" help:"Publish a folder's older messages in resumable chunks"`
 }
 
-type ServeCmd struct{}
+type ServeCmd struct {
+	Process bool `long:"process" help:"Also process emails in this process, enabling live streams at /stream/{feed}"`
+}
 
 type ProcessCmd struct {
-	Once bool `short:"o" long:"once" help:"Process once and exit"`
+	Once   bool   `short:"o" long:"once" help:"Process once and exit"`
+	Report string `long:"report" placeholder:"FILE" help:"Write a JSON report of each run to this file"`
 }
 
 type ResetCmd struct {
 	Folder string `arg:"" required:"" help:"Folder path to reset"`
 }
 
+type TokenCmd struct {
+	Create TokenCreateCmd `cmd:"" help:"Mint a new access token for a feed"`
+	Revoke TokenRevokeCmd `cmd:"" help:"Revoke an access token"`
+	List   TokenListCmd   `cmd:"" help:"List access tokens"`
+}
+
+type TokenCreateCmd struct {
+	Feed        string `arg:"" required:"" help:"Feed name the token grants access to"`
+	Description string `short:"d" long:"description" help:"Note to help identify the token later"`
+}
+
+type TokenRevokeCmd struct {
+	ID int64 `arg:"" required:"" help:"ID of the token to revoke"`
+}
+
+type TokenListCmd struct {
+	Feed string `short:"f" long:"feed" help:"Only list tokens for this feed"`
+}
+
+type MigrateCmd struct {
+	Status struct{} `cmd:"" help:"Show applied and pending migrations"`
+	Up     struct{} `cmd:"" help:"Apply pending migrations"`
+}
+
 func main() {
 	var cli CLI
 	ctx := kong.Parse(&cli)
 
 	cfg, err := config.Load(cli.Config)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("Failed to load config", err)
+	}
+
+	loggingConfig := logging.Config{
+		Format: cfg.Logging.Format,
+		Level:  cfg.Logging.Level,
+		Levels: cfg.Logging.Levels,
+	}
+	if err := logging.Setup(loggingConfig, os.Stderr); err != nil {
+		fatal("Failed to configure logging", err)
+	}
+
+	// inspect is a dry run and never opens the database
+	if ctx.Command() == "inspect" {
+		if err := runInspect(cfg, cli.Inspect); err != nil {
+			fatal("Command failed", err)
+		}
+		return
 	}
 
-	database, err := db.New(cfg.Database.Path)
+	// Migration commands manage the schema themselves; everything else migrates on open
+	openDB := db.NewStore
+	if strings.HasPrefix(ctx.Command(), "migrate ") {
+		openDB = db.OpenStore
+	}
+
+	database, err := openDB(cfg.Database.Driver, cfg.Database.DSN())
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to initialize database", err)
 	}
 	defer database.Close()
 
 	switch ctx.Command() {
 	case "serve":
-		err = runServe(cfg)
+		err = runServe(cfg, database, cli.Serve)
 	case "process":
-		err = runProcess(cfg, database, cli.Process.Once)
+		err = runProcess(cfg, database, cli.Process)
 	case "reset <folder>":
 		err = runReset(cfg, database, cli.Reset.Folder)
+	case "token create <feed>":
+		err = runTokenCreate(cfg, database, cli.Token.Create.Feed, cli.Token.Create.Description)
+	case "token revoke <id>":
+		err = runTokenRevoke(database, cli.Token.Revoke.ID)
+	case "token list":
+		err = runTokenList(database, cli.Token.List.Feed)
+	case "migrate status":
+		err = runMigrateStatus(database)
+	case "migrate up":
+		err = runMigrateUp(database)
+	case "folders":
+		err = runFolders(cfg, database, cli.Folders.JSON)
+	case "backfill":
+		err = runBackfill(cfg, database, cli.Backfill)
 	default:
-		log.Fatalf("Unknown command: %s", ctx.Command())
+		fatal("Unknown command", fmt.Errorf("%s", ctx.Command()))
 	}
 
 	if err != nil {
-		log.Fatalf("Command failed: %v", err)
+		fatal("Command failed", err)
 	}
 }
 
-func runServe(cfg *config.Config) error {
-	srv := server.New(server.ServerConfig{
+// fatal logs err and exits with a non-zero status
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func runServe(cfg *config.Config, database db.Store, cmd ServeCmd) error {
+	staticFolders, _ := folderDiscovery(cfg.IMAP)
+
+	users := make([]server.User, 0, len(cfg.Server.Auth.Users))
+	for _, user := range cfg.Server.Auth.Users {
+		users = append(users, server.User{
+			Username: user.Username,
+			Password: user.Password,
+			Feeds:    user.Feeds,
+		})
+	}
+
+	serverConfig := server.ServerConfig{
 		Host:     cfg.Server.Host,
 		Port:     cfg.Server.Port,
 		FeedsDir: cfg.RSS.OutputDir,
-	})
+		Folders:  staticFolders,
+		Auth: server.AuthConfig{
+			Enabled: cfg.Server.Auth.Enabled,
+			Realm:   cfg.Server.Auth.Realm,
+			Users:   users,
+		},
+		TLS: server.TLSConfig{
+			CertFile:         cfg.Server.TLSCertFile,
+			KeyFile:          cfg.Server.TLSKeyFile,
+			RedirectHTTPPort: cfg.Server.RedirectHTTPPort,
+		},
+		Hub: server.HubConfig{
+			Enabled:               cfg.Server.Hub.Enabled,
+			BaseURL:               cfg.RSS.BaseURL,
+			Lease:                 cfg.Server.Hub.Lease,
+			MaxLease:              cfg.Server.Hub.MaxLease,
+			AllowPrivateCallbacks: cfg.Server.Hub.AllowPrivateCallbacks,
+		},
+	}
+	if cfg.Metrics.Enabled {
+		serverConfig.MetricsPath = cfg.Metrics.Path
+	}
+
+	srv := server.New(serverConfig)
+	srv.SetTokenStore(database)
+	srv.SetStatusStore(database)
+	srv.SetSearchStore(database)
+	srv.SetSubscriptionStore(database)
 
-	return srv.Start()
+	if !cmd.Process {
+		return srv.Start()
+	}
+
+	bus := notify.NewBus()
+	proc, folders, closeClient, err := newProcessor(cfg, database, bus)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+	srv.SetStream(bus, database, newRSSGenerator(cfg))
+
+	// A signal stops processing after the current messages and then the server
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	defer proc.WaitNotifications()
+
+	processed := make(chan struct{})
+	go func() {
+		defer close(processed)
+		processLoop(ctx, processRun(ctx, proc, folders, ""))
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Start()
+	}()
+
+	select {
+	case err := <-serveErr:
+		stop()
+		<-processed
+		return err
+	case <-processed:
+		return nil
+	}
 }
 
-func runProcess(cfg *config.Config, database *db.DB, once bool) error {
+// newIMAPClient connects to the configured IMAP server
+func newIMAPClient(cfg *config.Config) (*imap.Client, error) {
+	if cfg.IMAP.Host == "" {
+		return nil, fmt.Errorf("no IMAP server is configured")
+	}
+
 	imapConfig := imap.IMAPConfig{
-		Host:     cfg.IMAP.Host,
-		Port:     cfg.IMAP.Port,
-		Username: cfg.IMAP.Username,
-		Password: cfg.IMAP.Password,
-		TLS:      cfg.IMAP.TLS,
-		Timeout:  cfg.IMAP.Timeout,
+		Host:           cfg.IMAP.Host,
+		Port:           cfg.IMAP.Port,
+		Username:       cfg.IMAP.Username,
+		Password:       cfg.IMAP.Password,
+		TLS:            cfg.IMAP.TLS,
+		Timeout:        cfg.IMAP.Timeout,
+		DedupKeyword:   cfg.IMAP.DedupKeyword,
+		MaxPartBytes:   cfg.IMAP.MaxPartBytes,
+		CommandTimeout: cfg.IMAP.CommandTimeout,
+		Retry: imap.RetryConfig{
+			MaxAttempts:      cfg.IMAP.Retry.MaxAttempts,
+			InitialBackoff:   cfg.IMAP.Retry.InitialBackoff,
+			MaxBackoff:       cfg.IMAP.Retry.MaxBackoff,
+			BreakerThreshold: cfg.IMAP.Retry.BreakerThreshold,
+			BreakerCooldown:  cfg.IMAP.Retry.BreakerCooldown,
+		},
 	}
 
 	debugConfig := imap.DebugConfig{
@@ -94,13 +269,12 @@ func runProcess(cfg *config.Config, database *db.DB, once bool) error {
 		MaxRawMessages:  cfg.Debug.MaxRawMessages,
 	}
 
-	imapClient, err := imap.NewClient(imapConfig, debugConfig)
-	if err != nil {
-		return err
-	}
-	defer imapClient.Close()
+	return imap.NewClient(imapConfig, debugConfig)
+}
 
-	rssConfig := rss.RSSConfig{
+// newRSSGenerator creates a feed generator from the rss config
+func newRSSGenerator(cfg *config.Config) *rss.Generator {
+	return rss.NewGenerator(rss.RSSConfig{
 		OutputDir:            cfg.RSS.OutputDir,
 		Title:                cfg.RSS.Title,
 		BaseURL:              cfg.RSS.BaseURL,
@@ -110,82 +284,319 @@ func runProcess(cfg *config.Config, database *db.DB, once bool) error {
 		MaxRSSTextLength:     cfg.RSS.MaxRSSTextLength,
 		MaxSummaryLength:     cfg.RSS.MaxSummaryLength,
 		RemoveCSS:            cfg.RSS.RemoveCSS,
+		Hub:                  cfg.Notify.Hub,
+	})
+}
+
+// newNotifier creates the notifier announcing new items, or returns nil when no hub or
+// webhook is configured
+func newNotifier(cfg *config.Config) *notify.Notifier {
+	if cfg.Notify.Hub == "" && len(cfg.Notify.Webhooks) == 0 {
+		return nil
+	}
+
+	webhooks := make([]notify.Webhook, 0, len(cfg.Notify.Webhooks))
+	for _, webhook := range cfg.Notify.Webhooks {
+		webhooks = append(webhooks, notify.Webhook{
+			URL:    webhook.URL,
+			Secret: webhook.Secret,
+			Feeds:  webhook.Feeds,
+		})
+	}
+	return notify.New(notify.Config{
+		BaseURL:        cfg.RSS.BaseURL,
+		Hub:            cfg.Notify.Hub,
+		Webhooks:       webhooks,
+		Timeout:        cfg.Notify.Timeout,
+		MaxAttempts:    cfg.Notify.MaxAttempts,
+		InitialBackoff: cfg.Notify.InitialBackoff,
+	})
+}
+
+// newProcessor sets up a processor from the config and returns it along with the named
+// folders to process and a function that closes its IMAP connection. notifiers are told
+// about new items before the configured hub and webhooks.
+func newProcessor(cfg *config.Config, database db.Store, notifiers ...processor.Notifier) (*processor.Processor, map[string]string, func(), error) {
+	sources := make(map[string]processor.IMAPClient, len(cfg.Sources))
+	for folder, uri := range cfg.Sources {
+		src, err := source.Open(uri)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		sources[folder] = src
+	}
+
+	// Folders read entirely from local sources need no IMAP connection
+	var client processor.IMAPClient
+	closeClient := func() {}
+	if cfg.NeedsIMAP() {
+		imapClient, err := newIMAPClient(cfg)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		client = imapClient
+		closeClient = func() { imapClient.Close() }
 	}
 
-	rssGenerator := rss.NewGenerator(rssConfig)
-	proc := processor.New(imapClient, database, rssGenerator)
+	rssGenerator := newRSSGenerator(cfg)
+	proc := processor.New(client, database, rssGenerator)
 	proc.SetMaxWorkers(cfg.Processing.MaxWorkers)
+	proc.SetSources(sources)
+	for _, notifier := range notifiers {
+		proc.AddNotifier(notifier)
+	}
+	if notifier := newNotifier(cfg); notifier != nil {
+		proc.AddNotifier(notifier)
+	}
 
-	ctx := context.Background()
+	retention := processor.RetentionConfig{
+		Default:        retentionPolicy(cfg.Retention.RetentionPolicy),
+		Feeds:          make(map[string]db.RetentionPolicy, len(cfg.Retention.Feeds)),
+		VacuumInterval: cfg.Retention.VacuumInterval,
+	}
+	for feed, policy := range cfg.Retention.Feeds {
+		retention.Feeds[feed] = retentionPolicy(policy)
+	}
+	proc.SetRetention(retention)
+
+	searches := make([]processor.SavedSearch, 0, len(cfg.Searches))
+	for name, search := range cfg.Searches {
+		searches = append(searches, processor.SavedSearch{
+			Name:     name,
+			Query:    search.Query,
+			Folders:  search.Folders,
+			MaxItems: max(search.MaxItems, 0),
+		})
+	}
+	proc.SetSavedSearches(searches)
+
+	actions := make(map[string]imap.Actions, len(cfg.IMAP.Actions))
+	for folder, action := range cfg.IMAP.Actions {
+		converted := imap.Actions{
+			MarkSeen:    action.MarkSeen,
+			MoveTo:      action.MoveTo,
+			DeleteAfter: action.DeleteAfter,
+		}
+		if action.Keyword != "" {
+			converted.Keywords = []string{action.Keyword}
+		}
+		actions[folder] = converted
+	}
+	proc.SetActions(actions)
+	proc.SetDedupKeyword(cfg.IMAP.DedupKeyword)
+
+	folders, discovery := folderDiscovery(cfg.IMAP)
+	proc.SetFolderDiscovery(discovery)
+
+	return proc, folders, closeClient, nil
+}
+
+func runProcess(cfg *config.Config, database db.Store, cmd ProcessCmd) error {
+	proc, folders, closeClient, err := newProcessor(cfg, database)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen != "" {
+		go serveMetrics(cfg.Metrics.Listen, cfg.Metrics.Path)
+	}
+
+	// A signal cancels the run in progress, which stops after the current messages, and the
+	// notifications still being sent
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	defer proc.WaitNotifications()
 
-	if once {
-		return proc.ProcessFolders(ctx, cfg.IMAP.Folders)
+	run := processRun(ctx, proc, folders, cmd.Report)
+	if cmd.Once {
+		return run()
 	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	processLoop(ctx, run)
+	return nil
+}
 
+// processRun returns a function that processes folders once and reports the run, writing
+// the report to reportPath if set; its error fails --once
+func processRun(ctx context.Context, proc *processor.Processor, folders map[string]string, reportPath string) func() error {
+	return func() error {
+		report := proc.ProcessFolders(ctx, folders)
+		if reportPath != "" {
+			if err := report.WriteFile(reportPath); err != nil {
+				logger.Error("Failed to write run report", "error", err)
+			}
+		}
+		return report.Err()
+	}
+}
+
+// processLoop calls run at once and then every five minutes until ctx is cancelled
+func processLoop(ctx context.Context, run func() error) {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
-	log.Println("Starting email processing loop...")
+	logger.Info("Starting email processing loop")
 
 	// Process immediately on startup
-	if err := proc.ProcessFolders(ctx, cfg.IMAP.Folders); err != nil {
-		log.Printf("Initial processing failed: %v", err)
+	if err := run(); err != nil {
+		logger.Error("Initial processing failed", "error", err)
 	}
 
 	for {
 		select {
 		case <-ticker.C:
-			if err := proc.ProcessFolders(ctx, cfg.IMAP.Folders); err != nil {
-				log.Printf("Processing failed: %v", err)
+			if err := run(); err != nil {
+				logger.Error("Processing failed", "error", err)
 			}
-		case <-sigChan:
-			log.Println("Shutting down...")
-			return nil
+		case <-ctx.Done():
+			logger.Info("Shutting down")
+			return
 		}
 	}
 }
 
-func runReset(cfg *config.Config, database *db.DB, folderPath string) error {
-	imapConfig := imap.IMAPConfig{
-		Host:     cfg.IMAP.Host,
-		Port:     cfg.IMAP.Port,
-		Username: cfg.IMAP.Username,
-		Password: cfg.IMAP.Password,
-		TLS:      cfg.IMAP.TLS,
-		Timeout:  cfg.IMAP.Timeout,
+// folderDiscovery splits the configured folders into named folders and discovery rules.
+// Glob entries come first, then regular expressions, each in sorted order.
+func folderDiscovery(cfg config.IMAPConfig) (map[string]string, processor.FolderDiscovery) {
+	folders := make(map[string]string, len(cfg.Folders))
+	var discovery processor.FolderDiscovery
+
+	for _, folder := range slices.Sorted(maps.Keys(cfg.Folders)) {
+		if processor.IsFolderGlob(folder) {
+			discovery.Rules = append(discovery.Rules, processor.GlobRule(folder, cfg.Folders[folder]))
+		} else {
+			folders[folder] = cfg.Folders[folder]
+		}
+	}
+	// Patterns were validated when the config was loaded
+	for _, pattern := range slices.Sorted(maps.Keys(cfg.Discovery.Include)) {
+		discovery.Rules = append(discovery.Rules, processor.FolderRule{
+			Pattern: regexp.MustCompile(pattern),
+			Feed:    cfg.Discovery.Include[pattern],
+		})
+	}
+	for _, pattern := range cfg.Discovery.Exclude {
+		discovery.Exclude = append(discovery.Exclude, regexp.MustCompile(pattern))
 	}
 
-	debugConfig := imap.DebugConfig{
-		Enabled:         cfg.Debug.Enabled,
-		RawMessagesDir:  cfg.Debug.RawMessagesDir,
-		SaveRawMessages: cfg.Debug.SaveRawMessages,
-		MaxRawMessages:  cfg.Debug.MaxRawMessages,
+	return folders, discovery
+}
+
+// retentionPolicy translates a configured policy, where negative values disable a limit
+func retentionPolicy(policy config.RetentionPolicy) db.RetentionPolicy {
+	return db.RetentionPolicy{
+		MaxItems: max(policy.MaxItems, 0),
+		MaxAge:   max(policy.MaxAge, 0),
+		MaxBytes: max(policy.MaxBytes, 0),
+	}
+}
+
+// serveMetrics exposes Prometheus metrics for the process command, which has no HTTP server of its own
+func serveMetrics(addr, path string) {
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics.Handler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	imapClient, err := imap.NewClient(imapConfig, debugConfig)
+	logger.Info("Serving metrics", "addr", addr, "path", path)
+	if err := srv.ListenAndServe(); err != nil {
+		logger.Error("Metrics listener failed", "error", err)
+	}
+}
+
+func runReset(cfg *config.Config, database db.Store, folderPath string) error {
+	// Resetting only clears the database, so no IMAP connection is needed
+	rssGenerator := newRSSGenerator(cfg)
+	proc := processor.New(nil, database, rssGenerator)
+	proc.SetMaxWorkers(cfg.Processing.MaxWorkers)
+
+	return proc.ResetFolder(context.Background(), folderPath)
+}
+
+func runTokenCreate(cfg *config.Config, database db.Store, feed, description string) error {
+	token, secret, err := database.CreateFeedToken(context.Background(), feed, description)
 	if err != nil {
 		return err
 	}
-	defer imapClient.Close()
 
-	rssConfig := rss.RSSConfig{
-		OutputDir:            cfg.RSS.OutputDir,
-		Title:                cfg.RSS.Title,
-		BaseURL:              cfg.RSS.BaseURL,
-		MaxHTMLContentLength: cfg.RSS.MaxHTMLContentLength,
-		MaxTextContentLength: cfg.RSS.MaxTextContentLength,
-		MaxRSSHTMLLength:     cfg.RSS.MaxRSSHTMLLength,
-		MaxRSSTextLength:     cfg.RSS.MaxRSSTextLength,
-		MaxSummaryLength:     cfg.RSS.MaxSummaryLength,
-		RemoveCSS:            cfg.RSS.RemoveCSS,
+	fmt.Printf("Created token %d for feed %s\n", token.ID, token.Feed)
+	fmt.Printf("Token: %s\n", secret)
+	fmt.Printf("RSS:   %s/feeds/%s.xml?token=%s\n", cfg.RSS.BaseURL, feed, secret)
+	fmt.Printf("JSON:  %s/feeds/%s.json?token=%s\n", cfg.RSS.BaseURL, feed, secret)
+	fmt.Println("Store the token now; it cannot be shown again.")
+	return nil
+}
+
+func runTokenRevoke(database db.Store, id int64) error {
+	if err := database.RevokeFeedToken(context.Background(), id); err != nil {
+		return err
 	}
 
-	rssGenerator := rss.NewGenerator(rssConfig)
-	proc := processor.New(imapClient, database, rssGenerator)
-	proc.SetMaxWorkers(cfg.Processing.MaxWorkers)
+	fmt.Printf("Revoked token %d\n", id)
+	return nil
+}
+
+func runTokenList(database db.Store, feed string) error {
+	tokens, err := database.ListFeedTokens(context.Background(), feed)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFEED\tCREATED\tSTATUS\tDESCRIPTION")
+	for _, token := range tokens {
+		status := "active"
+		if token.RevokedAt != nil {
+			status = "revoked " + token.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			token.ID, token.Feed, token.CreatedAt.Format(time.RFC3339), status, token.Description)
+	}
+	return w.Flush()
+}
+
+func runMigrateStatus(database db.Store) error {
+	statuses, err := database.MigrationStatus(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Description, applied)
+	}
+	return w.Flush()
+}
+
+func runMigrateUp(database db.Store) error {
+	ctx := context.Background()
+
+	before, err := database.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if err := database.Migrate(ctx); err != nil {
+		return err
+	}
+	after, err := database.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
 
-	return proc.ResetFolder(folderPath)
+	if after == before {
+		fmt.Printf("Database is up to date at version %d\n", after)
+	} else {
+		fmt.Printf("Migrated database from version %d to %d\n", before, after)
+	}
+	return nil
 }
@@ -1,18 +1,46 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 	"time"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"emailrss/internal/logging"
+)
+
+var logger = logging.For("db")
+
+// Upserts shared by the single and batched write paths
+const (
+	sqliteMarkProcessed = `
+	INSERT OR REPLACE INTO processed_messages (folder, uid, subject, from_addr, date)
+	VALUES (?, ?, ?, ?, ?)
+	`
+	sqliteStoreBody = `
+	INSERT OR REPLACE INTO message_bodies (folder, uid, text_body, html_body, size)
+	VALUES (?, ?, ?, ?, ?)
+	`
 )
 
 type DB struct {
 	conn *sql.DB
 }
 
+// NewMessage is a fetched message to record, with its decoded bodies
+type NewMessage struct {
+	UID      uint32
+	Subject  string
+	From     string
+	Date     time.Time
+	TextBody string
+	HTMLBody string
+}
+
 type ProcessedMessage struct {
 	ID          int64
 	Folder      string
@@ -23,8 +51,24 @@ type ProcessedMessage struct {
 	ProcessedAt time.Time
 }
 
+// New opens the database and applies any pending migrations
 func New(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on")
+	db, err := Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	return db, nil
+}
+
+// Open opens the database without touching its schema, e.g. to inspect migration status
+func Open(dbPath string) (*DB, error) {
+	conn, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
@@ -33,14 +77,7 @@ func New(dbPath string) (*DB, error) {
 	conn.SetMaxOpenConns(10)
 	conn.SetMaxIdleConns(5)
 
-	db := &DB{conn: conn}
-
-	if err := db.migrate(); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to migrate database: %v", err)
-	}
-
-	return db, nil
+	return &DB{conn: conn}, nil
 }
 
 func (db *DB) Close() error {
@@ -61,8 +98,7 @@ func (db *DB) retryOnBusy(fn func() error) error {
 			return nil
 		}
 
-		// Check if it's a database busy error
-		if strings.Contains(err.Error(), "database is locked") || strings.Contains(err.Error(), "SQLITE_BUSY") {
+		if isBusy(err) {
 			if i < maxRetries-1 { // Don't sleep on the last attempt
 				time.Sleep(baseDelay * time.Duration(1<<i)) // Exponential backoff
 				continue
@@ -73,33 +109,28 @@ func (db *DB) retryOnBusy(fn func() error) error {
 	return fmt.Errorf("max retries exceeded")
 }
 
-func (db *DB) migrate() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS processed_messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		folder TEXT NOT NULL,
-		uid INTEGER NOT NULL,
-		subject TEXT,
-		from_addr TEXT,
-		date DATETIME,
-		processed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(folder, uid)
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_folder_uid ON processed_messages(folder, uid);
-	CREATE INDEX IF NOT EXISTS idx_folder_date ON processed_messages(folder, date);
-	`
-
-	_, err := db.conn.Exec(query)
-	return err
+// isBusy reports whether err is SQLite's busy or locked error, including extended codes
+// such as SQLITE_BUSY_SNAPSHOT
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
 }
 
-func (db *DB) IsMessageProcessed(folder string, uid uint32) (bool, error) {
-	query := `SELECT COUNT(*) FROM processed_messages WHERE folder = ? AND uid = ?`
+// IsMessageProcessed reports whether uid has been processed in folder, including messages
+// since pruned by retention
+func (db *DB) IsMessageProcessed(ctx context.Context, folder string, uid uint32) (bool, error) {
+	query := `
+	SELECT (SELECT COUNT(*) FROM processed_messages WHERE folder = ? AND uid = ?)
+		+ (SELECT COUNT(*) FROM pruned_messages WHERE folder = ? AND uid = ?)
+	`
 
 	var count int
 	err := db.retryOnBusy(func() error {
-		return db.conn.QueryRow(query, folder, uid).Scan(&count)
+		return db.conn.QueryRowContext(ctx, query, folder, uid, folder, uid).Scan(&count)
 	})
 	if err != nil {
 		return false, fmt.Errorf("failed to check if message is processed: %v", err)
@@ -108,14 +139,9 @@ func (db *DB) IsMessageProcessed(folder string, uid uint32) (bool, error) {
 	return count > 0, nil
 }
 
-func (db *DB) MarkMessageProcessed(folder string, uid uint32, subject, from string, date time.Time) error {
-	query := `
-	INSERT OR REPLACE INTO processed_messages (folder, uid, subject, from_addr, date)
-	VALUES (?, ?, ?, ?, ?)
-	`
-
+func (db *DB) MarkMessageProcessed(ctx context.Context, folder string, uid uint32, subject, from string, date time.Time) error {
 	err := db.retryOnBusy(func() error {
-		_, err := db.conn.Exec(query, folder, uid, subject, from, date)
+		_, err := db.conn.ExecContext(ctx, sqliteMarkProcessed, folder, uid, subject, from, date)
 		return err
 	})
 	if err != nil {
@@ -125,7 +151,95 @@ func (db *DB) MarkMessageProcessed(folder string, uid uint32, subject, from stri
 	return nil
 }
 
-func (db *DB) GetProcessedMessages(folder string, limit int) ([]ProcessedMessage, error) {
+// FilterNewUIDs returns the uids that have not been processed in folder, in their original
+// order. Pruned messages count as processed.
+func (db *DB) FilterNewUIDs(ctx context.Context, folder string, uids []uint32) ([]uint32, error) {
+	params := make([]any, 0, len(uids))
+	for _, uid := range uids {
+		params = append(params, uid)
+	}
+
+	processed := make(map[uint32]bool, len(uids))
+	for _, chunk := range chunkParams(params) {
+		in := placeholders(len(chunk))
+		query := `SELECT uid FROM processed_messages WHERE folder = ? AND uid IN (` + in + `)
+		UNION SELECT uid FROM pruned_messages WHERE folder = ? AND uid IN (` + in + `)`
+		args := append(append([]any{folder}, chunk...), folder)
+		args = append(args, chunk...)
+		err := db.retryOnBusy(func() error {
+			rows, err := db.conn.QueryContext(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var uid uint32
+				if err := rows.Scan(&uid); err != nil {
+					return err
+				}
+				processed[uid] = true
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter processed messages: %v", err)
+		}
+	}
+
+	var fresh []uint32
+	for _, uid := range uids {
+		if !processed[uid] {
+			fresh = append(fresh, uid)
+		}
+	}
+	return fresh, nil
+}
+
+// MarkMessagesProcessed records messages and their bodies in a single transaction
+func (db *DB) MarkMessagesProcessed(ctx context.Context, folder string, messages []NewMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	err := db.retryOnBusy(func() error {
+		tx, err := db.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		markStmt, err := tx.PrepareContext(ctx, sqliteMarkProcessed)
+		if err != nil {
+			return err
+		}
+		defer markStmt.Close()
+
+		bodyStmt, err := tx.PrepareContext(ctx, sqliteStoreBody)
+		if err != nil {
+			return err
+		}
+		defer bodyStmt.Close()
+
+		for _, msg := range messages {
+			if _, err := markStmt.ExecContext(ctx, folder, msg.UID, msg.Subject, msg.From, msg.Date); err != nil {
+				return err
+			}
+			size := len(msg.TextBody) + len(msg.HTMLBody)
+			if _, err := bodyStmt.ExecContext(ctx, folder, msg.UID, msg.TextBody, msg.HTMLBody, size); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark messages as processed: %v", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetProcessedMessages(ctx context.Context, folder string, limit int) ([]ProcessedMessage, error) {
 	query := `
 	SELECT id, folder, uid, subject, from_addr, date, processed_at
 	FROM processed_messages
@@ -134,7 +248,7 @@ func (db *DB) GetProcessedMessages(folder string, limit int) ([]ProcessedMessage
 	LIMIT ?
 	`
 
-	rows, err := db.conn.Query(query, folder, limit)
+	rows, err := db.conn.QueryContext(ctx, query, folder, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get processed messages: %v", err)
 	}
@@ -153,11 +267,30 @@ func (db *DB) GetProcessedMessages(folder string, limit int) ([]ProcessedMessage
 	return messages, nil
 }
 
-func (db *DB) ClearFolderHistory(folder string) error {
-	query := `DELETE FROM processed_messages WHERE folder = ?`
+// CountProcessedMessages returns the number of messages tracked for folder
+func (db *DB) CountProcessedMessages(ctx context.Context, folder string) (int, error) {
+	query := `SELECT COUNT(*) FROM processed_messages WHERE folder = ?`
+
+	var count int
+	err := db.retryOnBusy(func() error {
+		return db.conn.QueryRowContext(ctx, query, folder).Scan(&count)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count processed messages: %v", err)
+	}
 
+	return count, nil
+}
+
+func (db *DB) ClearFolderHistory(ctx context.Context, folder string) error {
 	err := db.retryOnBusy(func() error {
-		_, err := db.conn.Exec(query, folder)
+		if _, err := db.conn.ExecContext(ctx, `DELETE FROM message_bodies WHERE folder = ?`, folder); err != nil {
+			return err
+		}
+		if _, err := db.conn.ExecContext(ctx, `DELETE FROM pruned_messages WHERE folder = ?`, folder); err != nil {
+			return err
+		}
+		_, err := db.conn.ExecContext(ctx, `DELETE FROM processed_messages WHERE folder = ?`, folder)
 		return err
 	})
 	if err != nil {
@@ -167,12 +300,16 @@ func (db *DB) ClearFolderHistory(folder string) error {
 	return nil
 }
 
-func (db *DB) GetLastProcessedDate(folder string) (time.Time, error) {
-	query := `SELECT MAX(date) FROM processed_messages WHERE folder = ?`
+func (db *DB) GetLastProcessedDate(ctx context.Context, folder string) (time.Time, error) {
+	query := `
+	SELECT MAX(date) FROM (
+		SELECT date FROM processed_messages WHERE folder = ?
+		UNION ALL SELECT date FROM pruned_messages WHERE folder = ?
+	)`
 
 	var lastDateStr sql.NullString
 	err := db.retryOnBusy(func() error {
-		return db.conn.QueryRow(query, folder).Scan(&lastDateStr)
+		return db.conn.QueryRowContext(ctx, query, folder, folder).Scan(&lastDateStr)
 	})
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to get last processed date: %v", err)
@@ -1,6 +1,10 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"path/filepath"
 	"testing"
 	"time"
@@ -71,10 +75,10 @@ func TestMarkMessageProcessed(t *testing.T) {
 
 	testTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
 
-	err := db.MarkMessageProcessed("INBOX", 12345, "Test Subject", "test@example.com", testTime)
+	err := db.MarkMessageProcessed(context.Background(), "INBOX", 12345, "Test Subject", "test@example.com", testTime)
 	assert.NoError(t, err)
 
-	err = db.MarkMessageProcessed("INBOX", 12345, "Updated Subject", "updated@example.com", testTime.Add(time.Hour))
+	err = db.MarkMessageProcessed(context.Background(), "INBOX", 12345, "Updated Subject", "updated@example.com", testTime.Add(time.Hour))
 	assert.NoError(t, err)
 
 	var count int
@@ -94,22 +98,22 @@ func TestIsMessageProcessed(t *testing.T) {
 
 	testTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
 
-	processed, err := db.IsMessageProcessed("INBOX", 12345)
+	processed, err := db.IsMessageProcessed(context.Background(), "INBOX", 12345)
 	assert.NoError(t, err)
 	assert.False(t, processed)
 
-	err = db.MarkMessageProcessed("INBOX", 12345, "Test Subject", "test@example.com", testTime)
+	err = db.MarkMessageProcessed(context.Background(), "INBOX", 12345, "Test Subject", "test@example.com", testTime)
 	assert.NoError(t, err)
 
-	processed, err = db.IsMessageProcessed("INBOX", 12345)
+	processed, err = db.IsMessageProcessed(context.Background(), "INBOX", 12345)
 	assert.NoError(t, err)
 	assert.True(t, processed)
 
-	processed, err = db.IsMessageProcessed("INBOX", 54321)
+	processed, err = db.IsMessageProcessed(context.Background(), "INBOX", 54321)
 	assert.NoError(t, err)
 	assert.False(t, processed)
 
-	processed, err = db.IsMessageProcessed("Sent", 12345)
+	processed, err = db.IsMessageProcessed(context.Background(), "Sent", 12345)
 	assert.NoError(t, err)
 	assert.False(t, processed)
 }
@@ -121,7 +125,7 @@ func TestGetProcessedMessages(t *testing.T) {
 	baseTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
 
 	for i := 1; i <= 5; i++ {
-		err := db.MarkMessageProcessed("INBOX", uint32(i),
+		err := db.MarkMessageProcessed(context.Background(), "INBOX", uint32(i),
 			"Subject "+string(rune('0'+i)),
 			"user"+string(rune('0'+i))+"@example.com",
 			baseTime.Add(time.Duration(i)*time.Hour))
@@ -129,14 +133,14 @@ func TestGetProcessedMessages(t *testing.T) {
 	}
 
 	for i := 1; i <= 3; i++ {
-		err := db.MarkMessageProcessed("Sent", uint32(i),
+		err := db.MarkMessageProcessed(context.Background(), "Sent", uint32(i),
 			"Sent Subject "+string(rune('0'+i)),
 			"sender"+string(rune('0'+i))+"@example.com",
 			baseTime.Add(time.Duration(i)*time.Hour))
 		assert.NoError(t, err)
 	}
 
-	messages, err := db.GetProcessedMessages("INBOX", 3)
+	messages, err := db.GetProcessedMessages(context.Background(), "INBOX", 3)
 	assert.NoError(t, err)
 	assert.Len(t, messages, 3)
 
@@ -147,11 +151,11 @@ func TestGetProcessedMessages(t *testing.T) {
 	assert.Equal(t, uint32(4), messages[1].UID)
 	assert.Equal(t, uint32(3), messages[2].UID)
 
-	messages, err = db.GetProcessedMessages("Sent", 10)
+	messages, err = db.GetProcessedMessages(context.Background(), "Sent", 10)
 	assert.NoError(t, err)
 	assert.Len(t, messages, 3)
 
-	messages, err = db.GetProcessedMessages("NonExistent", 10)
+	messages, err = db.GetProcessedMessages(context.Background(), "NonExistent", 10)
 	assert.NoError(t, err)
 	assert.Len(t, messages, 0)
 }
@@ -160,7 +164,7 @@ func TestGetLastProcessedDate(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	lastDate, err := db.GetLastProcessedDate("INBOX")
+	lastDate, err := db.GetLastProcessedDate(context.Background(), "INBOX")
 	assert.NoError(t, err)
 	assert.True(t, lastDate.IsZero())
 
@@ -168,61 +172,82 @@ func TestGetLastProcessedDate(t *testing.T) {
 	testTime2 := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
 	testTime3 := time.Date(2023, 1, 3, 12, 0, 0, 0, time.UTC)
 
-	err = db.MarkMessageProcessed("INBOX", 1, "Subject 1", "user1@example.com", testTime1)
+	err = db.MarkMessageProcessed(context.Background(), "INBOX", 1, "Subject 1", "user1@example.com", testTime1)
 	assert.NoError(t, err)
 
-	err = db.MarkMessageProcessed("INBOX", 2, "Subject 2", "user2@example.com", testTime3)
+	err = db.MarkMessageProcessed(context.Background(), "INBOX", 2, "Subject 2", "user2@example.com", testTime3)
 	assert.NoError(t, err)
 
-	err = db.MarkMessageProcessed("INBOX", 3, "Subject 3", "user3@example.com", testTime2)
+	err = db.MarkMessageProcessed(context.Background(), "INBOX", 3, "Subject 3", "user3@example.com", testTime2)
 	assert.NoError(t, err)
 
-	lastDate, err = db.GetLastProcessedDate("INBOX")
+	lastDate, err = db.GetLastProcessedDate(context.Background(), "INBOX")
 	assert.NoError(t, err)
 	assert.True(t, testTime3.Equal(lastDate))
 
-	lastDate, err = db.GetLastProcessedDate("NonExistent")
+	lastDate, err = db.GetLastProcessedDate(context.Background(), "NonExistent")
 	assert.NoError(t, err)
 	assert.True(t, lastDate.IsZero())
 }
 
+func TestCountProcessedMessages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	count, err := db.CountProcessedMessages(context.Background(), "INBOX")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	testTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		err = db.MarkMessageProcessed(context.Background(), "INBOX", uint32(i), "Subject", "user@example.com", testTime)
+		require.NoError(t, err)
+	}
+	err = db.MarkMessageProcessed(context.Background(), "Sent", 1, "Subject", "user@example.com", testTime)
+	require.NoError(t, err)
+
+	count, err = db.CountProcessedMessages(context.Background(), "INBOX")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
 func TestClearFolderHistory(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
 	testTime := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
 
-	err := db.MarkMessageProcessed("INBOX", 1, "Subject 1", "user1@example.com", testTime)
+	err := db.MarkMessageProcessed(context.Background(), "INBOX", 1, "Subject 1", "user1@example.com", testTime)
 	assert.NoError(t, err)
-	err = db.MarkMessageProcessed("INBOX", 2, "Subject 2", "user2@example.com", testTime)
+	err = db.MarkMessageProcessed(context.Background(), "INBOX", 2, "Subject 2", "user2@example.com", testTime)
 	assert.NoError(t, err)
-	err = db.MarkMessageProcessed("Sent", 1, "Sent Subject 1", "sender1@example.com", testTime)
+	err = db.MarkMessageProcessed(context.Background(), "Sent", 1, "Sent Subject 1", "sender1@example.com", testTime)
 	assert.NoError(t, err)
 
-	processed, err := db.IsMessageProcessed("INBOX", 1)
+	processed, err := db.IsMessageProcessed(context.Background(), "INBOX", 1)
 	assert.NoError(t, err)
 	assert.True(t, processed)
 
-	processed, err = db.IsMessageProcessed("Sent", 1)
+	processed, err = db.IsMessageProcessed(context.Background(), "Sent", 1)
 	assert.NoError(t, err)
 	assert.True(t, processed)
 
-	err = db.ClearFolderHistory("INBOX")
+	err = db.ClearFolderHistory(context.Background(), "INBOX")
 	assert.NoError(t, err)
 
-	processed, err = db.IsMessageProcessed("INBOX", 1)
+	processed, err = db.IsMessageProcessed(context.Background(), "INBOX", 1)
 	assert.NoError(t, err)
 	assert.False(t, processed)
 
-	processed, err = db.IsMessageProcessed("INBOX", 2)
+	processed, err = db.IsMessageProcessed(context.Background(), "INBOX", 2)
 	assert.NoError(t, err)
 	assert.False(t, processed)
 
-	processed, err = db.IsMessageProcessed("Sent", 1)
+	processed, err = db.IsMessageProcessed(context.Background(), "Sent", 1)
 	assert.NoError(t, err)
 	assert.True(t, processed)
 
-	err = db.ClearFolderHistory("NonExistent")
+	err = db.ClearFolderHistory(context.Background(), "NonExistent")
 	assert.NoError(t, err)
 }
 
@@ -248,3 +273,53 @@ func setupTestDB(t *testing.T) *DB {
 	require.NoError(t, err)
 	return db
 }
+
+func TestFilterNewUIDsChunksLargeBatches(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var messages []NewMessage
+	var uids []uint32
+	for uid := uint32(1); uid <= 2*maxQueryParams+10; uid++ {
+		uids = append(uids, uid)
+		if uid%2 == 0 {
+			messages = append(messages, NewMessage{UID: uid, Subject: "Bulk", Date: time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)})
+		}
+	}
+	require.NoError(t, db.MarkMessagesProcessed(context.Background(), "INBOX", messages))
+
+	fresh, err := db.FilterNewUIDs(context.Background(), "INBOX", uids)
+	require.NoError(t, err)
+	assert.Len(t, fresh, len(uids)-len(messages))
+	for _, uid := range fresh {
+		assert.Equal(t, uint32(1), uid%2)
+	}
+}
+
+func TestIsBusy(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "busy.db")
+	db, err := New(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Hold the write lock on one connection while another, without a busy timeout, tries to write
+	ctx := context.Background()
+	holder, err := db.conn.Conn(ctx)
+	require.NoError(t, err)
+	defer holder.Close()
+	_, err = holder.ExecContext(ctx, `BEGIN IMMEDIATE`)
+	require.NoError(t, err)
+	defer holder.ExecContext(ctx, `ROLLBACK`)
+
+	impatient, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer impatient.Close()
+
+	_, err = impatient.Exec(`INSERT INTO processed_messages (folder, uid) VALUES ('INBOX', 1)`)
+	require.Error(t, err)
+	assert.True(t, isBusy(err))
+	assert.True(t, isBusy(fmt.Errorf("wrapped: %w", err)))
+
+	assert.False(t, isBusy(errors.New("database is locked")), "only typed SQLite errors count")
+	assert.False(t, isBusy(nil))
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,7 +15,7 @@ func TestGetLastProcessedDateParseError(t *testing.T) {
 		"INBOX", 1, "Test", "test@example.com", "invalid-date-format")
 	assert.NoError(t, err)
 
-	lastDate, err := database.GetLastProcessedDate("INBOX")
+	lastDate, err := database.GetLastProcessedDate(context.Background(), "INBOX")
 	assert.Error(t, err)
 	assert.True(t, lastDate.IsZero())
 	assert.Contains(t, err.Error(), "failed to parse last processed date")
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one step of the schema history. Migrations are applied in order and never
+// edited once released; schema changes are made by appending a new migration.
+type migration struct {
+	version     int
+	description string
+	up          string
+}
+
+// dialect holds the backend-specific statements used by the migration runner
+type dialect struct {
+	schemaVersionTable string // creates schema_version if missing
+	tableExists        string // counts tables named by its single parameter
+	lock               string // optional statement serializing migrations across processes
+	rebind             func(query string) string
+}
+
+var sqliteDialect = dialect{
+	schemaVersionTable: `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`,
+	tableExists: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	rebind:      func(query string) string { return query },
+}
+
+// The first SQLite migrations use IF NOT EXISTS so databases created before versioning
+// was introduced are adopted without changes.
+var sqliteMigrations = []migration{
+	{
+		version:     1,
+		description: "processed messages",
+		up: `
+		CREATE TABLE IF NOT EXISTS processed_messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			folder TEXT NOT NULL,
+			uid INTEGER NOT NULL,
+			subject TEXT,
+			from_addr TEXT,
+			date DATETIME,
+			processed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(folder, uid)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_folder_uid ON processed_messages(folder, uid);
+		CREATE INDEX IF NOT EXISTS idx_folder_date ON processed_messages(folder, date);
+		`,
+	},
+	{
+		version:     2,
+		description: "feed access tokens",
+		up: `
+		CREATE TABLE IF NOT EXISTS feed_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			feed TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			description TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			revoked_at DATETIME
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_feed_tokens_feed ON feed_tokens(feed);
+		`,
+	},
+	{
+		version:     3,
+		description: "folder state",
+		up: `
+		CREATE TABLE IF NOT EXISTS folder_state (
+			folder TEXT PRIMARY KEY,
+			feed_name TEXT,
+			last_sync_at DATETIME,
+			last_success_at DATETIME,
+			last_error TEXT,
+			backlog INTEGER NOT NULL DEFAULT 0,
+			item_count INTEGER NOT NULL DEFAULT 0
+		);
+		`,
+	},
+	{
+		version:     4,
+		description: "message bodies",
+		up: `
+		CREATE TABLE IF NOT EXISTS message_bodies (
+			folder TEXT NOT NULL,
+			uid INTEGER NOT NULL,
+			text_body TEXT,
+			html_body TEXT,
+			size INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (folder, uid)
+		);
+		`,
+	},
+	{
+		version:     5,
+		description: "full-text search",
+		up: `
+		CREATE VIRTUAL TABLE message_search USING fts5(subject, from_addr, body);
+
+		INSERT INTO message_search (rowid, subject, from_addr, body)
+		SELECT p.id, COALESCE(p.subject, ''), COALESCE(p.from_addr, ''),
+			COALESCE(NULLIF(b.text_body, ''), b.html_body, '')
+		FROM processed_messages p
+		LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid;
+
+		-- INSERT OR REPLACE does not fire delete triggers, so drop the replaced row first
+		CREATE TRIGGER message_search_replace BEFORE INSERT ON processed_messages BEGIN
+			DELETE FROM message_search WHERE rowid IN (
+				SELECT id FROM processed_messages WHERE folder = NEW.folder AND uid = NEW.uid
+			);
+		END;
+
+		CREATE TRIGGER message_search_insert AFTER INSERT ON processed_messages BEGIN
+			INSERT OR REPLACE INTO message_search (rowid, subject, from_addr, body)
+			SELECT NEW.id, COALESCE(NEW.subject, ''), COALESCE(NEW.from_addr, ''), COALESCE((
+				SELECT COALESCE(NULLIF(text_body, ''), html_body) FROM message_bodies
+				WHERE folder = NEW.folder AND uid = NEW.uid
+			), '');
+		END;
+
+		CREATE TRIGGER message_search_delete AFTER DELETE ON processed_messages BEGIN
+			DELETE FROM message_search WHERE rowid = OLD.id;
+		END;
+
+		CREATE TRIGGER message_search_body AFTER INSERT ON message_bodies BEGIN
+			INSERT OR REPLACE INTO message_search (rowid, subject, from_addr, body)
+			SELECT id, COALESCE(subject, ''), COALESCE(from_addr, ''),
+				COALESCE(NULLIF(NEW.text_body, ''), NEW.html_body, '')
+			FROM processed_messages WHERE folder = NEW.folder AND uid = NEW.uid;
+		END;
+		`,
+	},
+	{
+		version:     6,
+		description: "websub subscriptions",
+		up: `
+		CREATE TABLE websub_subscriptions (
+			topic TEXT NOT NULL,
+			callback TEXT NOT NULL,
+			secret TEXT,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (topic, callback)
+		);
+		`,
+	},
+	{
+		version:     7,
+		description: "pruned messages",
+		up: `
+		CREATE TABLE pruned_messages (
+			folder TEXT NOT NULL,
+			uid INTEGER NOT NULL,
+			date DATETIME,
+			PRIMARY KEY (folder, uid)
+		);
+		`,
+	},
+}
+
+// MigrationStatus describes a known migration and when it was applied
+type MigrationStatus struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time // nil if pending
+}
+
+// Migrate applies all pending migrations, each in its own transaction
+func (db *DB) Migrate(ctx context.Context) error {
+	// Pin one connection so the auto_vacuum mode applies to the tables created below
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Only takes effect on a new, empty database; see Vacuum for existing ones
+	if _, err := conn.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+		return fmt.Errorf("failed to set auto_vacuum: %v", err)
+	}
+
+	return runMigrations(ctx, conn, sqliteDialect, sqliteMigrations)
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an unversioned database
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, db.conn, sqliteDialect, sqliteMigrations)
+}
+
+// MigrationStatus lists every known migration with its applied time
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, db.conn, sqliteDialect, sqliteMigrations)
+}
+
+// runMigrations applies every migration in list that is not recorded in schema_version
+func runMigrations(ctx context.Context, conn *sql.Conn, d dialect, list []migration) error {
+	if _, err := conn.ExecContext(ctx, d.schemaVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %v", err)
+	}
+
+	for _, m := range list {
+		if err := applyMigration(ctx, conn, d, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.description, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration applies m unless it is already recorded. The check runs inside the
+// transaction so concurrent processes cannot apply the same migration twice.
+func applyMigration(ctx context.Context, conn *sql.Conn, d dialect, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if d.lock != "" {
+		if _, err := tx.ExecContext(ctx, d.lock); err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	if err := tx.QueryRowContext(ctx, d.rebind(`SELECT COUNT(*) FROM schema_version WHERE version = ?`), m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.up); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, d.rebind(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`),
+		m.version, m.description, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	logger.Info("Applied database migration", "version", m.version, "description", m.description)
+	return nil
+}
+
+func schemaVersion(ctx context.Context, conn *sql.DB, d dialect, list []migration) (int, error) {
+	statuses, err := migrationStatus(ctx, conn, d, list)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for _, status := range statuses {
+		if status.AppliedAt != nil && status.Version > version {
+			version = status.Version
+		}
+	}
+	return version, nil
+}
+
+func migrationStatus(ctx context.Context, conn *sql.DB, d dialect, list []migration) ([]MigrationStatus, error) {
+	applied := make(map[int]time.Time)
+
+	var exists int
+	if err := conn.QueryRowContext(ctx, d.rebind(d.tableExists), "schema_version").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read migration status: %v", err)
+	}
+
+	if exists > 0 {
+		rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_version`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration status: %v", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version int
+			var appliedAt time.Time
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				return nil, fmt.Errorf("failed to scan migration status: %v", err)
+			}
+			applied[version] = appliedAt
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read migration status: %v", err)
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(list))
+	for _, m := range list {
+		status := MigrationStatus{Version: m.version, Description: m.description}
+		if appliedAt, ok := applied[m.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacySchema is the schema created by DB.migrate before versioned migrations existed
+const legacySchema = `
+CREATE TABLE IF NOT EXISTS processed_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	folder TEXT NOT NULL,
+	uid INTEGER NOT NULL,
+	subject TEXT,
+	from_addr TEXT,
+	date DATETIME,
+	processed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(folder, uid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_folder_uid ON processed_messages(folder, uid);
+CREATE INDEX IF NOT EXISTS idx_folder_date ON processed_messages(folder, date);
+
+CREATE TABLE IF NOT EXISTS feed_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	feed TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	description TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	revoked_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_feed_tokens_feed ON feed_tokens(feed);
+
+CREATE TABLE IF NOT EXISTS folder_state (
+	folder TEXT PRIMARY KEY,
+	feed_name TEXT,
+	last_sync_at DATETIME,
+	last_success_at DATETIME,
+	last_error TEXT,
+	backlog INTEGER NOT NULL DEFAULT 0,
+	item_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS message_bodies (
+	folder TEXT NOT NULL,
+	uid INTEGER NOT NULL,
+	text_body TEXT,
+	html_body TEXT,
+	size INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (folder, uid)
+);
+`
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	version, err := db.SchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, sqliteMigrations[len(sqliteMigrations)-1].version, version)
+
+	statuses, err := db.MigrationStatus(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, len(sqliteMigrations))
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "migration %d should be applied", status.Version)
+	}
+}
+
+func TestMigrateUpgradesLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	legacy, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	_, err = legacy.Exec(legacySchema)
+	require.NoError(t, err)
+	_, err = legacy.Exec(`INSERT INTO processed_messages (folder, uid, subject, from_addr, date) VALUES (?, ?, ?, ?, ?)`,
+		"INBOX", 42, "Before upgrade", "sender@example.com", time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.NoError(t, legacy.Close())
+
+	db, err := Open(dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	version, err := db.SchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, version, "legacy databases start unversioned")
+
+	require.NoError(t, db.Migrate(context.Background()))
+
+	version, err = db.SchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, sqliteMigrations[len(sqliteMigrations)-1].version, version)
+
+	processed, err := db.IsMessageProcessed(context.Background(), "INBOX", 42)
+	require.NoError(t, err)
+	assert.True(t, processed, "existing rows survive the upgrade")
+
+	// Applying again is a no-op
+	require.NoError(t, db.Migrate(context.Background()))
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "failing.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	original := sqliteMigrations
+	defer func() { sqliteMigrations = original }()
+
+	sqliteMigrations = append(append([]migration{}, original...), migration{
+		version:     len(original) + 1,
+		description: "broken",
+		up: `
+		CREATE TABLE half_applied (id INTEGER);
+		THIS IS NOT SQL;
+		`,
+	})
+
+	err = db.Migrate(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+
+	version, err := db.SchemaVersion(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, len(original), version, "earlier migrations stay applied")
+
+	var tables int
+	require.NoError(t, db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_applied'`).Scan(&tables))
+	assert.Zero(t, tables, "a failed migration leaves no partial changes")
+}
@@ -0,0 +1,896 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresMigrationLock is the advisory lock key held while applying a migration so
+// replicas starting at the same time don't race
+const postgresMigrationLock = 727373
+
+// PostgresDB is a Store backed by PostgreSQL, allowing several replicas to share state
+type PostgresDB struct {
+	conn *sql.DB
+}
+
+// Upserts shared by the single and batched write paths
+const (
+	postgresMarkProcessed = `
+	INSERT INTO processed_messages (folder, uid, subject, from_addr, date)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (folder, uid) DO UPDATE SET
+		subject = EXCLUDED.subject,
+		from_addr = EXCLUDED.from_addr,
+		date = EXCLUDED.date,
+		processed_at = now()
+	`
+	postgresStoreBody = `
+	INSERT INTO message_bodies (folder, uid, text_body, html_body, size)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (folder, uid) DO UPDATE SET
+		text_body = EXCLUDED.text_body,
+		html_body = EXCLUDED.html_body,
+		size = EXCLUDED.size
+	`
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+var postgresDialect = dialect{
+	schemaVersionTable: `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`,
+	tableExists: `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`,
+	lock:        `SELECT pg_advisory_xact_lock(` + strconv.Itoa(postgresMigrationLock) + `)`,
+	rebind:      rebindPostgres,
+}
+
+// postgresMigrations mirror sqliteMigrations version for version
+var postgresMigrations = []migration{
+	{
+		version:     1,
+		description: "processed messages",
+		up: `
+		CREATE TABLE IF NOT EXISTS processed_messages (
+			id BIGSERIAL PRIMARY KEY,
+			folder TEXT NOT NULL,
+			uid BIGINT NOT NULL,
+			subject TEXT,
+			from_addr TEXT,
+			date TIMESTAMPTZ,
+			processed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			UNIQUE(folder, uid)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_folder_date ON processed_messages(folder, date);
+		`,
+	},
+	{
+		version:     2,
+		description: "feed access tokens",
+		up: `
+		CREATE TABLE IF NOT EXISTS feed_tokens (
+			id BIGSERIAL PRIMARY KEY,
+			feed TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			description TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			revoked_at TIMESTAMPTZ
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_feed_tokens_feed ON feed_tokens(feed);
+		`,
+	},
+	{
+		version:     3,
+		description: "folder state",
+		up: `
+		CREATE TABLE IF NOT EXISTS folder_state (
+			folder TEXT PRIMARY KEY,
+			feed_name TEXT,
+			last_sync_at TIMESTAMPTZ,
+			last_success_at TIMESTAMPTZ,
+			last_error TEXT,
+			backlog INTEGER NOT NULL DEFAULT 0,
+			item_count INTEGER NOT NULL DEFAULT 0
+		);
+		`,
+	},
+	{
+		version:     4,
+		description: "message bodies",
+		up: `
+		CREATE TABLE IF NOT EXISTS message_bodies (
+			folder TEXT NOT NULL,
+			uid BIGINT NOT NULL,
+			text_body TEXT,
+			html_body TEXT,
+			size BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (folder, uid)
+		);
+		`,
+	},
+	{
+		version:     5,
+		description: "full-text search",
+		up: `
+		CREATE TABLE IF NOT EXISTS message_search (
+			message_id BIGINT PRIMARY KEY REFERENCES processed_messages(id) ON DELETE CASCADE,
+			document TSVECTOR NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_message_search_document ON message_search USING GIN (document);
+
+		INSERT INTO message_search (message_id, document)
+		SELECT p.id, ` + postgresSearchDocument + `
+		FROM processed_messages p
+		LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+		ON CONFLICT (message_id) DO NOTHING;
+		`,
+	},
+	{
+		version:     6,
+		description: "websub subscriptions",
+		up: `
+		CREATE TABLE IF NOT EXISTS websub_subscriptions (
+			topic TEXT NOT NULL,
+			callback TEXT NOT NULL,
+			secret TEXT,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (topic, callback)
+		);
+		`,
+	},
+	{
+		version:     7,
+		description: "pruned messages",
+		up: `
+		CREATE TABLE IF NOT EXISTS pruned_messages (
+			folder TEXT NOT NULL,
+			uid BIGINT NOT NULL,
+			date TIMESTAMPTZ,
+			PRIMARY KEY (folder, uid)
+		);
+		`,
+	},
+}
+
+// postgresSearchDocument builds the search document of processed message p and its body b.
+// The simple configuration matches the SQLite index: no stemming or stop words.
+const postgresSearchDocument = `to_tsvector('simple', concat_ws(' ', p.subject, p.from_addr, COALESCE(NULLIF(b.text_body, ''), b.html_body)))`
+
+// rebindPostgres converts ? placeholders to PostgreSQL's numbered $n form
+func rebindPostgres(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// NewPostgres connects to PostgreSQL and applies any pending migrations
+func NewPostgres(dsn string) (*PostgresDB, error) {
+	db, err := OpenPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	return db, nil
+}
+
+// OpenPostgres connects to PostgreSQL without touching its schema
+func OpenPostgres(dsn string) (*PostgresDB, error) {
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	conn.SetMaxOpenConns(10)
+	conn.SetMaxIdleConns(5)
+	conn.SetConnMaxIdleTime(5 * time.Minute)
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	return &PostgresDB{conn: conn}, nil
+}
+
+func (db *PostgresDB) Close() error {
+	if db.conn != nil {
+		return db.conn.Close()
+	}
+	return nil
+}
+
+// Migrate applies all pending migrations, each in its own transaction
+func (db *PostgresDB) Migrate(ctx context.Context) error {
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return runMigrations(ctx, conn, postgresDialect, postgresMigrations)
+}
+
+// SchemaVersion returns the highest applied migration version
+func (db *PostgresDB) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, db.conn, postgresDialect, postgresMigrations)
+}
+
+// MigrationStatus lists every known migration with its applied time
+func (db *PostgresDB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, db.conn, postgresDialect, postgresMigrations)
+}
+
+// IsMessageProcessed reports whether uid has been processed in folder, including messages
+// since pruned by retention
+func (db *PostgresDB) IsMessageProcessed(ctx context.Context, folder string, uid uint32) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM processed_messages WHERE folder = $1 AND uid = $2)
+		OR EXISTS (SELECT 1 FROM pruned_messages WHERE folder = $1 AND uid = $2)
+	`
+
+	var processed bool
+	if err := db.conn.QueryRowContext(ctx, query, folder, int64(uid)).Scan(&processed); err != nil {
+		return false, fmt.Errorf("failed to check if message is processed: %v", err)
+	}
+
+	return processed, nil
+}
+
+func (db *PostgresDB) MarkMessageProcessed(ctx context.Context, folder string, uid uint32, subject, from string, date time.Time) error {
+	if _, err := db.conn.ExecContext(ctx, postgresMarkProcessed, folder, int64(uid), subject, from, date); err != nil {
+		return fmt.Errorf("failed to mark message as processed: %v", err)
+	}
+
+	if err := indexMessage(ctx, db.conn, folder, uid); err != nil {
+		return fmt.Errorf("failed to mark message as processed: %v", err)
+	}
+
+	return nil
+}
+
+// FilterNewUIDs returns the uids that have not been processed in folder, in their original
+// order. Pruned messages count as processed.
+func (db *PostgresDB) FilterNewUIDs(ctx context.Context, folder string, uids []uint32) ([]uint32, error) {
+	params := make([]int64, 0, len(uids))
+	for _, uid := range uids {
+		params = append(params, int64(uid))
+	}
+
+	query := `
+	SELECT uid FROM processed_messages WHERE folder = $1 AND uid = ANY($2)
+	UNION SELECT uid FROM pruned_messages WHERE folder = $1 AND uid = ANY($2)
+	`
+	rows, err := db.conn.QueryContext(ctx, query, folder, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter processed messages: %v", err)
+	}
+	defer rows.Close()
+
+	processed := make(map[uint32]bool, len(uids))
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("failed to filter processed messages: %v", err)
+		}
+		processed[uint32(uid)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to filter processed messages: %v", err)
+	}
+
+	var fresh []uint32
+	for _, uid := range uids {
+		if !processed[uid] {
+			fresh = append(fresh, uid)
+		}
+	}
+	return fresh, nil
+}
+
+// MarkMessagesProcessed records messages and their bodies in a single transaction
+func (db *PostgresDB) MarkMessagesProcessed(ctx context.Context, folder string, messages []NewMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to mark messages as processed: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, msg := range messages {
+		if _, err := tx.ExecContext(ctx, postgresMarkProcessed, folder, int64(msg.UID), msg.Subject, msg.From, msg.Date); err != nil {
+			return fmt.Errorf("failed to mark messages as processed: %v", err)
+		}
+		size := len(msg.TextBody) + len(msg.HTMLBody)
+		if _, err := tx.ExecContext(ctx, postgresStoreBody, folder, int64(msg.UID), msg.TextBody, msg.HTMLBody, size); err != nil {
+			return fmt.Errorf("failed to mark messages as processed: %v", err)
+		}
+		if err := indexMessage(ctx, tx, folder, msg.UID); err != nil {
+			return fmt.Errorf("failed to mark messages as processed: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to mark messages as processed: %v", err)
+	}
+	return nil
+}
+
+func (db *PostgresDB) GetProcessedMessages(ctx context.Context, folder string, limit int) ([]ProcessedMessage, error) {
+	query := `
+	SELECT id, folder, uid, subject, from_addr, date, processed_at
+	FROM processed_messages
+	WHERE folder = $1
+	ORDER BY date DESC
+	LIMIT $2
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, folder, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processed messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []ProcessedMessage
+	for rows.Next() {
+		var msg ProcessedMessage
+		err := rows.Scan(&msg.ID, &msg.Folder, &msg.UID, &msg.Subject, &msg.From, &msg.Date, &msg.ProcessedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// CountProcessedMessages returns the number of messages tracked for folder
+func (db *PostgresDB) CountProcessedMessages(ctx context.Context, folder string) (int, error) {
+	var count int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM processed_messages WHERE folder = $1`, folder).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count processed messages: %v", err)
+	}
+
+	return count, nil
+}
+
+func (db *PostgresDB) ClearFolderHistory(ctx context.Context, folder string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to clear folder history: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_bodies WHERE folder = $1`, folder); err != nil {
+		return fmt.Errorf("failed to clear folder history: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pruned_messages WHERE folder = $1`, folder); err != nil {
+		return fmt.Errorf("failed to clear folder history: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM processed_messages WHERE folder = $1`, folder); err != nil {
+		return fmt.Errorf("failed to clear folder history: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to clear folder history: %v", err)
+	}
+	return nil
+}
+
+func (db *PostgresDB) GetLastProcessedDate(ctx context.Context, folder string) (time.Time, error) {
+	var lastDate sql.NullTime
+	query := `
+	SELECT MAX(date) FROM (
+		SELECT date FROM processed_messages WHERE folder = $1
+		UNION ALL SELECT date FROM pruned_messages WHERE folder = $1
+	) dates`
+	if err := db.conn.QueryRowContext(ctx, query, folder).Scan(&lastDate); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last processed date: %v", err)
+	}
+
+	return lastDate.Time, nil
+}
+
+// StoreMessageBody saves the decoded bodies of a processed message
+func (db *PostgresDB) StoreMessageBody(ctx context.Context, folder string, uid uint32, textBody, htmlBody string) error {
+	size := len(textBody) + len(htmlBody)
+	if _, err := db.conn.ExecContext(ctx, postgresStoreBody, folder, int64(uid), textBody, htmlBody, size); err != nil {
+		return fmt.Errorf("failed to store message body: %v", err)
+	}
+
+	if err := indexMessage(ctx, db.conn, folder, uid); err != nil {
+		return fmt.Errorf("failed to store message body: %v", err)
+	}
+
+	return nil
+}
+
+// indexMessage refreshes the search document of a message; the SQLite store uses triggers instead
+func indexMessage(ctx context.Context, conn execer, folder string, uid uint32) error {
+	query := `
+	INSERT INTO message_search (message_id, document)
+	SELECT p.id, ` + postgresSearchDocument + `
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.folder = $1 AND p.uid = $2
+	ON CONFLICT (message_id) DO UPDATE SET document = EXCLUDED.document
+	`
+
+	_, err := conn.ExecContext(ctx, query, folder, int64(uid))
+	return err
+}
+
+// SearchMessages returns the messages matching query, newest first
+func (db *PostgresDB) SearchMessages(ctx context.Context, query SearchQuery) ([]StoredMessage, error) {
+	if strings.TrimSpace(query.Text) == "" {
+		return nil, nil
+	}
+
+	sqlQuery := `
+	SELECT p.id, p.folder, p.uid, p.subject, p.from_addr, p.date, p.processed_at,
+		COALESCE(b.text_body, ''), COALESCE(b.html_body, '')
+	FROM message_search s
+	JOIN processed_messages p ON p.id = s.message_id
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE s.document @@ plainto_tsquery('simple', $1)
+	`
+	args := []any{query.Text}
+	if len(query.Folders) > 0 {
+		args = append(args, query.Folders)
+		sqlQuery += fmt.Sprintf(` AND p.folder = ANY($%d)`, len(args))
+	}
+	sqlQuery += ` ORDER BY p.date DESC NULLS LAST, p.id DESC`
+	if query.Limit > 0 {
+		args = append(args, query.Limit)
+		sqlQuery += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+
+	rows, err := db.conn.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []StoredMessage
+	for rows.Next() {
+		var msg StoredMessage
+		err := rows.Scan(&msg.ID, &msg.Folder, &msg.UID, &msg.Subject, &msg.From, &msg.Date, &msg.ProcessedAt,
+			&msg.TextBody, &msg.HTMLBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// retentionRows returns the messages of folder sorted newest first
+func (db *PostgresDB) retentionRows(ctx context.Context, folder string) ([]retentionRow, error) {
+	query := `
+	SELECT p.id, p.date, COALESCE(b.size, 0)
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.folder = $1
+	ORDER BY p.date DESC NULLS LAST, p.id DESC
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, folder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []retentionRow
+	for rows.Next() {
+		var row retentionRow
+		var date sql.NullTime
+		if err := rows.Scan(&row.id, &date, &row.size); err != nil {
+			return nil, err
+		}
+		row.date = date.Time
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// GetFeedMessages returns the messages of folder that fall within policy, newest first
+func (db *PostgresDB) GetFeedMessages(ctx context.Context, folder string, policy RetentionPolicy) ([]StoredMessage, error) {
+	rows, err := db.retentionRows(ctx, folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed messages: %v", err)
+	}
+
+	var ids []int64
+	for i, kept := range policy.keep(rows, time.Now()) {
+		if kept {
+			ids = append(ids, rows[i].id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query := `
+	SELECT p.id, p.folder, p.uid, p.subject, p.from_addr, p.date, p.processed_at,
+		COALESCE(b.text_body, ''), COALESCE(b.html_body, '')
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.id = ANY($1)
+	ORDER BY p.date DESC NULLS LAST, p.id DESC
+	`
+
+	result, err := db.conn.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed messages: %v", err)
+	}
+	defer result.Close()
+
+	messages := make([]StoredMessage, 0, len(ids))
+	for result.Next() {
+		var msg StoredMessage
+		err := result.Scan(&msg.ID, &msg.Folder, &msg.UID, &msg.Subject, &msg.From, &msg.Date, &msg.ProcessedAt,
+			&msg.TextBody, &msg.HTMLBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, result.Err()
+}
+
+// PruneMessages deletes the messages of folder that fall outside policy, keeping those
+// within a day of the newest message as the IMAP search watermark. Pruned messages are
+// recorded in pruned_messages so they are still recognised as processed.
+func (db *PostgresDB) PruneMessages(ctx context.Context, folder string, policy RetentionPolicy) (int, error) {
+	if policy == (RetentionPolicy{}) {
+		return 0, nil
+	}
+
+	rows, err := db.retentionRows(ctx, folder)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	watermark := rows[0].date.Add(-watermarkGrace)
+	var ids []int64
+	for i, kept := range policy.keep(rows, time.Now()) {
+		if !kept && rows[i].date.Before(watermark) {
+			ids = append(ids, rows[i].id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+	defer tx.Rollback()
+
+	keepRecords := `
+	INSERT INTO pruned_messages (folder, uid, date)
+	SELECT folder, uid, date FROM processed_messages WHERE id = ANY($1)
+	ON CONFLICT (folder, uid) DO UPDATE SET date = EXCLUDED.date
+	`
+	if _, err := tx.ExecContext(ctx, keepRecords, ids); err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+
+	deleteBodies := `
+	DELETE FROM message_bodies b
+	USING processed_messages p
+	WHERE p.id = ANY($1) AND b.folder = p.folder AND b.uid = p.uid
+	`
+	if _, err := tx.ExecContext(ctx, deleteBodies, ids); err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM processed_messages WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+
+	return len(ids), nil
+}
+
+// Vacuum reclaims space left by pruning. Autovacuum normally covers this; running it
+// explicitly keeps the schedule consistent with SQLite.
+func (db *PostgresDB) Vacuum(ctx context.Context) error {
+	if _, err := db.conn.ExecContext(ctx, `VACUUM (ANALYZE) processed_messages, message_bodies`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %v", err)
+	}
+	return nil
+}
+
+// UpdateFolderState stores state for its folder, keeping the previous success time when
+// LastSuccessAt is zero
+func (db *PostgresDB) UpdateFolderState(ctx context.Context, state FolderState) error {
+	query := `
+	INSERT INTO folder_state (folder, feed_name, last_sync_at, last_success_at, last_error, backlog, item_count)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (folder) DO UPDATE SET
+		feed_name = EXCLUDED.feed_name,
+		last_sync_at = EXCLUDED.last_sync_at,
+		last_success_at = COALESCE(EXCLUDED.last_success_at, folder_state.last_success_at),
+		last_error = EXCLUDED.last_error,
+		backlog = EXCLUDED.backlog,
+		item_count = EXCLUDED.item_count
+	`
+
+	var lastSuccess sql.NullTime
+	if !state.LastSuccessAt.IsZero() {
+		lastSuccess = sql.NullTime{Time: state.LastSuccessAt.UTC(), Valid: true}
+	}
+
+	_, err := db.conn.ExecContext(ctx, query, state.Folder, state.FeedName, state.LastSyncAt.UTC(), lastSuccess,
+		state.LastError, state.Backlog, state.ItemCount)
+	if err != nil {
+		return fmt.Errorf("failed to update folder state: %v", err)
+	}
+
+	return nil
+}
+
+// GetFolderStates returns the recorded state of every folder, ordered by folder
+func (db *PostgresDB) GetFolderStates(ctx context.Context) ([]FolderState, error) {
+	query := `
+	SELECT folder, feed_name, last_sync_at, last_success_at, last_error, backlog, item_count
+	FROM folder_state
+	ORDER BY folder
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder states: %v", err)
+	}
+	defer rows.Close()
+
+	var states []FolderState
+	for rows.Next() {
+		var state FolderState
+		var feedName, lastError sql.NullString
+		var lastSync, lastSuccess sql.NullTime
+		if err := rows.Scan(&state.Folder, &feedName, &lastSync, &lastSuccess, &lastError, &state.Backlog, &state.ItemCount); err != nil {
+			return nil, fmt.Errorf("failed to scan folder state: %v", err)
+		}
+		state.FeedName = feedName.String
+		state.LastError = lastError.String
+		state.LastSyncAt = lastSync.Time
+		state.LastSuccessAt = lastSuccess.Time
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// Ping verifies the database is reachable and can execute a query
+func (db *PostgresDB) Ping(ctx context.Context) error {
+	var one int
+	if err := db.conn.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+		return fmt.Errorf("database ping failed: %v", err)
+	}
+	return nil
+}
+
+// CreateFeedToken mints a new random token for feed and returns its record along
+// with the plaintext token, which is not recoverable afterwards
+func (db *PostgresDB) CreateFeedToken(ctx context.Context, feed, description string) (*FeedToken, string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	query := `
+	INSERT INTO feed_tokens (feed, token_hash, description)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at
+	`
+
+	record := &FeedToken{Feed: feed, Description: description}
+	if err := db.conn.QueryRowContext(ctx, query, feed, hashToken(token), description).Scan(&record.ID, &record.CreatedAt); err != nil {
+		return nil, "", fmt.Errorf("failed to create feed token: %v", err)
+	}
+
+	return record, token, nil
+}
+
+// RevokeFeedToken marks a token as revoked so it no longer grants access
+func (db *PostgresDB) RevokeFeedToken(ctx context.Context, id int64) error {
+	result, err := db.conn.ExecContext(ctx, `UPDATE feed_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke feed token: %v", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke feed token: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("no active token with id %d", id)
+	}
+
+	return nil
+}
+
+// ListFeedTokens returns all tokens, optionally restricted to a single feed
+func (db *PostgresDB) ListFeedTokens(ctx context.Context, feed string) ([]FeedToken, error) {
+	query := `
+	SELECT id, feed, description, created_at, revoked_at
+	FROM feed_tokens
+	WHERE $1 = '' OR feed = $1
+	ORDER BY id
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feed tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []FeedToken
+	for rows.Next() {
+		var token FeedToken
+		var description sql.NullString
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Feed, &description, &token.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feed token: %v", err)
+		}
+		token.Description = description.String
+		if revokedAt.Valid {
+			token.RevokedAt = &revokedAt.Time
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// ValidateFeedToken reports whether token is an active token for feed
+func (db *PostgresDB) ValidateFeedToken(ctx context.Context, feed, token string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM feed_tokens WHERE feed = $1 AND token_hash = $2 AND revoked_at IS NULL)`
+
+	var valid bool
+	if err := db.conn.QueryRowContext(ctx, query, feed, hashToken(token)).Scan(&valid); err != nil {
+		return false, fmt.Errorf("failed to validate feed token: %v", err)
+	}
+
+	return valid, nil
+}
+
+// SaveSubscription stores sub, renewing the lease and secret of an existing subscription
+// of the same callback to the same topic
+func (db *PostgresDB) SaveSubscription(ctx context.Context, sub Subscription) error {
+	query := `
+	INSERT INTO websub_subscriptions (topic, callback, secret, expires_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (topic, callback) DO UPDATE SET
+		secret = EXCLUDED.secret,
+		expires_at = EXCLUDED.expires_at
+	`
+
+	if _, err := db.conn.ExecContext(ctx, query, sub.Topic, sub.Callback, sub.Secret, sub.ExpiresAt.UTC()); err != nil {
+		return fmt.Errorf("failed to save subscription: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteSubscription removes callback's subscription to topic, if any
+func (db *PostgresDB) DeleteSubscription(ctx context.Context, topic, callback string) error {
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM websub_subscriptions WHERE topic = $1 AND callback = $2`, topic, callback); err != nil {
+		return fmt.Errorf("failed to delete subscription: %v", err)
+	}
+
+	return nil
+}
+
+// GetSubscriptions returns the subscriptions to topic, expired ones included, ordered by callback
+func (db *PostgresDB) GetSubscriptions(ctx context.Context, topic string) ([]Subscription, error) {
+	query := `
+	SELECT topic, callback, secret, expires_at
+	FROM websub_subscriptions
+	WHERE topic = $1
+	ORDER BY callback
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	return scanSubscriptions(rows)
+}
+
+// GetMessagesSince returns up to limit messages of folders stored after the message with id
+// afterID, in the order they were stored
+func (db *PostgresDB) GetMessagesSince(ctx context.Context, folders []string, afterID int64, limit int) ([]StoredMessage, error) {
+	if len(folders) == 0 {
+		return nil, nil
+	}
+
+	query := `
+	SELECT p.id, p.folder, p.uid, p.subject, p.from_addr, p.date, p.processed_at,
+		COALESCE(b.text_body, ''), COALESCE(b.html_body, '')
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.id > $1 AND p.folder = ANY($2)
+	ORDER BY p.id
+	LIMIT $3
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, afterID, folders, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []StoredMessage
+	for rows.Next() {
+		var msg StoredMessage
+		err := rows.Scan(&msg.ID, &msg.Folder, &msg.UID, &msg.Subject, &msg.From, &msg.Date, &msg.ProcessedAt,
+			&msg.TextBody, &msg.HTMLBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// LatestMessageID returns the ID of the message of folders stored last, or 0 if there is none
+func (db *PostgresDB) LatestMessageID(ctx context.Context, folders []string) (int64, error) {
+	if len(folders) == 0 {
+		return 0, nil
+	}
+
+	var id int64
+	query := `SELECT COALESCE(MAX(id), 0) FROM processed_messages WHERE folder = ANY($1)`
+	if err := db.conn.QueryRowContext(ctx, query, folders).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get latest message: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxQueryParams caps the number of ids bound in a single IN clause
+const maxQueryParams = 500
+
+// watermarkGrace keeps messages dated close to the newest one. IMAP SINCE only has day
+// granularity, so pruning them would make the next run fetch and re-add them.
+const watermarkGrace = 24 * time.Hour
+
+// RetentionPolicy bounds how much of a folder is kept. Zero values mean no limit.
+type RetentionPolicy struct {
+	MaxItems int
+	MaxAge   time.Duration
+	MaxBytes int64 // total size of stored message bodies
+}
+
+// StoredMessage is a processed message together with its stored body
+type StoredMessage struct {
+	ProcessedMessage
+	TextBody string
+	HTMLBody string
+}
+
+// retentionRow is the per-message information needed to apply a RetentionPolicy
+type retentionRow struct {
+	id   int64
+	date time.Time
+	size int64
+}
+
+// keep reports which rows fall within the policy. rows must be sorted newest first.
+func (p RetentionPolicy) keep(rows []retentionRow, now time.Time) []bool {
+	kept := make([]bool, len(rows))
+	var count int
+	var total int64
+	for i, row := range rows {
+		if p.MaxAge > 0 && row.date.Before(now.Add(-p.MaxAge)) {
+			continue
+		}
+		if p.MaxItems > 0 && count >= p.MaxItems {
+			continue
+		}
+		if p.MaxBytes > 0 && total+row.size > p.MaxBytes && count > 0 {
+			continue
+		}
+		kept[i] = true
+		count++
+		total += row.size
+	}
+	return kept
+}
+
+// Apply returns the messages that fall within the policy, for feeds assembled before the
+// messages are stored. messages must be sorted newest first.
+func (p RetentionPolicy) Apply(messages []StoredMessage) []StoredMessage {
+	rows := make([]retentionRow, len(messages))
+	for i, msg := range messages {
+		rows[i] = retentionRow{id: msg.ID, date: msg.Date, size: int64(len(msg.TextBody) + len(msg.HTMLBody))}
+	}
+
+	var kept []StoredMessage
+	for i, keep := range p.keep(rows, time.Now()) {
+		if keep {
+			kept = append(kept, messages[i])
+		}
+	}
+	return kept
+}
+
+// StoreMessageBody saves the decoded bodies of a processed message so feeds can be rebuilt from the store
+func (db *DB) StoreMessageBody(ctx context.Context, folder string, uid uint32, textBody, htmlBody string) error {
+	size := len(textBody) + len(htmlBody)
+	err := db.retryOnBusy(func() error {
+		_, err := db.conn.ExecContext(ctx, sqliteStoreBody, folder, uid, textBody, htmlBody, size)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store message body: %v", err)
+	}
+
+	return nil
+}
+
+// retentionRows returns the messages of folder sorted newest first
+func (db *DB) retentionRows(ctx context.Context, folder string) ([]retentionRow, error) {
+	query := `
+	SELECT p.id, p.date, COALESCE(b.size, 0)
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.folder = ?
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, folder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []retentionRow
+	for rows.Next() {
+		var row retentionRow
+		var date sql.NullTime
+		if err := rows.Scan(&row.id, &date, &row.size); err != nil {
+			return nil, err
+		}
+		row.date = date.Time
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortNewestFirst(result)
+	return result, nil
+}
+
+// sortNewestFirst orders rows by date, newest first. Dates are stored as text in
+// SQLite, so they are ordered here rather than in SQL.
+func sortNewestFirst(rows []retentionRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].date.Equal(rows[j].date) {
+			return rows[i].id > rows[j].id
+		}
+		return rows[i].date.After(rows[j].date)
+	})
+}
+
+// GetFeedMessages returns the messages of folder that fall within policy, newest first,
+// including their stored bodies (empty for messages processed before bodies were stored)
+func (db *DB) GetFeedMessages(ctx context.Context, folder string, policy RetentionPolicy) ([]StoredMessage, error) {
+	rows, err := db.retentionRows(ctx, folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed messages: %v", err)
+	}
+
+	var ids []any
+	for i, kept := range policy.keep(rows, time.Now()) {
+		if kept {
+			ids = append(ids, rows[i].id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	messages, err := db.storedMessages(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed messages: %v", err)
+	}
+	return messages, nil
+}
+
+// storedMessages loads the messages with the given ids, in the order of ids
+func (db *DB) storedMessages(ctx context.Context, ids []any) ([]StoredMessage, error) {
+	query := `
+	SELECT p.id, p.folder, p.uid, p.subject, p.from_addr, p.date, p.processed_at,
+		COALESCE(b.text_body, ''), COALESCE(b.html_body, '')
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.id IN (%s)
+	`
+
+	byID := make(map[int64]StoredMessage, len(ids))
+	for _, chunk := range chunkParams(ids) {
+		if err := db.scanStoredMessages(ctx, fmt.Sprintf(query, placeholders(len(chunk))), chunk, byID); err != nil {
+			return nil, err
+		}
+	}
+
+	messages := make([]StoredMessage, 0, len(ids))
+	for _, id := range ids {
+		if msg, ok := byID[id.(int64)]; ok {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (db *DB) scanStoredMessages(ctx context.Context, query string, args []any, into map[int64]StoredMessage) error {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg StoredMessage
+		err := rows.Scan(&msg.ID, &msg.Folder, &msg.UID, &msg.Subject, &msg.From, &msg.Date, &msg.ProcessedAt,
+			&msg.TextBody, &msg.HTMLBody)
+		if err != nil {
+			return err
+		}
+		into[msg.ID] = msg
+	}
+	return rows.Err()
+}
+
+// PruneMessages deletes the messages of folder that fall outside policy and returns how many
+// were removed. Messages dated within a day of the newest one are always kept because they
+// serve as the watermark for the next IMAP search. The UID and date of each pruned message
+// stay in pruned_messages so it is still recognised as processed.
+func (db *DB) PruneMessages(ctx context.Context, folder string, policy RetentionPolicy) (int, error) {
+	if policy == (RetentionPolicy{}) {
+		return 0, nil
+	}
+
+	rows, err := db.retentionRows(ctx, folder)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	watermark := rows[0].date.Add(-watermarkGrace)
+	var ids []any
+	for i, kept := range policy.keep(rows, time.Now()) {
+		if !kept && rows[i].date.Before(watermark) {
+			ids = append(ids, rows[i].id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	err = db.retryOnBusy(func() error {
+		tx, err := db.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, chunk := range chunkParams(ids) {
+			in := placeholders(len(chunk))
+			keepRecord := `
+			INSERT OR REPLACE INTO pruned_messages (folder, uid, date)
+			SELECT folder, uid, date FROM processed_messages WHERE id IN (` + in + `)`
+			if _, err := tx.ExecContext(ctx, keepRecord, chunk...); err != nil {
+				return err
+			}
+			deleteBodies := `
+			DELETE FROM message_bodies WHERE (folder, uid) IN (
+				SELECT folder, uid FROM processed_messages WHERE id IN (` + in + `)
+			)`
+			if _, err := tx.ExecContext(ctx, deleteBodies, chunk...); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM processed_messages WHERE id IN (`+in+`)`, chunk...); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune messages: %v", err)
+	}
+
+	return len(ids), nil
+}
+
+// Vacuum returns free pages to the filesystem. Databases created before incremental
+// auto-vacuum was enabled are converted with a one-off full VACUUM.
+func (db *DB) Vacuum(ctx context.Context) error {
+	var mode int
+	if err := db.conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		return fmt.Errorf("failed to read auto_vacuum mode: %v", err)
+	}
+
+	// PRAGMA auto_vacuum reports 2 for incremental
+	if mode == 2 {
+		// Each step frees a single page, so the rows have to be drained
+		rows, err := db.conn.QueryContext(ctx, `PRAGMA incremental_vacuum`)
+		if err != nil {
+			return fmt.Errorf("failed to run incremental vacuum: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to run incremental vacuum: %v", err)
+		}
+		return nil
+	}
+
+	// The mode change and VACUUM must run on the same connection
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to vacuum database: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+		return fmt.Errorf("failed to enable incremental auto_vacuum: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("failed to vacuum database: %v", err)
+	}
+	return nil
+}
+
+// chunkParams splits params into slices of at most maxQueryParams
+func chunkParams(params []any) [][]any {
+	var chunks [][]any
+	for len(params) > maxQueryParams {
+		chunks = append(chunks, params[:maxQueryParams])
+		params = params[maxQueryParams:]
+	}
+	if len(params) > 0 {
+		chunks = append(chunks, params)
+	}
+	return chunks
+}
+
+// placeholders returns n comma-separated SQL parameter placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedMessages stores count messages one day apart, the newest dated newest
+func seedMessages(t *testing.T, db *DB, folder string, count int, newest time.Time, bodySize int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		uid := uint32(i + 1)
+		date := newest.Add(-time.Duration(count-1-i) * 24 * time.Hour)
+		require.NoError(t, db.MarkMessageProcessed(context.Background(), folder, uid, fmt.Sprintf("Message %d", uid), "sender@example.com", date))
+		require.NoError(t, db.StoreMessageBody(context.Background(), folder, uid, strings.Repeat("x", bodySize), ""))
+	}
+}
+
+func TestGetFeedMessagesHonorsPolicy(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	newest := time.Now().UTC().Truncate(time.Second)
+	seedMessages(t, db, "INBOX", 10, newest, 100)
+
+	messages, err := db.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{})
+	require.NoError(t, err)
+	require.Len(t, messages, 10)
+	assert.Equal(t, uint32(10), messages[0].UID, "newest message first")
+	assert.Equal(t, strings.Repeat("x", 100), messages[0].TextBody)
+
+	messages, err = db.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 3})
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, []uint32{10, 9, 8}, []uint32{messages[0].UID, messages[1].UID, messages[2].UID})
+
+	messages, err = db.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{MaxAge: 72*time.Hour - time.Minute})
+	require.NoError(t, err)
+	assert.Len(t, messages, 3)
+
+	messages, err = db.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{MaxBytes: 450})
+	require.NoError(t, err)
+	assert.Len(t, messages, 4)
+}
+
+func TestGetFeedMessagesWithoutBodies(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, db.MarkMessageProcessed(context.Background(), "INBOX", 1, "Legacy", "sender@example.com", date))
+
+	messages, err := db.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 10})
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Legacy", messages[0].Subject)
+	assert.Empty(t, messages[0].TextBody)
+}
+
+func TestPruneMessages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	newest := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	seedMessages(t, db, "INBOX", 10, newest, 100)
+	seedMessages(t, db, "Other", 5, newest, 100)
+
+	pruned, err := db.PruneMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 4})
+	require.NoError(t, err)
+	assert.Equal(t, 6, pruned)
+
+	count, err := db.CountProcessedMessages(context.Background(), "INBOX")
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	var bodies int
+	require.NoError(t, db.conn.QueryRow(`SELECT COUNT(*) FROM message_bodies WHERE folder = 'INBOX'`).Scan(&bodies))
+	assert.Equal(t, 4, bodies)
+
+	count, err = db.CountProcessedMessages(context.Background(), "Other")
+	require.NoError(t, err)
+	assert.Equal(t, 5, count, "other folders are untouched")
+
+	// Pruning again is a no-op
+	pruned, err = db.PruneMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 4})
+	require.NoError(t, err)
+	assert.Zero(t, pruned)
+}
+
+func TestPruneMessagesKeepsWatermark(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Everything is older than max_age, but messages within a day of the newest
+	// must survive so the next IMAP search does not fetch them again
+	newest := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	seedMessages(t, db, "INBOX", 5, newest, 10)
+	require.NoError(t, db.MarkMessageProcessed(context.Background(), "INBOX", 100, "Same day", "sender@example.com", newest.Add(-time.Hour)))
+
+	pruned, err := db.PruneMessages(context.Background(), "INBOX", RetentionPolicy{MaxAge: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+
+	lastDate, err := db.GetLastProcessedDate(context.Background(), "INBOX")
+	require.NoError(t, err)
+	assert.True(t, newest.Equal(lastDate))
+
+	count, err := db.CountProcessedMessages(context.Background(), "INBOX")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestClearFolderHistoryRemovesBodies(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	seedMessages(t, db, "INBOX", 3, time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC), 10)
+	require.NoError(t, db.ClearFolderHistory(context.Background(), "INBOX"))
+
+	var bodies int
+	require.NoError(t, db.conn.QueryRow(`SELECT COUNT(*) FROM message_bodies`).Scan(&bodies))
+	assert.Zero(t, bodies)
+}
+
+func TestVacuum(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	seedMessages(t, db, "INBOX", 50, time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC), 4096)
+	_, err := db.PruneMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 1})
+	require.NoError(t, err)
+
+	require.NoError(t, db.Vacuum(context.Background()))
+
+	var mode, freePages int
+	require.NoError(t, db.conn.QueryRow(`PRAGMA auto_vacuum`).Scan(&mode))
+	assert.Equal(t, 2, mode, "new databases use incremental auto_vacuum")
+	require.NoError(t, db.conn.QueryRow(`PRAGMA freelist_count`).Scan(&freePages))
+	assert.Zero(t, freePages)
+}
+
+func TestRetentionPolicyApply(t *testing.T) {
+	now := time.Now()
+	messages := []StoredMessage{
+		{ProcessedMessage: ProcessedMessage{UID: 3, Date: now}, TextBody: "12345"},
+		{ProcessedMessage: ProcessedMessage{UID: 2, Date: now.Add(-time.Hour)}, TextBody: "12345"},
+		{ProcessedMessage: ProcessedMessage{UID: 1, Date: now.Add(-48 * time.Hour)}},
+	}
+
+	assert.Len(t, RetentionPolicy{}.Apply(messages), 3)
+	assert.Len(t, RetentionPolicy{MaxItems: 2}.Apply(messages), 2)
+	assert.Len(t, RetentionPolicy{MaxAge: 24 * time.Hour}.Apply(messages), 2)
+
+	kept := RetentionPolicy{MaxBytes: 7}.Apply(messages)
+	require.Len(t, kept, 2)
+	assert.Equal(t, uint32(3), kept[0].UID)
+	assert.Equal(t, uint32(1), kept[1].UID, "smaller older messages still fit")
+}
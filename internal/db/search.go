@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SearchQuery selects stored messages by full-text search
+type SearchQuery struct {
+	// Text holds the words to look for; every word must appear in the subject, sender or body
+	Text string
+	// Folders restricts the search; empty searches every folder
+	Folders []string
+	// Limit caps the number of results; zero means no limit
+	Limit int
+}
+
+// SearchMessages returns the messages matching query, newest first
+func (db *DB) SearchMessages(ctx context.Context, query SearchQuery) ([]StoredMessage, error) {
+	match := ftsQuery(query.Text)
+	if match == "" {
+		return nil, nil
+	}
+
+	sqlQuery := `
+	SELECT p.id, p.date
+	FROM message_search s
+	JOIN processed_messages p ON p.id = s.rowid
+	WHERE message_search MATCH ?
+	`
+	args := []any{match}
+	if len(query.Folders) > 0 {
+		sqlQuery += ` AND p.folder IN (` + placeholders(len(query.Folders)) + `)`
+		for _, folder := range query.Folders {
+			args = append(args, folder)
+		}
+	}
+
+	rows, err := db.conn.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %v", err)
+	}
+	defer rows.Close()
+
+	var matches []retentionRow
+	for rows.Next() {
+		var row retentionRow
+		var date sql.NullTime
+		if err := rows.Scan(&row.id, &date); err != nil {
+			return nil, fmt.Errorf("failed to search messages: %v", err)
+		}
+		row.date = date.Time
+		matches = append(matches, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search messages: %v", err)
+	}
+
+	sortNewestFirst(matches)
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]any, 0, len(matches))
+	for _, row := range matches {
+		ids = append(ids, row.id)
+	}
+
+	messages, err := db.storedMessages(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %v", err)
+	}
+	return messages, nil
+}
+
+// ftsQuery turns free text into an FTS5 query matching every word. Each word is quoted
+// so punctuation and FTS5 operators in user input are searched for literally.
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFTSQuery(t *testing.T) {
+	assert.Equal(t, `"disk" "full"`, ftsQuery("disk  full"))
+	assert.Equal(t, `"db-01" "NOT" "say""hi"""`, ftsQuery(`db-01 NOT say"hi"`))
+	assert.Empty(t, ftsQuery(" \t"))
+}
+
+func TestSearchHandlesOperatorsLiterally(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, db.MarkMessageProcessed(context.Background(), "INBOX", 1, "Backup (nightly) OR restore", "ops@example.com", date))
+
+	for _, text := range []string{"(nightly)", "OR", "backup*", `"restore`, "-"} {
+		_, err := db.SearchMessages(context.Background(), SearchQuery{Text: text})
+		assert.NoError(t, err, "query %q", text)
+	}
+
+	results, err := db.SearchMessages(context.Background(), SearchQuery{Text: "(nightly)"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestSearchIndexFollowsReprocessing(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, db.MarkMessageProcessed(context.Background(), "INBOX", 1, "Original subject", "a@example.com", date))
+	require.NoError(t, db.StoreMessageBody(context.Background(), "INBOX", 1, "first body", ""))
+
+	// Marking again replaces the row and must not leave the old document behind
+	require.NoError(t, db.MarkMessageProcessed(context.Background(), "INBOX", 1, "Changed subject", "a@example.com", date))
+	require.NoError(t, db.StoreMessageBody(context.Background(), "INBOX", 1, "second body", ""))
+
+	results, err := db.SearchMessages(context.Background(), SearchQuery{Text: "original"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = db.SearchMessages(context.Background(), SearchQuery{Text: "changed second"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	var documents int
+	require.NoError(t, db.conn.QueryRow(`SELECT COUNT(*) FROM message_search`).Scan(&documents))
+	assert.Equal(t, 1, documents)
+
+	pruned, err := db.PruneMessages(context.Background(), "INBOX", RetentionPolicy{MaxAge: time.Hour})
+	require.NoError(t, err)
+	assert.Zero(t, pruned, "the newest message is kept as the watermark")
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FolderState records the outcome of the most recent processing run for a folder
+type FolderState struct {
+	Folder        string
+	FeedName      string
+	LastSyncAt    time.Time
+	LastSuccessAt time.Time // zero if the folder has never synced successfully
+	LastError     string
+	Backlog       int // messages found on the server that could not be processed yet
+	ItemCount     int
+}
+
+// UpdateFolderState stores state for its folder. A zero LastSuccessAt keeps the
+// previously recorded success time so failed runs don't erase it.
+func (db *DB) UpdateFolderState(ctx context.Context, state FolderState) error {
+	query := `
+	INSERT INTO folder_state (folder, feed_name, last_sync_at, last_success_at, last_error, backlog, item_count)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(folder) DO UPDATE SET
+		feed_name = excluded.feed_name,
+		last_sync_at = excluded.last_sync_at,
+		last_success_at = COALESCE(excluded.last_success_at, folder_state.last_success_at),
+		last_error = excluded.last_error,
+		backlog = excluded.backlog,
+		item_count = excluded.item_count
+	`
+
+	var lastSuccess any
+	if !state.LastSuccessAt.IsZero() {
+		lastSuccess = state.LastSuccessAt.UTC()
+	}
+
+	err := db.retryOnBusy(func() error {
+		_, err := db.conn.ExecContext(ctx, query, state.Folder, state.FeedName, state.LastSyncAt.UTC(), lastSuccess,
+			state.LastError, state.Backlog, state.ItemCount)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update folder state: %v", err)
+	}
+
+	return nil
+}
+
+// GetFolderStates returns the recorded state of every folder, ordered by folder
+func (db *DB) GetFolderStates(ctx context.Context) ([]FolderState, error) {
+	query := `
+	SELECT folder, feed_name, last_sync_at, last_success_at, last_error, backlog, item_count
+	FROM folder_state
+	ORDER BY folder
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder states: %v", err)
+	}
+	defer rows.Close()
+
+	var states []FolderState
+	for rows.Next() {
+		var state FolderState
+		var feedName, lastError sql.NullString
+		var lastSync, lastSuccess sql.NullTime
+		if err := rows.Scan(&state.Folder, &feedName, &lastSync, &lastSuccess, &lastError, &state.Backlog, &state.ItemCount); err != nil {
+			return nil, fmt.Errorf("failed to scan folder state: %v", err)
+		}
+		state.FeedName = feedName.String
+		state.LastError = lastError.String
+		state.LastSyncAt = lastSync.Time
+		state.LastSuccessAt = lastSuccess.Time
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// Ping verifies the database is reachable and can execute a query
+func (db *DB) Ping(ctx context.Context) error {
+	var one int
+	if err := db.conn.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+		return fmt.Errorf("database ping failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateFolderState(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	firstRun := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	err := db.UpdateFolderState(context.Background(), FolderState{
+		Folder:        "INBOX",
+		FeedName:      "inbox",
+		LastSyncAt:    firstRun,
+		LastSuccessAt: firstRun,
+		ItemCount:     10,
+	})
+	require.NoError(t, err)
+
+	secondRun := firstRun.Add(time.Hour)
+	err = db.UpdateFolderState(context.Background(), FolderState{
+		Folder:     "INBOX",
+		FeedName:   "inbox",
+		LastSyncAt: secondRun,
+		LastError:  "failed to login",
+		Backlog:    2,
+		ItemCount:  10,
+	})
+	require.NoError(t, err)
+
+	states, err := db.GetFolderStates(context.Background())
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+
+	state := states[0]
+	assert.Equal(t, "INBOX", state.Folder)
+	assert.Equal(t, "inbox", state.FeedName)
+	assert.True(t, secondRun.Equal(state.LastSyncAt))
+	assert.True(t, firstRun.Equal(state.LastSuccessAt), "failed run must not clear the last success time")
+	assert.Equal(t, "failed to login", state.LastError)
+	assert.Equal(t, 2, state.Backlog)
+	assert.Equal(t, 10, state.ItemCount)
+}
+
+func TestGetFolderStatesEmpty(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	states, err := db.GetFolderStates(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, states)
+}
+
+func TestPing(t *testing.T) {
+	db := setupTestDB(t)
+
+	assert.NoError(t, db.Ping(context.Background()))
+
+	require.NoError(t, db.Close())
+	assert.Error(t, db.Ping(context.Background()))
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Supported values for the database driver setting
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Store is the persistence API used by the processor, server and CLI. DB (SQLite) and
+// PostgresDB implement it; both must pass the conformance suite in store_test.go.
+type Store interface {
+	// Processed messages
+	IsMessageProcessed(ctx context.Context, folder string, uid uint32) (bool, error)
+	MarkMessageProcessed(ctx context.Context, folder string, uid uint32, subject, from string, date time.Time) error
+	FilterNewUIDs(ctx context.Context, folder string, uids []uint32) ([]uint32, error)
+	MarkMessagesProcessed(ctx context.Context, folder string, messages []NewMessage) error
+	GetProcessedMessages(ctx context.Context, folder string, limit int) ([]ProcessedMessage, error)
+	CountProcessedMessages(ctx context.Context, folder string) (int, error)
+	ClearFolderHistory(ctx context.Context, folder string) error
+	GetLastProcessedDate(ctx context.Context, folder string) (time.Time, error)
+
+	// Message bodies and retention
+	StoreMessageBody(ctx context.Context, folder string, uid uint32, textBody, htmlBody string) error
+	GetFeedMessages(ctx context.Context, folder string, policy RetentionPolicy) ([]StoredMessage, error)
+	PruneMessages(ctx context.Context, folder string, policy RetentionPolicy) (int, error)
+	Vacuum(ctx context.Context) error
+
+	// Full-text search
+	SearchMessages(ctx context.Context, query SearchQuery) ([]StoredMessage, error)
+
+	// Live streams
+	GetMessagesSince(ctx context.Context, folders []string, afterID int64, limit int) ([]StoredMessage, error)
+	LatestMessageID(ctx context.Context, folders []string) (int64, error)
+
+	// Folder state and health
+	UpdateFolderState(ctx context.Context, state FolderState) error
+	GetFolderStates(ctx context.Context) ([]FolderState, error)
+	Ping(ctx context.Context) error
+
+	// Feed access tokens
+	CreateFeedToken(ctx context.Context, feed, description string) (*FeedToken, string, error)
+	RevokeFeedToken(ctx context.Context, id int64) error
+	ListFeedTokens(ctx context.Context, feed string) ([]FeedToken, error)
+	ValidateFeedToken(ctx context.Context, feed, token string) (bool, error)
+
+	// WebSub subscriptions
+	SaveSubscription(ctx context.Context, sub Subscription) error
+	DeleteSubscription(ctx context.Context, topic, callback string) error
+	GetSubscriptions(ctx context.Context, topic string) ([]Subscription, error)
+
+	// Schema management
+	Migrate(ctx context.Context) error
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	SchemaVersion(ctx context.Context) (int, error)
+
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*PostgresDB)(nil)
+)
+
+// NewStore opens the store for driver and applies pending migrations. For SQLite dsn
+// is the database file path; for PostgreSQL it is a connection string or URL.
+func NewStore(driver, dsn string) (Store, error) {
+	switch driver {
+	case "", DriverSQLite:
+		return New(dsn)
+	case DriverPostgres:
+		return NewPostgres(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// OpenStore opens the store for driver without migrating it
+func OpenStore(driver, dsn string) (Store, error) {
+	switch driver {
+	case "", DriverSQLite:
+		return Open(dsn)
+	case DriverPostgres:
+		return OpenPostgres(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
@@ -0,0 +1,372 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresDSNEnv names the environment variable with a PostgreSQL connection string for
+// the conformance suite. The database it points at is wiped, so use a throwaway one.
+const postgresDSNEnv = "EMAILRSS_TEST_POSTGRES_DSN"
+
+func TestSQLiteStoreConformance(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T) Store {
+		store, err := NewStore(DriverSQLite, filepath.Join(t.TempDir(), "conformance.db"))
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("set %s to run the PostgreSQL conformance tests", postgresDSNEnv)
+	}
+
+	runStoreConformance(t, func(t *testing.T) Store {
+		reset, err := OpenPostgres(dsn)
+		require.NoError(t, err)
+		_, err = reset.conn.Exec(`DROP TABLE IF EXISTS message_search, processed_messages, message_bodies, pruned_messages, feed_tokens, folder_state, schema_version`)
+		require.NoError(t, err)
+		require.NoError(t, reset.Close())
+
+		store, err := NewStore(DriverPostgres, dsn)
+		require.NoError(t, err)
+		return store
+	})
+}
+
+// runStoreConformance checks the behaviour every Store implementation must share
+func runStoreConformance(t *testing.T, newStore func(t *testing.T) Store) {
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+
+	t.Run("processed messages", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		processed, err := store.IsMessageProcessed(context.Background(), "INBOX", 1)
+		require.NoError(t, err)
+		assert.False(t, processed)
+
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", 1, "First", "a@example.com", date))
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", 2, "Second", "b@example.com", date.Add(time.Hour)))
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", 2, "Second", "b@example.com", date.Add(time.Hour)))
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "Other", 1, "Elsewhere", "c@example.com", date))
+
+		processed, err = store.IsMessageProcessed(context.Background(), "INBOX", 1)
+		require.NoError(t, err)
+		assert.True(t, processed)
+
+		count, err := store.CountProcessedMessages(context.Background(), "INBOX")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count, "marking twice does not duplicate")
+
+		messages, err := store.GetProcessedMessages(context.Background(), "INBOX", 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, "Second", messages[0].Subject)
+		assert.Equal(t, uint32(2), messages[0].UID)
+		assert.Equal(t, "b@example.com", messages[0].From)
+
+		lastDate, err := store.GetLastProcessedDate(context.Background(), "INBOX")
+		require.NoError(t, err)
+		assert.True(t, date.Add(time.Hour).Equal(lastDate))
+
+		lastDate, err = store.GetLastProcessedDate(context.Background(), "Empty")
+		require.NoError(t, err)
+		assert.True(t, lastDate.IsZero())
+
+		require.NoError(t, store.ClearFolderHistory(context.Background(), "INBOX"))
+		count, err = store.CountProcessedMessages(context.Background(), "INBOX")
+		require.NoError(t, err)
+		assert.Zero(t, count)
+
+		count, err = store.CountProcessedMessages(context.Background(), "Other")
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("batched writes", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", 2, "Seen", "a@example.com", date))
+
+		fresh, err := store.FilterNewUIDs(context.Background(), "INBOX", []uint32{3, 2, 1})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{3, 1}, fresh, "order is preserved")
+
+		require.NoError(t, store.MarkMessagesProcessed(context.Background(), "INBOX", []NewMessage{
+			{UID: 1, Subject: "One", From: "a@example.com", Date: date, TextBody: "first"},
+			{UID: 3, Subject: "Three", From: "b@example.com", Date: date.Add(time.Hour), HTMLBody: "<p>third</p>"},
+		}))
+		require.NoError(t, store.MarkMessagesProcessed(context.Background(), "INBOX", nil))
+
+		fresh, err = store.FilterNewUIDs(context.Background(), "INBOX", []uint32{1, 2, 3, 4})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{4}, fresh)
+
+		fresh, err = store.FilterNewUIDs(context.Background(), "Other", []uint32{1})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1}, fresh, "uids are per folder")
+
+		messages, err := store.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{})
+		require.NoError(t, err)
+		require.Len(t, messages, 3)
+		assert.Equal(t, "Three", messages[0].Subject)
+		assert.Equal(t, "<p>third</p>", messages[0].HTMLBody)
+
+		results, err := store.SearchMessages(context.Background(), SearchQuery{Text: "first"})
+		require.NoError(t, err)
+		assert.Len(t, results, 1, "batched messages are searchable")
+	})
+
+	t.Run("bodies and retention", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		for uid := uint32(1); uid <= 5; uid++ {
+			msgDate := date.Add(time.Duration(uid) * 24 * time.Hour)
+			require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", uid, "Message", "a@example.com", msgDate))
+			require.NoError(t, store.StoreMessageBody(context.Background(), "INBOX", uid, strings.Repeat("t", 10), "<p>html</p>"))
+		}
+
+		messages, err := store.GetFeedMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 3})
+		require.NoError(t, err)
+		require.Len(t, messages, 3)
+		assert.Equal(t, uint32(5), messages[0].UID)
+		assert.Equal(t, uint32(3), messages[2].UID)
+		assert.Equal(t, "<p>html</p>", messages[0].HTMLBody)
+
+		pruned, err := store.PruneMessages(context.Background(), "INBOX", RetentionPolicy{MaxItems: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, pruned)
+
+		count, err := store.CountProcessedMessages(context.Background(), "INBOX")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		// Pruned messages are still known, so they are not fetched and published again
+		fresh, err := store.FilterNewUIDs(context.Background(), "INBOX", []uint32{1, 2, 3, 4, 5, 6})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{6}, fresh)
+
+		processed, err := store.IsMessageProcessed(context.Background(), "INBOX", 1)
+		require.NoError(t, err)
+		assert.True(t, processed)
+
+		require.NoError(t, store.ClearFolderHistory(context.Background(), "INBOX"))
+		fresh, err = store.FilterNewUIDs(context.Background(), "INBOX", []uint32{1, 5})
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{1, 5}, fresh, "clearing a folder forgets pruned messages too")
+
+		require.NoError(t, store.Vacuum(context.Background()))
+	})
+
+	t.Run("search", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", 1, "Disk alert on db-01", "monitor@example.com", date))
+		require.NoError(t, store.StoreMessageBody(context.Background(), "INBOX", 1, "Filesystem /var is 95% full", ""))
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "INBOX", 2, "Weekly report", "boss@example.com", date.Add(time.Hour)))
+		require.NoError(t, store.StoreMessageBody(context.Background(), "INBOX", 2, "", "<p>All systems normal, no alert raised</p>"))
+		require.NoError(t, store.MarkMessageProcessed(context.Background(), "Alerts", 3, "CPU alert", "monitor@example.com", date.Add(2*time.Hour)))
+
+		results, err := store.SearchMessages(context.Background(), SearchQuery{Text: "alert"})
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		assert.Equal(t, uint32(3), results[0].UID, "newest first")
+		assert.Equal(t, uint32(1), results[2].UID)
+		assert.Equal(t, "Filesystem /var is 95% full", results[2].TextBody)
+
+		results, err = store.SearchMessages(context.Background(), SearchQuery{Text: "filesystem full"})
+		require.NoError(t, err)
+		require.Len(t, results, 1, "body text is indexed and every word must match")
+		assert.Equal(t, uint32(1), results[0].UID)
+
+		results, err = store.SearchMessages(context.Background(), SearchQuery{Text: "boss@example.com"})
+		require.NoError(t, err)
+		require.Len(t, results, 1, "senders are indexed")
+		assert.Equal(t, uint32(2), results[0].UID)
+
+		results, err = store.SearchMessages(context.Background(), SearchQuery{Text: "alert", Folders: []string{"INBOX"}, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, uint32(2), results[0].UID)
+
+		results, err = store.SearchMessages(context.Background(), SearchQuery{Text: "  "})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+
+		require.NoError(t, store.ClearFolderHistory(context.Background(), "Alerts"))
+		results, err = store.SearchMessages(context.Background(), SearchQuery{Text: "cpu"})
+		require.NoError(t, err)
+		assert.Empty(t, results, "deleted messages leave the index")
+	})
+
+	t.Run("messages since", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		latest, err := store.LatestMessageID(context.Background(), []string{"INBOX"})
+		require.NoError(t, err)
+		assert.Zero(t, latest)
+
+		require.NoError(t, store.MarkMessagesProcessed(context.Background(), "INBOX", []NewMessage{
+			{UID: 10, Subject: "Newer", From: "a@example.com", Date: date.Add(time.Hour), TextBody: "first stored"},
+			{UID: 5, Subject: "Older", From: "a@example.com", Date: date},
+		}))
+		require.NoError(t, store.MarkMessagesProcessed(context.Background(), "Other", []NewMessage{
+			{UID: 1, Subject: "Elsewhere", From: "b@example.com", Date: date},
+		}))
+		require.NoError(t, store.MarkMessagesProcessed(context.Background(), "INBOX", []NewMessage{
+			{UID: 11, Subject: "Last", From: "a@example.com", Date: date},
+		}))
+
+		messages, err := store.GetMessagesSince(context.Background(), []string{"INBOX"}, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 3)
+		assert.Equal(t, []string{"Newer", "Older", "Last"}, []string{messages[0].Subject, messages[1].Subject, messages[2].Subject},
+			"messages come in the order they were stored")
+		assert.Equal(t, "first stored", messages[0].TextBody)
+
+		resumed, err := store.GetMessagesSince(context.Background(), []string{"INBOX"}, messages[0].ID, 1)
+		require.NoError(t, err)
+		require.Len(t, resumed, 1)
+		assert.Equal(t, "Older", resumed[0].Subject)
+
+		latest, err = store.LatestMessageID(context.Background(), []string{"INBOX"})
+		require.NoError(t, err)
+		assert.Equal(t, messages[2].ID, latest)
+
+		messages, err = store.GetMessagesSince(context.Background(), nil, 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+	})
+
+	t.Run("folder state", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		require.NoError(t, store.UpdateFolderState(context.Background(), FolderState{
+			Folder: "INBOX", FeedName: "inbox", LastSyncAt: date, LastSuccessAt: date, ItemCount: 3,
+		}))
+		require.NoError(t, store.UpdateFolderState(context.Background(), FolderState{
+			Folder: "INBOX", FeedName: "inbox", LastSyncAt: date.Add(time.Hour), LastError: "boom", Backlog: 1, ItemCount: 3,
+		}))
+
+		states, err := store.GetFolderStates(context.Background())
+		require.NoError(t, err)
+		require.Len(t, states, 1)
+		assert.Equal(t, "boom", states[0].LastError)
+		assert.Equal(t, 1, states[0].Backlog)
+		assert.True(t, date.Equal(states[0].LastSuccessAt))
+		assert.True(t, date.Add(time.Hour).Equal(states[0].LastSyncAt))
+
+		assert.NoError(t, store.Ping(context.Background()))
+	})
+
+	t.Run("feed tokens", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		token, secret, err := store.CreateFeedToken(context.Background(), "inbox", "reader")
+		require.NoError(t, err)
+		assert.NotZero(t, token.ID)
+
+		valid, err := store.ValidateFeedToken(context.Background(), "inbox", secret)
+		require.NoError(t, err)
+		assert.True(t, valid)
+
+		valid, err = store.ValidateFeedToken(context.Background(), "other", secret)
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		require.NoError(t, store.RevokeFeedToken(context.Background(), token.ID))
+		assert.Error(t, store.RevokeFeedToken(context.Background(), token.ID))
+
+		valid, err = store.ValidateFeedToken(context.Background(), "inbox", secret)
+		require.NoError(t, err)
+		assert.False(t, valid)
+
+		tokens, err := store.ListFeedTokens(context.Background(), "")
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		assert.Equal(t, "reader", tokens[0].Description)
+		assert.NotNil(t, tokens[0].RevokedAt)
+	})
+
+	t.Run("websub subscriptions", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		topic := "https://feeds.example.com/feeds/inbox.xml"
+		require.NoError(t, store.SaveSubscription(context.Background(), Subscription{
+			Topic: topic, Callback: "https://reader.example.com/b", ExpiresAt: date,
+		}))
+		require.NoError(t, store.SaveSubscription(context.Background(), Subscription{
+			Topic: topic, Callback: "https://reader.example.com/a", Secret: "old", ExpiresAt: date,
+		}))
+		require.NoError(t, store.SaveSubscription(context.Background(), Subscription{
+			Topic: topic, Callback: "https://reader.example.com/a", Secret: "new", ExpiresAt: date.Add(time.Hour),
+		}))
+
+		subs, err := store.GetSubscriptions(context.Background(), topic)
+		require.NoError(t, err)
+		require.Len(t, subs, 2, "resubscribing renews the subscription")
+		assert.Equal(t, "https://reader.example.com/a", subs[0].Callback)
+		assert.Equal(t, "new", subs[0].Secret)
+		assert.True(t, date.Add(time.Hour).Equal(subs[0].ExpiresAt))
+		assert.True(t, subs[1].Expired(date))
+		assert.False(t, subs[0].Expired(date))
+
+		require.NoError(t, store.DeleteSubscription(context.Background(), topic, "https://reader.example.com/b"))
+		subs, err = store.GetSubscriptions(context.Background(), topic)
+		require.NoError(t, err)
+		assert.Len(t, subs, 1)
+
+		subs, err = store.GetSubscriptions(context.Background(), "https://feeds.example.com/feeds/other.xml")
+		require.NoError(t, err)
+		assert.Empty(t, subs)
+	})
+
+	t.Run("migrations", func(t *testing.T) {
+		store := newStore(t)
+		defer store.Close()
+
+		statuses, err := store.MigrationStatus(context.Background())
+		require.NoError(t, err)
+		require.NotEmpty(t, statuses)
+
+		version, err := store.SchemaVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, statuses[len(statuses)-1].Version, version)
+
+		require.NoError(t, store.Migrate(context.Background()), "migrating an up-to-date store is a no-op")
+	})
+}
+
+func TestRebindPostgres(t *testing.T) {
+	assert.Equal(t, "SELECT * FROM t WHERE a = $1 AND b = $2", rebindPostgres("SELECT * FROM t WHERE a = ? AND b = ?"))
+}
+
+func TestMigrationListsMatch(t *testing.T) {
+	require.Len(t, postgresMigrations, len(sqliteMigrations))
+	for i := range sqliteMigrations {
+		assert.Equal(t, sqliteMigrations[i].version, postgresMigrations[i].version)
+		assert.Equal(t, sqliteMigrations[i].description, postgresMigrations[i].description)
+	}
+}
+
+func TestUnsupportedDriver(t *testing.T) {
+	_, err := NewStore("mysql", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetMessagesSince returns up to limit messages of folders stored after the message with id
+// afterID, in the order they were stored. Message IDs increase as messages are recorded, so
+// callers can resume from the last ID they saw.
+func (db *DB) GetMessagesSince(ctx context.Context, folders []string, afterID int64, limit int) ([]StoredMessage, error) {
+	if len(folders) == 0 {
+		return nil, nil
+	}
+
+	query := `
+	SELECT p.id, p.folder, p.uid, p.subject, p.from_addr, p.date, p.processed_at,
+		COALESCE(b.text_body, ''), COALESCE(b.html_body, '')
+	FROM processed_messages p
+	LEFT JOIN message_bodies b ON b.folder = p.folder AND b.uid = p.uid
+	WHERE p.id > ? AND p.folder IN (` + placeholders(len(folders)) + `)
+	ORDER BY p.id
+	LIMIT ?
+	`
+	args := []any{afterID}
+	for _, folder := range folders {
+		args = append(args, folder)
+	}
+	args = append(args, limit)
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []StoredMessage
+	for rows.Next() {
+		var msg StoredMessage
+		err := rows.Scan(&msg.ID, &msg.Folder, &msg.UID, &msg.Subject, &msg.From, &msg.Date, &msg.ProcessedAt,
+			&msg.TextBody, &msg.HTMLBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// LatestMessageID returns the ID of the message of folders stored last, or 0 if there is none
+func (db *DB) LatestMessageID(ctx context.Context, folders []string) (int64, error) {
+	if len(folders) == 0 {
+		return 0, nil
+	}
+
+	args := make([]any, 0, len(folders))
+	for _, folder := range folders {
+		args = append(args, folder)
+	}
+
+	var id int64
+	query := `SELECT COALESCE(MAX(id), 0) FROM processed_messages WHERE folder IN (` + placeholders(len(folders)) + `)`
+	if err := db.conn.QueryRowContext(ctx, query, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get latest message: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Subscription is a WebSub subscriber of a feed, kept until its lease expires
+type Subscription struct {
+	Topic     string
+	Callback  string
+	Secret    string // signs content distribution requests when set
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the subscription's lease has ended at now
+func (s Subscription) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// SaveSubscription stores sub, renewing the lease and secret of an existing subscription
+// of the same callback to the same topic
+func (db *DB) SaveSubscription(ctx context.Context, sub Subscription) error {
+	query := `
+	INSERT INTO websub_subscriptions (topic, callback, secret, expires_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(topic, callback) DO UPDATE SET
+		secret = excluded.secret,
+		expires_at = excluded.expires_at
+	`
+
+	err := db.retryOnBusy(func() error {
+		_, err := db.conn.ExecContext(ctx, query, sub.Topic, sub.Callback, sub.Secret, sub.ExpiresAt.UTC())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save subscription: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteSubscription removes callback's subscription to topic, if any
+func (db *DB) DeleteSubscription(ctx context.Context, topic, callback string) error {
+	err := db.retryOnBusy(func() error {
+		_, err := db.conn.ExecContext(ctx, `DELETE FROM websub_subscriptions WHERE topic = ? AND callback = ?`, topic, callback)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %v", err)
+	}
+
+	return nil
+}
+
+// GetSubscriptions returns the subscriptions to topic, expired ones included, ordered by callback
+func (db *DB) GetSubscriptions(ctx context.Context, topic string) ([]Subscription, error) {
+	query := `
+	SELECT topic, callback, secret, expires_at
+	FROM websub_subscriptions
+	WHERE topic = ?
+	ORDER BY callback
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscriptions: %v", err)
+	}
+	defer rows.Close()
+
+	return scanSubscriptions(rows)
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]Subscription, error) {
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		var secret sql.NullString
+		if err := rows.Scan(&sub.Topic, &sub.Callback, &secret, &sub.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %v", err)
+		}
+		sub.Secret = secret.String
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// FeedToken is a secret that grants read access to a single feed
+type FeedToken struct {
+	ID          int64
+	Feed        string
+	Description string
+	CreatedAt   time.Time
+	RevokedAt   *time.Time
+}
+
+// hashToken returns the hex-encoded SHA-256 of a token; only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateFeedToken mints a new random token for feed and returns its record along
+// with the plaintext token, which is not recoverable afterwards
+func (db *DB) CreateFeedToken(ctx context.Context, feed, description string) (*FeedToken, string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	query := `INSERT INTO feed_tokens (feed, token_hash, description) VALUES (?, ?, ?)`
+
+	var id int64
+	err := db.retryOnBusy(func() error {
+		result, err := db.conn.ExecContext(ctx, query, feed, hashToken(token), description)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create feed token: %v", err)
+	}
+
+	return &FeedToken{
+		ID:          id,
+		Feed:        feed,
+		Description: description,
+		CreatedAt:   time.Now(),
+	}, token, nil
+}
+
+// RevokeFeedToken marks a token as revoked so it no longer grants access
+func (db *DB) RevokeFeedToken(ctx context.Context, id int64) error {
+	query := `UPDATE feed_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL`
+
+	var affected int64
+	err := db.retryOnBusy(func() error {
+		result, err := db.conn.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+		affected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke feed token: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("no active token with id %d", id)
+	}
+
+	return nil
+}
+
+// ListFeedTokens returns all tokens, optionally restricted to a single feed
+func (db *DB) ListFeedTokens(ctx context.Context, feed string) ([]FeedToken, error) {
+	query := `
+	SELECT id, feed, description, created_at, revoked_at
+	FROM feed_tokens
+	WHERE ? = '' OR feed = ?
+	ORDER BY id
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, feed, feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feed tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []FeedToken
+	for rows.Next() {
+		var token FeedToken
+		var description sql.NullString
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Feed, &description, &token.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feed token: %v", err)
+		}
+		token.Description = description.String
+		if revokedAt.Valid {
+			token.RevokedAt = &revokedAt.Time
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// ValidateFeedToken reports whether token is an active token for feed
+func (db *DB) ValidateFeedToken(ctx context.Context, feed, token string) (bool, error) {
+	query := `SELECT COUNT(*) FROM feed_tokens WHERE feed = ? AND token_hash = ? AND revoked_at IS NULL`
+
+	var count int
+	err := db.retryOnBusy(func() error {
+		return db.conn.QueryRowContext(ctx, query, feed, hashToken(token)).Scan(&count)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to validate feed token: %v", err)
+	}
+
+	return count > 0, nil
+}
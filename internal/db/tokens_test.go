@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndValidateFeedToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	token, secret, err := db.CreateFeedToken(context.Background(), "inbox", "phone reader")
+	require.NoError(t, err)
+	assert.NotZero(t, token.ID)
+	assert.Equal(t, "inbox", token.Feed)
+	assert.Len(t, secret, 48)
+
+	valid, err := db.ValidateFeedToken(context.Background(), "inbox", secret)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	valid, err = db.ValidateFeedToken(context.Background(), "work", secret)
+	assert.NoError(t, err)
+	assert.False(t, valid, "token must only grant access to its own feed")
+
+	valid, err = db.ValidateFeedToken(context.Background(), "inbox", "not-a-token")
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	var storedHash string
+	err = db.conn.QueryRow(`SELECT token_hash FROM feed_tokens WHERE id = ?`, token.ID).Scan(&storedHash)
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, storedHash, "plaintext token must not be stored")
+}
+
+func TestRevokeFeedToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	token, secret, err := db.CreateFeedToken(context.Background(), "inbox", "")
+	require.NoError(t, err)
+
+	err = db.RevokeFeedToken(context.Background(), token.ID)
+	assert.NoError(t, err)
+
+	valid, err := db.ValidateFeedToken(context.Background(), "inbox", secret)
+	assert.NoError(t, err)
+	assert.False(t, valid)
+
+	err = db.RevokeFeedToken(context.Background(), token.ID)
+	assert.Error(t, err, "revoking twice should fail")
+
+	err = db.RevokeFeedToken(context.Background(), 9999)
+	assert.Error(t, err)
+}
+
+func TestListFeedTokens(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	_, _, err := db.CreateFeedToken(context.Background(), "inbox", "first")
+	require.NoError(t, err)
+	revoked, _, err := db.CreateFeedToken(context.Background(), "inbox", "second")
+	require.NoError(t, err)
+	_, _, err = db.CreateFeedToken(context.Background(), "work", "third")
+	require.NoError(t, err)
+	require.NoError(t, db.RevokeFeedToken(context.Background(), revoked.ID))
+
+	tokens, err := db.ListFeedTokens(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 3)
+
+	tokens, err = db.ListFeedTokens(context.Background(), "inbox")
+	assert.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "first", tokens[0].Description)
+	assert.Nil(t, tokens[0].RevokedAt)
+	assert.NotNil(t, tokens[1].RevokedAt)
+}
@@ -0,0 +1,162 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+)
+
+// Actions are applied to messages on the server once they have been published
+type Actions struct {
+	MarkSeen    bool          // set \Seen
+	Keywords    []string      // custom keywords to add, e.g. $EmailRSS
+	MoveTo      string        // mailbox to move messages into
+	DeleteAfter time.Duration // delete processed messages older than this
+}
+
+// Enabled reports whether processed messages need any flag or move action
+func (a Actions) Enabled() bool {
+	return a.MarkSeen || len(a.Keywords) > 0 || a.MoveTo != ""
+}
+
+// flags returns the flags to add to processed messages
+func (a Actions) flags() []imap.Flag {
+	var flags []imap.Flag
+	if a.MarkSeen {
+		flags = append(flags, imap.FlagSeen)
+	}
+	for _, keyword := range a.Keywords {
+		flags = append(flags, imap.Flag(keyword))
+	}
+	return flags
+}
+
+// ApplyActions flags the given messages in folder and then moves them if configured.
+// Servers without MOVE get COPY, STORE \Deleted and EXPUNGE instead.
+func (c *Client) ApplyActions(ctx context.Context, folder string, uids []uint32, actions Actions) error {
+	if len(uids) == 0 || !actions.Enabled() {
+		return nil
+	}
+	log := logging.FromContext(ctx, logger)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.do(ctx, func(client *imapclient.Client) error {
+		if err := selectFolder(client, folder); err != nil {
+			return err
+		}
+
+		uidSet := uidSetOf(uids)
+		if flags := actions.flags(); len(flags) > 0 {
+			store := &imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: flags}
+			if err := client.Store(uidSet, store, nil).Close(); err != nil {
+				metrics.IMAPFailures.WithLabelValues("store").Inc()
+				return fmt.Errorf("failed to flag messages in %s: %v", folder, err)
+			}
+			log.Debug("Flagged messages", "count", len(uids), "flags", flags)
+		}
+
+		if actions.MoveTo != "" {
+			if _, err := client.Move(uidSet, actions.MoveTo).Wait(); err != nil {
+				metrics.IMAPFailures.WithLabelValues("move").Inc()
+				return fmt.Errorf("failed to move messages from %s to %s: %v", folder, actions.MoveTo, err)
+			}
+			log.Debug("Moved messages", "count", len(uids), "to", actions.MoveTo)
+		}
+
+		return nil
+	})
+}
+
+// MessagesBefore returns the UIDs of messages in folder whose internal date is before the given day
+func (c *Client) MessagesBefore(ctx context.Context, folder string, before time.Time) ([]uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var uids []uint32
+	err := c.do(ctx, func(client *imapclient.Client) error {
+		if err := selectFolder(client, folder); err != nil {
+			return err
+		}
+
+		data, err := client.UIDSearch(&imap.SearchCriteria{Before: before}, nil).Wait()
+		if err != nil {
+			metrics.IMAPFailures.WithLabelValues("search").Inc()
+			return fmt.Errorf("failed to search messages: %v", err)
+		}
+
+		uids = nil
+		for _, uid := range data.AllUIDs() {
+			uids = append(uids, uint32(uid))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// DeleteMessages permanently removes the given messages from folder. Only those messages
+// are expunged when the server supports UIDPLUS; otherwise every message already marked
+// \Deleted in the folder goes with them.
+func (c *Client) DeleteMessages(ctx context.Context, folder string, uids []uint32) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	log := logging.FromContext(ctx, logger)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.do(ctx, func(client *imapclient.Client) error {
+		if err := selectFolder(client, folder); err != nil {
+			return err
+		}
+
+		uidSet := uidSetOf(uids)
+		store := &imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagDeleted}}
+		if err := client.Store(uidSet, store, nil).Close(); err != nil {
+			metrics.IMAPFailures.WithLabelValues("store").Inc()
+			return fmt.Errorf("failed to mark messages deleted in %s: %v", folder, err)
+		}
+
+		var err error
+		if client.Caps().Has(imap.CapUIDPlus) {
+			err = client.UIDExpunge(uidSet).Close()
+		} else {
+			err = client.Expunge().Close()
+		}
+		if err != nil {
+			metrics.IMAPFailures.WithLabelValues("expunge").Inc()
+			return fmt.Errorf("failed to expunge messages in %s: %v", folder, err)
+		}
+
+		log.Debug("Deleted messages", "count", len(uids))
+		return nil
+	})
+}
+
+// selectFolder opens folder read-write. Callers must hold c.mu.
+func selectFolder(client *imapclient.Client, folder string) error {
+	if _, err := client.Select(folder, nil).Wait(); err != nil {
+		metrics.IMAPFailures.WithLabelValues("select").Inc()
+		return fmt.Errorf("failed to select folder %s: %v", folder, err)
+	}
+	return nil
+}
+
+func uidSetOf(uids []uint32) imap.UIDSet {
+	var set imap.UIDSet
+	for _, uid := range uids {
+		set.AddNum(imap.UID(uid))
+	}
+	return set
+}
@@ -1,27 +1,30 @@
 package imap
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
-	"io"
-	"log"
-	"mime"
-	"mime/multipart"
-	"net"
-	"net/mail"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
+
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
 )
 
+var logger = logging.For("imap")
+
 type Client struct {
+	mu          sync.Mutex // serialises commands that depend on the selected folder
+	connMu      sync.Mutex // guards client and closed
 	client      *imapclient.Client
+	closed      bool
+	breaker     *breaker
 	config      IMAPConfig
 	debugConfig DebugConfig
 }
@@ -33,6 +36,13 @@ type IMAPConfig struct {
 	Password string
 	TLS      bool
 	Timeout  int
+	// DedupKeyword, when set, excludes messages carrying this keyword from searches
+	DedupKeyword string
+	// MaxPartBytes, when above zero, fetches only this many bytes of each text part
+	MaxPartBytes int
+	// CommandTimeout, when above zero, bounds each operation including its retries
+	CommandTimeout time.Duration
+	Retry          RetryConfig
 }
 
 type DebugConfig struct {
@@ -52,158 +62,199 @@ type Message struct {
 }
 
 func NewClient(config IMAPConfig, debugConfig DebugConfig) (*Client, error) {
-	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
-
-	timeout := time.Duration(config.Timeout) * time.Second
-	if config.Timeout == 0 {
-		timeout = 15 * time.Second
-	}
-
-	var conn net.Conn
-	var err error
-
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(timeout))
-	defer cancel()
-
-	dialer := &net.Dialer{Timeout: timeout}
-
-	if config.TLS {
-		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		})
-	} else {
-		conn, err = dialer.DialContext(ctx, "tcp", addr)
-	}
-
+	client, err := dial(context.Background(), config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to IMAP server: %v", err)
+		return nil, err
 	}
 
-	client := imapclient.New(conn, &imapclient.Options{
-		Dialer: dialer,
-	})
-
-	if err := client.Login(config.Username, config.Password).Wait(); err != nil {
-		client.Close()
-		return nil, fmt.Errorf("failed to login: %v", err)
-	}
-
-	log.Printf("Connected to IMAP server %s as %s", config.Host, config.Username)
+	logger.Info("Connected to IMAP server", "host", config.Host)
+	logger.Debug("Logged in to IMAP server", "host", config.Host, "username", config.Username)
 
+	config.Retry = config.Retry.withDefaults()
 	return &Client{
 		client:      client,
+		breaker:     newBreaker(config.Retry.BreakerThreshold, config.Retry.BreakerCooldown),
 		config:      config,
 		debugConfig: debugConfig,
 	}, nil
 }
 
 func (c *Client) Close() error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	c.closed = true
 	if c.client != nil {
 		return c.client.Close()
 	}
 	return nil
 }
 
+// ListFolders returns the names of every selectable folder on the server
 func (c *Client) ListFolders(ctx context.Context) ([]string, error) {
-	mboxes := c.client.List("", "*", nil)
+	var mailboxes []*imap.ListData
+	err := c.do(ctx, func(client *imapclient.Client) error {
+		var err error
+		mailboxes, err = listSelectable(client, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	var folders []string
-	for {
-		mbox := mboxes.Next()
-		if mbox == nil {
-			break
-		}
+	folders := make([]string, 0, len(mailboxes))
+	for _, mbox := range mailboxes {
 		folders = append(folders, mbox.Mailbox)
 	}
 
 	return folders, nil
 }
 
-func (c *Client) GetMessages(ctx context.Context, folder string, since time.Time) ([]Message, error) {
-	_, err := c.client.Select(folder, nil).Wait()
+// listSelectable lists every folder on the server that can be selected
+func listSelectable(client *imapclient.Client, options *imap.ListOptions) ([]*imap.ListData, error) {
+	mailboxes, err := client.List("", "*", options).Collect()
 	if err != nil {
-		return nil, fmt.Errorf("failed to select folder %s: %v", folder, err)
-	}
-
-	criteria := &imap.SearchCriteria{}
-	if !since.IsZero() {
-		log.Printf("Searching for messages since: %v", since)
-		criteria.Since = since
-	} else {
-		log.Printf("Searching for all messages (no since date)")
+		metrics.IMAPFailures.WithLabelValues("list").Inc()
+		return nil, fmt.Errorf("failed to list folders: %v", err)
 	}
 
-	data, err := c.client.Search(criteria, nil).Wait()
-	if err != nil {
-		return nil, fmt.Errorf("failed to search messages: %v", err)
+	selectable := mailboxes[:0]
+	for _, mbox := range mailboxes {
+		if slices.Contains(mbox.Attrs, imap.MailboxAttrNoSelect) || slices.Contains(mbox.Attrs, imap.MailboxAttrNonExistent) {
+			continue
+		}
+		selectable = append(selectable, mbox)
 	}
+	return selectable, nil
+}
 
-	seqNums := data.AllSeqNums()
-	log.Printf("Found %d messages in folder %s", len(seqNums), folder)
+func (c *Client) GetMessages(ctx context.Context, folder string, since time.Time) ([]Message, error) {
+	log := logging.FromContext(ctx, logger)
 
-	if len(seqNums) == 0 {
-		return nil, nil
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	seqSet := imap.SeqSetNum(seqNums...)
-	fetchOptions := &imap.FetchOptions{
-		Flags:    true,
-		Envelope: true,
-		UID:      true,
-	}
+	var messages []Message
+	err := c.do(ctx, func(client *imapclient.Client) error {
+		messages = nil
 
-	msgs := c.client.Fetch(seqSet, fetchOptions)
+		selected, err := client.Select(folder, nil).Wait()
+		if err != nil {
+			metrics.IMAPFailures.WithLabelValues("select").Inc()
+			return fmt.Errorf("failed to select folder %s: %v", folder, err)
+		}
 
-	var messages []Message
-	for {
-		msg := msgs.Next()
-		if msg == nil {
-			break
+		criteria := &imap.SearchCriteria{}
+		if c.config.DedupKeyword != "" {
+			if !allowsKeyword(selected.PermanentFlags, c.config.DedupKeyword) {
+				log.Warn("Folder does not allow the dedup keyword to be stored; relying on the local database", "keyword", c.config.DedupKeyword)
+			}
+			criteria.NotFlag = []imap.Flag{imap.Flag(c.config.DedupKeyword)}
+		}
+		if !since.IsZero() {
+			log.Debug("Searching for messages", "since", since)
+			criteria.Since = since
+		} else {
+			log.Debug("Searching for all messages (no since date)")
 		}
 
-		buffer, err := msg.Collect()
+		data, err := client.Search(criteria, nil).Wait()
 		if err != nil {
-			log.Printf("Failed to collect message: %v", err)
-			continue
+			metrics.IMAPFailures.WithLabelValues("search").Inc()
+			return fmt.Errorf("failed to search messages: %v", err)
 		}
 
-		if buffer.Envelope == nil {
-			log.Printf("Message has no envelope")
-			continue
+		seqNums := data.AllSeqNums()
+		log.Debug("Search complete", "count", len(seqNums))
+
+		if len(seqNums) == 0 {
+			return nil
 		}
 
-		message := Message{
-			ID:      buffer.SeqNum,
-			UID:     uint32(buffer.UID),
-			Subject: buffer.Envelope.Subject,
-			Date:    buffer.Envelope.Date,
+		seqSet := imap.SeqSetNum(seqNums...)
+		fetchOptions := &imap.FetchOptions{
+			Flags:    true,
+			Envelope: true,
+			UID:      true,
 		}
 
-		log.Printf("Message SeqNum=%d, UID=%d, Subject=%s", buffer.SeqNum, buffer.UID, buffer.Envelope.Subject)
+		msgs := client.Fetch(seqSet, fetchOptions)
+
+		for {
+			msg := msgs.Next()
+			if msg == nil {
+				break
+			}
+
+			buffer, err := msg.Collect()
+			if err != nil {
+				log.Warn("Failed to collect message", "error", err)
+				continue
+			}
 
-		if len(buffer.Envelope.From) > 0 {
-			addr := buffer.Envelope.From[0]
-			if addr.Name != "" {
-				message.From = fmt.Sprintf("%s <%s@%s>", addr.Name, addr.Mailbox, addr.Host)
-			} else {
-				message.From = fmt.Sprintf("%s@%s", addr.Mailbox, addr.Host)
+			if buffer.Envelope == nil {
+				log.Warn("Message has no envelope", "seq", buffer.SeqNum)
+				continue
 			}
+
+			log.Debug("Fetched envelope", "seq", buffer.SeqNum, "uid", buffer.UID, "subject", buffer.Envelope.Subject)
+
+			messages = append(messages, messageFromEnvelope(buffer.SeqNum, uint32(buffer.UID), buffer.Envelope))
 		}
 
-		messages = append(messages, message)
+		if err := msgs.Close(); err != nil {
+			metrics.IMAPFailures.WithLabelValues("fetch").Inc()
+			return fmt.Errorf("failed to fetch messages: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf("Successfully processed %d messages", len(messages))
+	metrics.IMAPMessagesFetched.WithLabelValues(folder).Add(float64(len(messages)))
+	log.Debug("Fetched message envelopes", "count", len(messages))
 	return messages, nil
 }
 
+// messageFromEnvelope builds a Message from a fetched envelope
+func messageFromEnvelope(seqNum, uid uint32, envelope *imap.Envelope) Message {
+	message := Message{
+		ID:      seqNum,
+		UID:     uid,
+		Subject: envelope.Subject,
+		Date:    envelope.Date,
+	}
+
+	if len(envelope.From) > 0 {
+		addr := envelope.From[0]
+		if addr.Name != "" {
+			message.From = fmt.Sprintf("%s <%s@%s>", addr.Name, addr.Mailbox, addr.Host)
+		} else {
+			message.From = fmt.Sprintf("%s@%s", addr.Mailbox, addr.Host)
+		}
+	}
+
+	return message
+}
+
+// allowsKeyword reports whether a mailbox with the given permanent flags keeps keyword
+func allowsKeyword(permanent []imap.Flag, keyword string) bool {
+	for _, flag := range permanent {
+		if flag == imap.FlagWildcard || strings.EqualFold(string(flag), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
 type MessageContent struct {
 	TextBody string
 	HTMLBody string
 }
 
-func (c *Client) GetMessageBody(ctx context.Context, uid uint32) (string, error) {
-	content, err := c.GetMessageContent(ctx, uid)
+func (c *Client) GetMessageBody(ctx context.Context, folder string, uid uint32) (string, error) {
+	content, err := c.GetMessageContent(ctx, folder, uid)
 	if err != nil {
 		return "", err
 	}
@@ -215,152 +266,17 @@ func (c *Client) GetMessageBody(ctx context.Context, uid uint32) (string, error)
 	return content.TextBody, nil
 }
 
-func (c *Client) GetMessageContent(ctx context.Context, uid uint32) (*MessageContent, error) {
-	seqSet := imap.UIDSet{}
-	seqSet.AddNum(imap.UID(uid))
-
-	// Fetch both the body structure and various body sections
-	// This code constructs fetchOptions to specify which parts of the email message to fetch from the IMAP server.
-	// - BodySection: a list of body sections to fetch:
-	//   - {Specifier: imap.PartSpecifierText} fetches the text/plain part of the message body.
-	//   - {Specifier: imap.PartSpecifierHeader} fetches the message headers.
-	//   - {Specifier: imap.PartSpecifierNone} fetches the entire message body (all parts).
-	// - BodyStructure: requests the server to include the MIME structure of the message, which helps in parsing multipart messages.
-	fetchOptions := &imap.FetchOptions{
-		BodySection: []*imap.FetchItemBodySection{
-			{Specifier: imap.PartSpecifierText},   // text/plain
-			{Specifier: imap.PartSpecifierHeader}, // headers
-			{Specifier: imap.PartSpecifierNone},   // full body
-		},
-		BodyStructure: &imap.FetchItemBodyStructure{},
-	}
-
-	msgs := c.client.Fetch(seqSet, fetchOptions)
-
-	msg := msgs.Next()
-	if msg == nil {
-		return nil, fmt.Errorf("failed to fetch message")
-	}
-
-	buffer, err := msg.Collect()
+// GetMessageContent fetches the text and HTML bodies of a message in folder
+func (c *Client) GetMessageContent(ctx context.Context, folder string, uid uint32) (*MessageContent, error) {
+	contents, err := c.GetMessageContents(ctx, folder, []uint32{uid})
 	if err != nil {
-		return nil, fmt.Errorf("failed to collect message data: %v", err)
-	}
-
-	// Save raw message data if debug mode is enabled
-	if c.debugConfig.Enabled && c.debugConfig.SaveRawMessages {
-		// Get the current folder name for debug context
-		// For now, we'll use "INBOX" as default - this could be improved by passing folder name as parameter
-		currentFolder := "INBOX"
-
-		// Combine all body sections into raw data for debugging
-		var rawData bytes.Buffer
-
-		// Write headers first
-		for _, section := range buffer.BodySection {
-			if section.Section != nil && section.Section.Specifier == imap.PartSpecifierHeader {
-				rawData.WriteString("=== HEADERS ===\n")
-				rawData.Write(section.Bytes)
-				rawData.WriteString("\n\n")
-			}
-		}
-
-		// Write full body
-		for _, section := range buffer.BodySection {
-			if section.Section != nil && section.Section.Specifier == imap.PartSpecifierNone {
-				rawData.WriteString("=== BODY ===\n")
-				rawData.Write(section.Bytes)
-				rawData.WriteString("\n\n")
-			}
-		}
-
-		// Write text part if available
-		for _, section := range buffer.BodySection {
-			if section.Section != nil && section.Section.Specifier == imap.PartSpecifierText {
-				rawData.WriteString("=== TEXT PART ===\n")
-				rawData.Write(section.Bytes)
-				rawData.WriteString("\n\n")
-			}
-		}
-
-		// Save to file
-		if err := c.saveRawMessage(uid, currentFolder, rawData.Bytes()); err != nil {
-			log.Printf("Failed to save raw message for UID %d: %v", uid, err)
-		}
+		return nil, err
 	}
-
-	content := &MessageContent{}
-
-	var contentType string
-	var boundary string
-	for _, section := range buffer.BodySection {
-		if section.Section != nil && section.Section.Specifier == imap.PartSpecifierHeader {
-			headers, err := mail.ReadMessage(bytes.NewReader(section.Bytes))
-			if err == nil {
-				contentType = headers.Header.Get("Content-Type")
-			}
-			break
-		}
-	}
-
-	if strings.Contains(contentType, "multipart/alternative") {
-		_, params, err := mime.ParseMediaType(contentType)
-		if err != nil {
-			fmt.Printf("Error parsing content type: %v\n", err)
-			return content, nil
-		}
-
-		boundary = params["boundary"]
-		if c.debugConfig.Enabled {
-			log.Printf("boundary: %s\n", boundary)
-		}
-	}
-
-	var part []byte
-	buffer.BodyStructure.Walk(func(path []int, bs imap.BodyStructure) (walkChildren bool) {
-		if strings.HasPrefix(bs.MediaType(), "text/plain") {
-			part = buffer.FindBodySection(&imap.FetchItemBodySection{Specifier: imap.PartSpecifierText})
-			if part != nil {
-				if boundary != "" {
-					mr := multipart.NewReader(bytes.NewReader(part), boundary)
-					for {
-						p, err := mr.NextPart()
-						if err != nil {
-							break
-						}
-						slurp, err := io.ReadAll(p)
-						if err != nil {
-							continue
-						}
-						ctype := p.Header.Get("Content-Type")
-						if strings.HasPrefix(ctype, "text/plain") {
-							content.TextBody = string(slurp)
-							if c.debugConfig.Enabled {
-								log.Printf("text part: %s\n", content.TextBody)
-							}
-						} else if strings.HasPrefix(ctype, "text/html") {
-							content.HTMLBody = string(slurp)
-							if c.debugConfig.Enabled {
-								log.Printf("html part: %s\n", content.HTMLBody)
-							}
-						}
-					}
-				} else {
-					content.TextBody = string(part)
-				}
-			}
-			return false
-		}
-		return true
-	})
-
-	if content.HTMLBody != "" {
-		content.HTMLBody = strings.ReplaceAll(content.HTMLBody, "=\r\n", "")
-	}
-	if content.TextBody != "" {
-		content.TextBody = strings.ReplaceAll(content.TextBody, "=\r\n", "")
+	content, ok := contents[uid]
+	if !ok {
+		metrics.IMAPFailures.WithLabelValues("fetch").Inc()
+		return nil, fmt.Errorf("failed to fetch message")
 	}
-
 	return content, nil
 }
 
@@ -373,7 +289,7 @@ func (c *Client) saveRawMessage(uid uint32, folder string, rawData []byte) error
 	// Create debug directory if it doesn't exist
 	debugDir := filepath.Join(c.debugConfig.RawMessagesDir, folder)
 	if err := os.MkdirAll(debugDir, 0755); err != nil {
-		log.Printf("Failed to create debug directory %s: %v", debugDir, err)
+		logger.Warn("Failed to create debug directory", "dir", debugDir, "error", err)
 		return err
 	}
 
@@ -384,11 +300,11 @@ func (c *Client) saveRawMessage(uid uint32, folder string, rawData []byte) error
 
 	// Write raw message to file
 	if err := os.WriteFile(filepath, rawData, 0644); err != nil {
-		log.Printf("Failed to save raw message to %s: %v", filepath, err)
+		logger.Warn("Failed to save raw message", "path", filepath, "error", err)
 		return err
 	}
 
-	log.Printf("Saved raw message UID %d to %s", uid, filepath)
+	logger.Debug("Saved raw message", "uid", uid, "path", filepath)
 
 	// Clean up old files if we exceed the maximum
 	c.cleanupOldRawMessages(debugDir)
@@ -405,7 +321,7 @@ func (c *Client) cleanupOldRawMessages(debugDir string) {
 	// Read directory contents
 	files, err := os.ReadDir(debugDir)
 	if err != nil {
-		log.Printf("Failed to read debug directory %s: %v", debugDir, err)
+		logger.Warn("Failed to read debug directory", "dir", debugDir, "error", err)
 		return
 	}
 
@@ -429,9 +345,9 @@ func (c *Client) cleanupOldRawMessages(debugDir string) {
 	for i := 0; i < excessCount; i++ {
 		filePath := filepath.Join(debugDir, emlFiles[i].Name())
 		if err := os.Remove(filePath); err != nil {
-			log.Printf("Failed to remove old raw message file %s: %v", filePath, err)
+			logger.Warn("Failed to remove old raw message file", "path", filePath, "error", err)
 		} else {
-			log.Printf("Removed old raw message file: %s", emlFiles[i].Name())
+			logger.Debug("Removed old raw message file", "file", emlFiles[i].Name())
 		}
 	}
 }
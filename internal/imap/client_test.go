@@ -182,7 +182,7 @@ func TestGetMessageBody_RequiresIntegration(t *testing.T) {
 
 	ctx := context.Background()
 
-	body, err := client.GetMessageBody(ctx, 1)
+	body, err := client.GetMessageBody(ctx, "INBOX", 1)
 
 	if err != nil {
 		t.Skip("Message UID 1 may not exist")
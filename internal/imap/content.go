@@ -0,0 +1,264 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset" // decode non-UTF-8 parts
+
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+)
+
+// contentPart is a body part holding a message's text or HTML body
+type contentPart struct {
+	section   *imap.FetchItemBodySection
+	mediaType string
+	encoding  string
+	charset   string
+	truncated bool // the section only requests the first maxBytes of the part
+}
+
+// contentParts picks the first inline text/plain and text/html parts of a message in MIME
+// tree order, skipping attachments. With maxBytes above zero, larger parts are requested
+// with a partial fetch of that many bytes.
+func contentParts(bs imap.BodyStructure, maxBytes int) []contentPart {
+	var parts []contentPart
+	found := make(map[string]bool)
+	bs.Walk(func(path []int, bs imap.BodyStructure) bool {
+		single, ok := bs.(*imap.BodyStructureSinglePart)
+		if !ok {
+			return true
+		}
+		mediaType := single.MediaType()
+		if mediaType != "text/plain" && mediaType != "text/html" || found[mediaType] {
+			return false
+		}
+		if disposition := single.Disposition(); disposition != nil && strings.EqualFold(disposition.Value, "attachment") {
+			return false
+		}
+		found[mediaType] = true
+
+		part := contentPart{
+			section:   &imap.FetchItemBodySection{Part: slices.Clone(path), Peek: true},
+			mediaType: mediaType,
+			encoding:  strings.ToLower(single.Encoding),
+			charset:   single.Params["charset"],
+		}
+		if maxBytes > 0 && int64(single.Size) > int64(maxBytes) {
+			part.section.Partial = &imap.SectionPartial{Offset: 0, Size: int64(maxBytes)}
+			part.truncated = true
+		}
+		parts = append(parts, part)
+		return false
+	})
+	return parts
+}
+
+// readContent decodes the parts picked by contentParts, looking up their bytes with find
+func readContent(ctx context.Context, uid uint32, parts []contentPart, find func(*imap.FetchItemBodySection) []byte) *MessageContent {
+	log := logging.FromContext(ctx, logger)
+
+	content := &MessageContent{}
+	for _, part := range parts {
+		data := find(part.section)
+		if data == nil {
+			log.Warn("Server returned no data for part", "uid", uid, "part", partPath(part.section.Part))
+			continue
+		}
+
+		body, err := decodePart(part, data)
+		if err != nil && !part.truncated {
+			log.Warn("Failed to decode part", "uid", uid, "part", partPath(part.section.Part), "error", err)
+		}
+		if part.truncated {
+			log.Debug("Truncated part", "uid", uid, "part", partPath(part.section.Part), "bytes", len(data))
+		}
+
+		if part.mediaType == "text/html" {
+			content.HTMLBody = body
+			log.Debug("Decoded HTML part", "uid", uid, "bytes", len(body))
+		} else {
+			content.TextBody = body
+			log.Debug("Decoded text part", "uid", uid, "bytes", len(body))
+		}
+	}
+	return content
+}
+
+// decodePart undoes a part's transfer encoding and converts it to UTF-8. Whatever decodes
+// before an error is kept, so a part cut short by a partial fetch still yields its start;
+// a part that does not decode at all is returned as is.
+func decodePart(part contentPart, data []byte) (string, error) {
+	header := message.Header{}
+	params := map[string]string{}
+	if part.charset != "" {
+		params["charset"] = part.charset
+	}
+	header.SetContentType(part.mediaType, params)
+	header.Set("Content-Transfer-Encoding", part.encoding)
+
+	entity, err := message.New(header, bytes.NewReader(data))
+	body, readErr := io.ReadAll(entity.Body)
+	if readErr != nil && err == nil {
+		err = readErr
+	}
+	if err != nil && len(body) == 0 {
+		return string(data), err
+	}
+	return string(body), err
+}
+
+// rawContent extracts the content of a raw message the way fetchContents does for a
+// message on the server with body structure bs
+func rawContent(ctx context.Context, uid uint32, bs imap.BodyStructure, raw []byte, maxBytes int) *MessageContent {
+	return readContent(ctx, uid, contentParts(bs, maxBytes), func(section *imap.FetchItemBodySection) []byte {
+		return imapserver.ExtractBodySection(bytes.NewReader(raw), section)
+	})
+}
+
+// GetMessageContents fetches the text and HTML bodies of messages in folder. It fetches
+// every message's body structure with one UID FETCH, then only the parts contentParts
+// picks, with one UID FETCH per distinct set of parts, all sent before any response is
+// read. Messages no longer on the server are missing from the result.
+func (c *Client) GetMessageContents(ctx context.Context, folder string, uids []uint32) (map[uint32]*MessageContent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var contents map[uint32]*MessageContent
+	err := c.do(ctx, func(client *imapclient.Client) error {
+		if err := selectFolder(client, folder); err != nil {
+			return err
+		}
+		var err error
+		contents, err = c.fetchContents(ctx, client, folder, uids)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// fetchContents implements GetMessageContents on the selected folder
+func (c *Client) fetchContents(ctx context.Context, client *imapclient.Client, folder string, uids []uint32) (map[uint32]*MessageContent, error) {
+	log := logging.FromContext(ctx, logger)
+
+	contents := make(map[uint32]*MessageContent, len(uids))
+	if len(uids) == 0 {
+		return contents, nil
+	}
+
+	var uidSet imap.UIDSet
+	for _, uid := range uids {
+		uidSet.AddNum(imap.UID(uid))
+	}
+	structures, err := client.Fetch(uidSet, &imap.FetchOptions{UID: true, BodyStructure: &imap.FetchItemBodyStructure{}}).Collect()
+	if err != nil {
+		metrics.IMAPFailures.WithLabelValues("fetch").Inc()
+		return nil, fmt.Errorf("failed to fetch body structures: %v", err)
+	}
+
+	saveRaw := c.debugConfig.Enabled && c.debugConfig.SaveRawMessages
+
+	// Messages needing the same sections share a command
+	type partFetch struct {
+		uids    imap.UIDSet
+		options *imap.FetchOptions
+	}
+	fetches := make(map[string]*partFetch)
+	parts := make(map[uint32][]contentPart, len(structures))
+	for _, buffer := range structures {
+		if buffer.BodyStructure == nil {
+			continue
+		}
+		uid := uint32(buffer.UID)
+		parts[uid] = contentParts(buffer.BodyStructure, c.config.MaxPartBytes)
+
+		var sections []*imap.FetchItemBodySection
+		var key strings.Builder
+		for _, part := range parts[uid] {
+			sections = append(sections, part.section)
+			fmt.Fprintf(&key, "%s<%v> ", partPath(part.section.Part), part.section.Partial)
+		}
+		if saveRaw {
+			sections = append(sections, &imap.FetchItemBodySection{Peek: true})
+		}
+		if len(sections) == 0 {
+			continue
+		}
+
+		fetch, ok := fetches[key.String()]
+		if !ok {
+			fetch = &partFetch{options: &imap.FetchOptions{UID: true, BodySection: sections}}
+			fetches[key.String()] = fetch
+		}
+		fetch.uids.AddNum(buffer.UID)
+	}
+
+	commands := make([]*imapclient.FetchCommand, 0, len(fetches))
+	for _, fetch := range fetches {
+		commands = append(commands, client.Fetch(fetch.uids, fetch.options))
+	}
+
+	// Collect every command concurrently, whatever order the server answers in
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		bodies   = make(map[uint32]*imapclient.FetchMessageBuffer, len(parts))
+		fetchErr error
+	)
+	for _, command := range commands {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buffers, err := command.Collect()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && fetchErr == nil {
+				fetchErr = err
+			}
+			for _, buffer := range buffers {
+				bodies[uint32(buffer.UID)] = buffer
+			}
+		}()
+	}
+	wg.Wait()
+	if fetchErr != nil {
+		metrics.IMAPFailures.WithLabelValues("fetch").Inc()
+		return nil, fmt.Errorf("failed to fetch message parts: %v", fetchErr)
+	}
+
+	for uid, msgParts := range parts {
+		buffer, ok := bodies[uid]
+		if !ok {
+			if len(msgParts) > 0 {
+				continue
+			}
+			buffer = &imapclient.FetchMessageBuffer{}
+		}
+
+		for _, section := range buffer.BodySection {
+			metrics.IMAPFetchBytes.Add(float64(len(section.Bytes)))
+		}
+		if raw := buffer.FindBodySection(&imap.FetchItemBodySection{}); raw != nil {
+			if err := c.saveRawMessage(uid, folder, raw); err != nil {
+				log.Warn("Failed to save raw message", "uid", uid, "error", err)
+			}
+		}
+
+		contents[uid] = readContent(ctx, uid, msgParts, buffer.FindBodySection)
+	}
+
+	log.Debug("Fetched message contents", "requested", len(uids), "fetched", len(contents), "commands", len(commands)+1)
+	return contents, nil
+}
@@ -0,0 +1,104 @@
+package imap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const base64Message = "From: Jane <jane@example.com>\r\n" +
+	"Subject: Plain\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"SGVsbG8gd29ybGQ=\r\n"
+
+const htmlMessage = "From: Jane <jane@example.com>\r\n" +
+	"Subject: HTML only\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Only HTML</p>\r\n"
+
+const mixedMessage = "From: Jane <jane@example.com>\r\n" +
+	"Subject: Nested\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"Attached notes\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Nested text\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Nested HTML</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer--\r\n"
+
+func TestGetMessageContents(t *testing.T) {
+	client, user := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	for _, raw := range []string{multipartMessage, base64Message, htmlMessage} {
+		_, err := user.Append("Archive", strings.NewReader(raw), &imap.AppendOptions{})
+		require.NoError(t, err)
+	}
+
+	// Leave another folder selected, as a concurrent GetMessages would
+	_, err := client.GetMessages(context.Background(), "INBOX", time.Time{})
+	require.NoError(t, err)
+
+	contents, err := client.GetMessageContents(context.Background(), "Archive", []uint32{1, 2, 3, 42})
+	require.NoError(t, err)
+
+	require.Len(t, contents, 3, "missing messages are left out")
+	assert.Equal(t, &MessageContent{TextBody: "Hello café", HTMLBody: "<p>Hello café</p>"}, contents[1])
+	assert.Equal(t, &MessageContent{TextBody: "Hello world"}, contents[2], "single parts are transfer-decoded")
+	assert.Equal(t, &MessageContent{HTMLBody: "<p>Only HTML</p>\r\n"}, contents[3], "HTML-only messages have content")
+
+	for subject, flags := range mailboxFlags(t, client, "Archive") {
+		assert.Empty(t, flags, "fetching %q does not mark it seen", subject)
+	}
+
+	client.config.MaxPartBytes = 8
+	contents, err = client.GetMessageContents(context.Background(), "Archive", []uint32{2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello ", contents[2].TextBody, "large parts are fetched partially")
+	assert.Equal(t, "<p>Only ", contents[3].HTMLBody)
+
+	contents, err = client.GetMessageContents(context.Background(), "Archive", nil)
+	require.NoError(t, err)
+	assert.Empty(t, contents)
+}
+
+func TestGetMessageContentSelectsFolder(t *testing.T) {
+	client, user := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	_, err := user.Append("Archive", strings.NewReader(base64Message), &imap.AppendOptions{})
+	require.NoError(t, err)
+
+	_, err = client.GetMessages(context.Background(), "INBOX", time.Time{})
+	require.NoError(t, err)
+
+	content, err := client.GetMessageContent(context.Background(), "Archive", 1)
+	require.NoError(t, err)
+	assert.Equal(t, &MessageContent{TextBody: "Hello world"}, content)
+
+	_, err = client.GetMessageContent(context.Background(), "Archive", 42)
+	assert.Error(t, err)
+}
+
+func TestContentParts(t *testing.T) {
+	_, content, err := ParseRaw(context.Background(), 1, []byte(mixedMessage))
+	require.NoError(t, err)
+	assert.Equal(t, &MessageContent{TextBody: "Nested text", HTMLBody: "<p>Nested HTML</p>"}, content, "attachments are skipped")
+}
@@ -0,0 +1,173 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-message"
+
+	"emailrss/internal/metrics"
+)
+
+// Inspection is a message as the processing pipeline sees it, for debugging
+type Inspection struct {
+	Message Message
+	Parts   []MIMEPart      // MIME tree in walk order
+	Content *MessageContent // exactly what GetMessageContent returns
+}
+
+// MIMEPart is one node of a message's MIME tree
+type MIMEPart struct {
+	Path      string // IMAP part number, e.g. "1.2"; empty for a multipart message itself
+	Depth     int
+	MediaType string
+	Params    map[string]string
+	Encoding  string
+	Size      uint32
+	Decoded   string // transfer- and charset-decoded body of text parts
+	DecodeErr string
+}
+
+// InspectMessage fetches message uid from folder and reports its MIME tree and its content.
+// The content is fetched by the same code as GetMessageContents; the full body is only used
+// for the MIME tree. The folder is opened read-only and the body is only peeked at, so the
+// message is not marked \Seen.
+func (c *Client) InspectMessage(ctx context.Context, folder string, uid uint32) (*Inspection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buffer *imapclient.FetchMessageBuffer
+	var content *MessageContent
+	err := c.do(ctx, func(client *imapclient.Client) error {
+		if _, err := client.Select(folder, &imap.SelectOptions{ReadOnly: true}).Wait(); err != nil {
+			metrics.IMAPFailures.WithLabelValues("select").Inc()
+			return fmt.Errorf("failed to select folder %s: %v", folder, err)
+		}
+
+		options := &imap.FetchOptions{
+			Envelope:      true,
+			UID:           true,
+			BodyStructure: &imap.FetchItemBodyStructure{},
+			BodySection:   []*imap.FetchItemBodySection{{Peek: true}},
+		}
+		buffers, err := client.Fetch(imap.UIDSetNum(imap.UID(uid)), options).Collect()
+		if err != nil {
+			metrics.IMAPFailures.WithLabelValues("fetch").Inc()
+			return fmt.Errorf("failed to fetch message %d: %v", uid, err)
+		}
+		if len(buffers) == 0 {
+			return fmt.Errorf("message %d not found in %s", uid, folder)
+		}
+		buffer = buffers[0]
+
+		contents, err := c.fetchContents(ctx, client, folder, []uint32{uid})
+		if err != nil {
+			return err
+		}
+		content = contents[uid]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if buffer.Envelope == nil || buffer.BodyStructure == nil {
+		return nil, fmt.Errorf("server returned no envelope or body structure for message %d", uid)
+	}
+	if content == nil {
+		return nil, fmt.Errorf("server returned no content for message %d", uid)
+	}
+
+	return inspect(uid, buffer, content), nil
+}
+
+// InspectRaw runs a raw RFC 5322 message, e.g. an .eml file, through the same extraction as
+// InspectMessage
+func InspectRaw(ctx context.Context, raw []byte) (*Inspection, error) {
+	buffer, err := rawBuffer(raw)
+	if err != nil {
+		return nil, err
+	}
+	full := buffer.FindBodySection(&imap.FetchItemBodySection{})
+	return inspect(0, buffer, rawContent(ctx, 0, buffer.BodyStructure, full, 0)), nil
+}
+
+// inspect reports the MIME tree of the full body in buffer alongside the extracted content
+func inspect(uid uint32, buffer *imapclient.FetchMessageBuffer, content *MessageContent) *Inspection {
+	inspection := &Inspection{
+		Message: messageFromEnvelope(buffer.SeqNum, uid, buffer.Envelope),
+		Content: content,
+	}
+
+	buffer.BodyStructure.Walk(func(path []int, bs imap.BodyStructure) bool {
+		part := MIMEPart{Path: partPath(path), Depth: len(path), MediaType: bs.MediaType()}
+		if single, ok := bs.(*imap.BodyStructureSinglePart); ok {
+			part.Params = single.Params
+			part.Encoding = strings.ToLower(single.Encoding)
+			part.Size = single.Size
+		} else if multi, ok := bs.(*imap.BodyStructureMultiPart); ok && multi.Extended != nil {
+			part.Params = multi.Extended.Params
+		}
+		inspection.Parts = append(inspection.Parts, part)
+		return true
+	})
+
+	decodeParts(buffer.FindBodySection(&imap.FetchItemBodySection{}), inspection.Parts)
+	return inspection
+}
+
+// decodeParts fills in the decoded bodies of the text parts of raw
+func decodeParts(raw []byte, parts []MIMEPart) {
+	byPath := make(map[string]*MIMEPart, len(parts))
+	for i := range parts {
+		byPath[parts[i].Path] = &parts[i]
+	}
+
+	entity, err := message.Read(bytes.NewReader(raw))
+	if entity == nil {
+		return
+	}
+	if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+		return
+	}
+
+	entity.Walk(func(path []int, entity *message.Entity, err error) error {
+		if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+			return nil
+		}
+		// go-message numbers parts from 0 and gives a single-part message no path at all
+		imapPath := []int{1}
+		if path != nil {
+			imapPath = make([]int, len(path))
+			for i, num := range path {
+				imapPath[i] = num + 1
+			}
+		}
+		part, ok := byPath[partPath(imapPath)]
+		if !ok || !strings.HasPrefix(part.MediaType, "text/") || entity.MultipartReader() != nil {
+			return nil
+		}
+		if err != nil {
+			part.DecodeErr = err.Error()
+		}
+		body, readErr := io.ReadAll(entity.Body)
+		if readErr != nil {
+			part.DecodeErr = readErr.Error()
+		}
+		part.Decoded = string(body)
+		return nil
+	})
+}
+
+func partPath(path []int) string {
+	nums := make([]string, len(path))
+	for i, num := range path {
+		nums[i] = strconv.Itoa(num)
+	}
+	return strings.Join(nums, ".")
+}
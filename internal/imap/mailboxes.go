@@ -0,0 +1,98 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"emailrss/internal/metrics"
+)
+
+// specialUse lists the RFC 6154 attributes describing what a mailbox is for
+var specialUse = []imap.MailboxAttr{
+	imap.MailboxAttrAll,
+	imap.MailboxAttrArchive,
+	imap.MailboxAttrDrafts,
+	imap.MailboxAttrFlagged,
+	imap.MailboxAttrJunk,
+	imap.MailboxAttrSent,
+	imap.MailboxAttrTrash,
+	imap.MailboxAttrImportant,
+}
+
+// Mailbox describes a folder on the server
+type Mailbox struct {
+	Name       string
+	SpecialUse []string // special-use attributes such as \Archive or \Sent
+	Messages   uint32
+	Unseen     uint32
+}
+
+// ListMailboxes returns every selectable folder with its message counts and special-use
+// attributes. Counts come with the listing on servers supporting LIST-STATUS and from one
+// STATUS command per folder otherwise.
+func (c *Client) ListMailboxes(ctx context.Context) ([]Mailbox, error) {
+	var mailboxes []Mailbox
+	err := c.do(ctx, func(client *imapclient.Client) error {
+		var err error
+		mailboxes, err = listMailboxes(client)
+		return err
+	})
+	return mailboxes, err
+}
+
+func listMailboxes(client *imapclient.Client) ([]Mailbox, error) {
+	statusOptions := &imap.StatusOptions{NumMessages: true, NumUnseen: true}
+
+	listOptions := &imap.ListOptions{}
+	caps := client.Caps()
+	if caps.Has(imap.CapIMAP4rev2) || caps.Has(imap.CapListStatus) {
+		listOptions.ReturnStatus = statusOptions
+	}
+	if caps.Has(imap.CapSpecialUse) && (caps.Has(imap.CapIMAP4rev2) || caps.Has(imap.CapListExtended)) {
+		listOptions.ReturnSpecialUse = true
+	}
+
+	listed, err := listSelectable(client, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	mailboxes := make([]Mailbox, 0, len(listed))
+	for _, data := range listed {
+		mbox := Mailbox{Name: data.Mailbox, SpecialUse: specialUseAttrs(data.Attrs)}
+
+		status := data.Status
+		if status == nil {
+			status, err = client.Status(data.Mailbox, statusOptions).Wait()
+			if err != nil {
+				metrics.IMAPFailures.WithLabelValues("status").Inc()
+				return nil, fmt.Errorf("failed to get status of folder %s: %v", data.Mailbox, err)
+			}
+		}
+		if status.NumMessages != nil {
+			mbox.Messages = *status.NumMessages
+		}
+		if status.NumUnseen != nil {
+			mbox.Unseen = *status.NumUnseen
+		}
+
+		mailboxes = append(mailboxes, mbox)
+	}
+
+	return mailboxes, nil
+}
+
+// specialUseAttrs picks the special-use attributes out of a folder's attributes
+func specialUseAttrs(attrs []imap.MailboxAttr) []string {
+	var special []string
+	for _, attr := range attrs {
+		if slices.Contains(specialUse, attr) {
+			special = append(special, string(attr))
+		}
+	}
+	return special
+}
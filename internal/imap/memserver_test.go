@@ -0,0 +1,279 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMemServer starts an in-memory IMAP server advertising caps and returns a client
+// logged in to it along with the server-side user
+func newMemServer(t *testing.T, caps imap.CapSet, dedupKeyword string) (*Client, *imapmemserver.User) {
+	t.Helper()
+
+	user := imapmemserver.NewUser("user", "secret")
+	for _, name := range []string{"INBOX", "Archive"} {
+		require.NoError(t, user.Create(name, nil))
+	}
+	memServer := imapmemserver.New()
+	memServer.AddUser(user)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		Caps:         caps,
+		InsecureAuth: true,
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+
+	addr := ln.Addr().(*net.TCPAddr)
+	client, err := NewClient(IMAPConfig{Host: "127.0.0.1", Port: addr.Port, Username: "user", Password: "secret", Timeout: 5, DedupKeyword: dedupKeyword}, DebugConfig{})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return client, user
+}
+
+// appendMessage adds a message received at date to mailbox
+func appendMessage(t *testing.T, user *imapmemserver.User, mailbox, subject string, date time.Time) {
+	t.Helper()
+	raw := fmt.Sprintf("From: sender@example.com\r\nSubject: %s\r\nDate: %s\r\n\r\nBody\r\n", subject, date.Format(time.RFC1123Z))
+	_, err := user.Append(mailbox, bytes.NewReader([]byte(raw)), &imap.AppendOptions{Time: date})
+	require.NoError(t, err)
+}
+
+// mailboxFlags returns the flags of every message in mailbox keyed by subject. Flags are
+// lower-cased because servers may normalise the case of keywords.
+func mailboxFlags(t *testing.T, client *Client, mailbox string) map[string][]imap.Flag {
+	t.Helper()
+	_, err := client.client.Select(mailbox, nil).Wait()
+	require.NoError(t, err)
+
+	all := imap.SeqSet{{Start: 1, Stop: 0}}
+	messages, err := client.client.Fetch(all, &imap.FetchOptions{Flags: true, Envelope: true}).Collect()
+	require.NoError(t, err)
+
+	flags := make(map[string][]imap.Flag)
+	for _, msg := range messages {
+		flags[msg.Envelope.Subject] = []imap.Flag{}
+		for _, flag := range msg.Flags {
+			flags[msg.Envelope.Subject] = append(flags[msg.Envelope.Subject], imap.Flag(strings.ToLower(string(flag))))
+		}
+	}
+	return flags
+}
+
+func TestApplyActions(t *testing.T) {
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name string
+		caps imap.CapSet
+	}{
+		{name: "with MOVE", caps: imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapMove: {}, imap.CapUIDPlus: {}}},
+		{name: "without MOVE", caps: imap.CapSet{imap.CapIMAP4rev1: {}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, user := newMemServer(t, test.caps, "")
+			appendMessage(t, user, "INBOX", "First", date)
+			appendMessage(t, user, "INBOX", "Second", date)
+			appendMessage(t, user, "INBOX", "Untouched", date)
+
+			ctx := context.Background()
+			require.NoError(t, client.ApplyActions(ctx, "INBOX", []uint32{1, 2}, Actions{MarkSeen: true, Keywords: []string{"$EmailRSS"}}))
+
+			flags := mailboxFlags(t, client, "INBOX")
+			assert.ElementsMatch(t, []imap.Flag{`\seen`, "$emailrss"}, flags["First"])
+			assert.ElementsMatch(t, []imap.Flag{`\seen`, "$emailrss"}, flags["Second"])
+			assert.Empty(t, flags["Untouched"])
+
+			require.NoError(t, client.ApplyActions(ctx, "INBOX", []uint32{2}, Actions{MoveTo: "Archive"}))
+
+			inbox := mailboxFlags(t, client, "INBOX")
+			assert.Len(t, inbox, 2)
+			assert.NotContains(t, inbox, "Second")
+			archive := mailboxFlags(t, client, "Archive")
+			assert.Contains(t, archive, "Second")
+			assert.NotContains(t, archive["Second"], imap.Flag(`\deleted`))
+
+			assert.Error(t, client.ApplyActions(ctx, "INBOX", []uint32{1}, Actions{MoveTo: "Missing"}))
+			assert.NoError(t, client.ApplyActions(ctx, "INBOX", nil, Actions{MarkSeen: true}), "nothing to do")
+		})
+	}
+}
+
+func TestDeleteOldMessages(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		caps imap.CapSet
+	}{
+		{name: "with UIDPLUS", caps: imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapUIDPlus: {}}},
+		{name: "without UIDPLUS", caps: imap.CapSet{imap.CapIMAP4rev1: {}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, user := newMemServer(t, test.caps, "")
+			now := time.Now()
+			appendMessage(t, user, "INBOX", "Old", now.AddDate(0, 0, -40))
+			appendMessage(t, user, "INBOX", "Older", now.AddDate(0, 0, -60))
+			appendMessage(t, user, "INBOX", "Recent", now)
+
+			ctx := context.Background()
+			uids, err := client.MessagesBefore(ctx, "INBOX", now.AddDate(0, 0, -30))
+			require.NoError(t, err)
+			assert.Equal(t, []uint32{1, 2}, uids)
+
+			require.NoError(t, client.DeleteMessages(ctx, "INBOX", []uint32{2}))
+
+			inbox := mailboxFlags(t, client, "INBOX")
+			assert.Len(t, inbox, 2)
+			assert.Contains(t, inbox, "Old")
+			assert.Contains(t, inbox, "Recent")
+		})
+	}
+}
+
+func TestGetMessagesSkipsDedupKeyword(t *testing.T) {
+	client, user := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "$EmailRSS")
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	appendMessage(t, user, "INBOX", "Published", date)
+	appendMessage(t, user, "INBOX", "Fresh", date)
+
+	ctx := context.Background()
+	require.NoError(t, client.ApplyActions(ctx, "INBOX", []uint32{1}, Actions{Keywords: []string{"$EmailRSS"}}))
+
+	messages, err := client.GetMessages(ctx, "INBOX", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Fresh", messages[0].Subject)
+	assert.Equal(t, uint32(2), messages[0].UID)
+}
+
+func TestAllowsKeyword(t *testing.T) {
+	assert.True(t, allowsKeyword([]imap.Flag{imap.FlagSeen, imap.FlagWildcard}, "$EmailRSS"))
+	assert.True(t, allowsKeyword([]imap.Flag{"$emailrss"}, "$EmailRSS"))
+	assert.False(t, allowsKeyword([]imap.Flag{imap.FlagSeen, imap.FlagDeleted}, "$EmailRSS"))
+}
+
+func TestListFolders(t *testing.T) {
+	client, user := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	require.NoError(t, user.Create("Lists/golang-nuts", nil))
+
+	folders, err := client.ListFolders(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"INBOX", "Archive", "Lists/golang-nuts"}, folders)
+}
+
+func TestListMailboxes(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		caps imap.CapSet
+	}{
+		{name: "with LIST-STATUS", caps: imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapListExtended: {}, imap.CapListStatus: {}, imap.CapSpecialUse: {}}},
+		{name: "with STATUS per folder", caps: imap.CapSet{imap.CapIMAP4rev1: {}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, user := newMemServer(t, test.caps, "")
+			date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+			appendMessage(t, user, "INBOX", "Read", date)
+			appendMessage(t, user, "INBOX", "Unread", date)
+			require.NoError(t, client.ApplyActions(context.Background(), "INBOX", []uint32{1}, Actions{MarkSeen: true}))
+
+			mailboxes, err := client.ListMailboxes(context.Background())
+			require.NoError(t, err)
+
+			byName := map[string]Mailbox{}
+			for _, mbox := range mailboxes {
+				byName[mbox.Name] = mbox
+			}
+			require.Len(t, byName, 2)
+			assert.Equal(t, Mailbox{Name: "INBOX", Messages: 2, Unseen: 1}, byName["INBOX"])
+			assert.Equal(t, Mailbox{Name: "Archive"}, byName["Archive"])
+		})
+	}
+}
+
+func TestSpecialUseAttrs(t *testing.T) {
+	attrs := []imap.MailboxAttr{imap.MailboxAttrHasNoChildren, imap.MailboxAttrSent, imap.MailboxAttrSubscribed, imap.MailboxAttrJunk}
+	assert.Equal(t, []string{`\Sent`, `\Junk`}, specialUseAttrs(attrs))
+	assert.Nil(t, specialUseAttrs([]imap.MailboxAttr{imap.MailboxAttrHasChildren}))
+}
+
+const multipartMessage = "From: Jane <jane@example.com>\r\n" +
+	"Subject: Weekly news\r\n" +
+	"Date: Sat, 09 Aug 2025 10:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Hello caf=C3=A9\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=iso-8859-1\r\n" +
+	"\r\n" +
+	"<p>Hello caf\xe9</p>\r\n" +
+	"--b1--\r\n"
+
+func TestInspectMessage(t *testing.T) {
+	client, user := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	_, err := user.Append("INBOX", strings.NewReader(multipartMessage), &imap.AppendOptions{})
+	require.NoError(t, err)
+
+	inspection, err := client.InspectMessage(context.Background(), "INBOX", 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Weekly news", inspection.Message.Subject)
+	assert.Equal(t, "Jane <jane@example.com>", inspection.Message.From)
+	assert.Equal(t, uint32(1), inspection.Message.UID)
+
+	require.Len(t, inspection.Parts, 3)
+	assert.Equal(t, "multipart/alternative", inspection.Parts[0].MediaType)
+	assert.Equal(t, "1", inspection.Parts[1].Path)
+	assert.Equal(t, "quoted-printable", inspection.Parts[1].Encoding)
+	assert.Equal(t, "Hello café", inspection.Parts[1].Decoded)
+	assert.Equal(t, "<p>Hello café</p>", inspection.Parts[2].Decoded, "parts are decoded from their charset")
+
+	assert.Equal(t, "Hello café", inspection.Content.TextBody)
+	assert.Equal(t, "<p>Hello café</p>", inspection.Content.HTMLBody, "content is decoded from its charset")
+
+	// A file gives the same result as the server
+	fromFile, err := InspectRaw(context.Background(), []byte(strings.ReplaceAll(multipartMessage, "\r\n", "\n")))
+	require.NoError(t, err)
+	require.Len(t, fromFile.Parts, len(inspection.Parts))
+	for i, part := range fromFile.Parts {
+		assert.Equal(t, inspection.Parts[i].Path, part.Path)
+		assert.Equal(t, inspection.Parts[i].MediaType, part.MediaType)
+		assert.Equal(t, inspection.Parts[i].Decoded, part.Decoded)
+	}
+	assert.Equal(t, inspection.Content, fromFile.Content)
+
+	assert.Empty(t, mailboxFlags(t, client, "INBOX")["Weekly news"], "inspecting does not mark the message seen")
+
+	// Partial fetches apply to the content exactly as they do when processing
+	client.config.MaxPartBytes = 8
+	inspection, err = client.InspectMessage(context.Background(), "INBOX", 1)
+	require.NoError(t, err)
+	content, err := client.GetMessageContent(context.Background(), "INBOX", 1)
+	require.NoError(t, err)
+	assert.Equal(t, content, inspection.Content)
+	assert.Equal(t, "Hello café", inspection.Parts[1].Decoded, "the MIME tree still shows whole parts")
+
+	_, err = client.InspectMessage(context.Background(), "INBOX", 42)
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-message"
+)
+
+// ParseRaw extracts the envelope and content of a raw RFC 5322 message exactly as
+// GetMessages and GetMessageContent would for the same message on a server
+func ParseRaw(ctx context.Context, uid uint32, raw []byte) (Message, *MessageContent, error) {
+	buffer, err := rawBuffer(raw)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	raw = buffer.FindBodySection(&imap.FetchItemBodySection{})
+	return messageFromEnvelope(0, uid, buffer.Envelope), rawContent(ctx, uid, buffer.BodyStructure, raw, 0), nil
+}
+
+// ParseRawHeader extracts the envelope of a message from its header alone
+func ParseRawHeader(uid uint32, header []byte) (Message, error) {
+	entity, err := message.Read(bytes.NewReader(normalizeCRLF(header)))
+	if entity == nil {
+		return Message{}, fmt.Errorf("failed to parse message header: %v", err)
+	}
+	return messageFromEnvelope(0, uid, imapserver.ExtractEnvelope(entity.Header.Header)), nil
+}
+
+// rawBuffer derives the envelope, body structure and full body of a raw message, the way an
+// IMAP server would
+func rawBuffer(raw []byte) (*imapclient.FetchMessageBuffer, error) {
+	raw = normalizeCRLF(raw)
+
+	entity, err := message.Read(bytes.NewReader(raw))
+	if entity == nil {
+		return nil, fmt.Errorf("failed to parse message: %v", err)
+	}
+
+	return &imapclient.FetchMessageBuffer{
+		Envelope:      imapserver.ExtractEnvelope(entity.Header.Header),
+		BodyStructure: imapserver.ExtractBodyStructure(bytes.NewReader(raw)),
+		BodySection: []imapclient.FetchBodySectionBuffer{
+			{Section: &imap.FetchItemBodySection{}, Bytes: raw},
+		},
+	}, nil
+}
+
+// normalizeCRLF converts line endings to CRLF, the way servers store messages
+func normalizeCRLF(raw []byte) []byte {
+	return bytes.ReplaceAll(bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+}
@@ -0,0 +1,246 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without contacting the server while repeated connection
+// failures have the account marked unhealthy
+var ErrCircuitOpen = errors.New("IMAP server unavailable after repeated connection failures")
+
+// RetryConfig controls how operations recover from a lost connection
+type RetryConfig struct {
+	MaxAttempts      int           // attempts per operation, including the first
+	InitialBackoff   time.Duration // wait before the first retry, doubled for each later one
+	MaxBackoff       time.Duration
+	BreakerThreshold int           // consecutive connection failures that open the circuit
+	BreakerCooldown  time.Duration // how long an open circuit rejects operations
+}
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = 3
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = time.Second
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 30 * time.Second
+	}
+	if r.BreakerThreshold <= 0 {
+		r.BreakerThreshold = 5
+	}
+	if r.BreakerCooldown <= 0 {
+		r.BreakerCooldown = time.Minute
+	}
+	return r
+}
+
+// backoff returns how long to wait before retry number attempt, counting from 1. The wait
+// is drawn from the upper half of the exponential delay so that clients spread out.
+func (r RetryConfig) backoff(attempt int) time.Duration {
+	delay := r.MaxBackoff
+	if attempt <= 30 {
+		delay = min(r.InitialBackoff<<(attempt-1), r.MaxBackoff)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// breaker opens after threshold consecutive connection failures. While open it rejects
+// operations; once the cooldown has passed, one attempt is let through, and the circuit
+// closes on its success or opens again on its failure.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= b.threshold && time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= b.threshold {
+		logger.Info("IMAP server reachable again; closing circuit")
+	}
+	b.failures = 0
+	b.openUntil = time.Time{}
+	metrics.IMAPCircuitOpen.Set(0)
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			logger.Error("IMAP server unreachable; opening circuit", "failures", b.failures, "cooldown", b.cooldown)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+		metrics.IMAPCircuitOpen.Set(1)
+	}
+}
+
+// open reports whether the circuit currently rejects operations
+func (b *breaker) open() bool {
+	return b.allow() != nil
+}
+
+// Healthy reports whether the account is usable, i.e. the circuit breaker is closed
+func (c *Client) Healthy() bool {
+	return !c.breaker.open()
+}
+
+// dial connects and logs in to the server, giving up when ctx ends or the connection
+// timeout passes
+func dial(ctx context.Context, config IMAPConfig) (*imapclient.Client, error) {
+	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
+
+	timeout := time.Duration(config.Timeout) * time.Second
+	if config.Timeout == 0 {
+		timeout = 15 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	connectStart := time.Now()
+	if config.TLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		metrics.IMAPFailures.WithLabelValues("connect").Inc()
+		return nil, fmt.Errorf("failed to connect to IMAP server: %v", err)
+	}
+	metrics.IMAPConnectDuration.Observe(time.Since(connectStart).Seconds())
+
+	client := imapclient.New(conn, &imapclient.Options{
+		Dialer: dialer,
+	})
+
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	loginStart := time.Now()
+	if err := client.Login(config.Username, config.Password).Wait(); err != nil {
+		metrics.IMAPFailures.WithLabelValues("login").Inc()
+		client.Close()
+		return nil, fmt.Errorf("failed to login: %v", err)
+	}
+	metrics.IMAPLoginDuration.Observe(time.Since(loginStart).Seconds())
+
+	return client, nil
+}
+
+// session returns the connection to the server, reconnecting if it has been lost
+func (c *Client) session(ctx context.Context) (*imapclient.Client, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.closed {
+		return nil, fmt.Errorf("IMAP client is closed")
+	}
+	if c.client != nil && c.client.State() != imap.ConnStateLogout {
+		return c.client, nil
+	}
+
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+	client, err := dial(ctx, c.config)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	metrics.IMAPReconnects.Inc()
+	logging.FromContext(ctx, logger).Info("Reconnected to IMAP server", "host", c.config.Host)
+	return client, nil
+}
+
+// do runs op on the connection to the server. If op fails because the connection was
+// lost, do reconnects, logs in again and retries op with exponential backoff. ctx, limited
+// to the command timeout, bounds the whole operation: when it ends, the connection is
+// closed to abort the command in flight. Errors reported by the server are returned
+// without retrying.
+func (c *Client) do(ctx context.Context, op func(client *imapclient.Client) error) error {
+	log := logging.FromContext(ctx, logger)
+
+	if c.config.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.CommandTimeout)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+
+		client, err := c.session(ctx)
+		if err == nil {
+			stop := context.AfterFunc(ctx, func() { client.Close() })
+			err = op(client)
+			stop()
+
+			if ctx.Err() == nil && (err == nil || client.State() != imap.ConnStateLogout) {
+				c.breaker.success()
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("IMAP operation aborted: %v", context.Cause(ctx))
+		}
+
+		c.breaker.failure()
+		if attempt >= c.config.Retry.MaxAttempts {
+			return err
+		}
+		wait := c.config.Retry.backoff(attempt)
+		log.Warn("IMAP connection failed; retrying", "attempt", attempt, "wait", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("IMAP operation aborted: %v", context.Cause(ctx))
+		}
+	}
+}
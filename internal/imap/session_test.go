@@ -0,0 +1,122 @@
+package imap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetry makes a client retry and trip its breaker without real waits
+func fastRetry(client *Client, threshold int) {
+	client.config.Retry = RetryConfig{
+		MaxAttempts:      2,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       2 * time.Millisecond,
+		BreakerThreshold: threshold,
+		BreakerCooldown:  time.Hour,
+	}
+	client.breaker = newBreaker(threshold, time.Hour)
+}
+
+// unusedPort returns a local port nothing listens on
+func unusedPort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.NoError(t, ln.Close())
+	return port
+}
+
+func TestReconnectAfterConnectionLoss(t *testing.T) {
+	client, _ := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	fastRetry(client, 5)
+
+	lost := client.client
+	require.NoError(t, lost.Close())
+
+	folders, err := client.ListFolders(context.Background())
+	require.NoError(t, err, "the operation is retried on a new connection")
+	assert.ElementsMatch(t, []string{"INBOX", "Archive"}, folders)
+	assert.NotSame(t, lost, client.client)
+	assert.True(t, client.Healthy())
+}
+
+func TestServerErrorsAreNotRetried(t *testing.T) {
+	client, _ := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	fastRetry(client, 1)
+	session := client.client
+
+	_, err := client.GetMessages(context.Background(), "Missing", time.Time{})
+	require.Error(t, err)
+	assert.Same(t, session, client.client, "the connection is kept")
+	assert.True(t, client.Healthy(), "server errors do not count towards the breaker")
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	client, _ := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	fastRetry(client, 3)
+
+	// The server goes away
+	client.config.Port = unusedPort(t)
+	require.NoError(t, client.client.Close())
+
+	_, err := client.ListFolders(context.Background())
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	assert.True(t, client.Healthy(), "two failures stay below the threshold")
+
+	_, err = client.ListFolders(context.Background())
+	require.Error(t, err)
+	assert.False(t, client.Healthy())
+
+	_, err = client.ListFolders(context.Background())
+	assert.ErrorIs(t, err, ErrCircuitOpen, "an open circuit fails fast")
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := newBreaker(2, 10*time.Millisecond)
+	b.failure()
+	require.NoError(t, b.allow())
+	b.failure()
+	require.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	time.Sleep(15 * time.Millisecond)
+	require.NoError(t, b.allow(), "one attempt is let through after the cooldown")
+	b.failure()
+	assert.ErrorIs(t, b.allow(), ErrCircuitOpen, "a failed attempt opens the circuit again")
+
+	time.Sleep(15 * time.Millisecond)
+	b.success()
+	assert.NoError(t, b.allow())
+}
+
+func TestOperationHonoursContext(t *testing.T) {
+	client, _ := newMemServer(t, imap.CapSet{imap.CapIMAP4rev1: {}}, "")
+	fastRetry(client, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.GetMessages(ctx, "INBOX", time.Time{})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "context canceled")
+	assert.True(t, client.Healthy(), "cancellation is not a connection failure")
+
+	_, err = client.GetMessages(context.Background(), "INBOX", time.Time{})
+	assert.NoError(t, err, "the next operation reconnects")
+}
+
+func TestBackoff(t *testing.T) {
+	retry := RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 60: time.Second} {
+		for range 20 {
+			wait := retry.backoff(attempt)
+			assert.GreaterOrEqual(t, wait, max/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, wait, max, "attempt %d", attempt)
+		}
+	}
+}
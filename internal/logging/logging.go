@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Config controls log output. Levels overrides Level for individual components,
+// e.g. {"imap": "debug", "rss": "warn"}.
+type Config struct {
+	Format string
+	Level  string
+	Levels map[string]string
+}
+
+// state is swapped atomically by Setup so loggers created at package init pick up the configuration
+type state struct {
+	handler      slog.Handler
+	defaultLevel slog.Level
+	levels       map[string]slog.Level
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	current.Store(&state{
+		handler:      slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		defaultLevel: slog.LevelInfo,
+		levels:       map[string]slog.Level{},
+	})
+}
+
+// Setup configures the output format and levels for every component logger and
+// routes the standard library logger through slog
+func Setup(config Config, w io.Writer) error {
+	defaultLevel, err := ParseLevel(config.Level)
+	if err != nil {
+		return err
+	}
+
+	levels := make(map[string]slog.Level, len(config.Levels))
+	for component, value := range config.Levels {
+		level, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("invalid level for %s: %v", component, err)
+		}
+		levels[strings.ToLower(component)] = level
+	}
+
+	// The handler accepts everything; componentHandler applies the per-component levels
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q (expected text or json)", config.Format)
+	}
+
+	current.Store(&state{handler: handler, defaultLevel: defaultLevel, levels: levels})
+	slog.SetDefault(For("main"))
+	return nil
+}
+
+// ParseLevel converts debug, info, warn or error to a slog.Level; empty means info
+func ParseLevel(value string) (slog.Level, error) {
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", value)
+	}
+	return level, nil
+}
+
+// For returns the logger for a component. Its records carry a component attribute
+// and are filtered by the component's configured level.
+func For(component string) *slog.Logger {
+	return slog.New(&componentHandler{component: component})
+}
+
+type loggerKey struct{}
+
+// WithContext returns a context carrying logger, typically one enriched with run, folder or UID attributes
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, or fallback when there is none
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return fallback
+}
+
+// NewRunID returns a short random identifier used to correlate the log lines of one processing run
+func NewRunID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// componentHandler resolves the current state on every call, so Setup can run after
+// package-level loggers have been created. Attributes and groups added with With/WithGroup
+// are replayed onto the underlying handler in order.
+type componentHandler struct {
+	component string
+	ops       []func(slog.Handler) slog.Handler
+}
+
+func (h *componentHandler) level(st *state) slog.Level {
+	if level, ok := st.levels[h.component]; ok {
+		return level
+	}
+	return st.defaultLevel
+}
+
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level(current.Load())
+}
+
+func (h *componentHandler) Handle(ctx context.Context, record slog.Record) error {
+	st := current.Load()
+	if record.Level < h.level(st) {
+		return nil
+	}
+
+	handler := st.handler.WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *componentHandler) with(op func(slog.Handler) slog.Handler) *componentHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &componentHandler{component: h.component, ops: append(ops, op)}
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupForTest(t *testing.T, config Config) *bytes.Buffer {
+	t.Helper()
+	previous := current.Load()
+	t.Cleanup(func() { current.Store(previous) })
+
+	var buf bytes.Buffer
+	require.NoError(t, Setup(config, &buf))
+	return &buf
+}
+
+func TestSetupJSONFormat(t *testing.T) {
+	buf := setupForTest(t, Config{Format: "json", Level: "info"})
+
+	For("imap").Info("Connected", "host", "imap.example.com")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "Connected", record["msg"])
+	assert.Equal(t, "imap", record["component"])
+	assert.Equal(t, "imap.example.com", record["host"])
+}
+
+func TestPerComponentLevels(t *testing.T) {
+	buf := setupForTest(t, Config{
+		Format: "text",
+		Level:  "warn",
+		Levels: map[string]string{"imap": "debug"},
+	})
+
+	For("imap").Debug("imap debug line")
+	For("rss").Info("rss info line")
+	For("rss").Warn("rss warn line")
+
+	out := buf.String()
+	assert.Contains(t, out, "imap debug line")
+	assert.NotContains(t, out, "rss info line")
+	assert.Contains(t, out, "rss warn line")
+}
+
+func TestLoggerCreatedBeforeSetup(t *testing.T) {
+	logger := For("processor").With("run_id", "abc123")
+
+	buf := setupForTest(t, Config{Format: "text", Level: "info"})
+	logger.Info("Processing folder", "folder", "INBOX")
+
+	out := buf.String()
+	assert.Contains(t, out, "component=processor")
+	assert.Contains(t, out, "run_id=abc123")
+	assert.Contains(t, out, "folder=INBOX")
+}
+
+func TestSetupRejectsInvalidConfig(t *testing.T) {
+	previous := current.Load()
+	defer current.Store(previous)
+
+	assert.Error(t, Setup(Config{Format: "xml"}, &bytes.Buffer{}))
+	assert.Error(t, Setup(Config{Level: "verbose"}, &bytes.Buffer{}))
+	assert.Error(t, Setup(Config{Levels: map[string]string{"imap": "loud"}}, &bytes.Buffer{}))
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelInfo, level)
+
+	level, err = ParseLevel("DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	_, err = ParseLevel("trace")
+	assert.Error(t, err)
+}
+
+func TestContextLogger(t *testing.T) {
+	fallback := For("test")
+	assert.Same(t, fallback, FromContext(context.Background(), fallback))
+
+	logger := fallback.With("uid", 42)
+	ctx := WithContext(context.Background(), logger)
+	assert.Same(t, logger, FromContext(ctx, fallback))
+}
+
+func TestNewRunID(t *testing.T) {
+	a, b := NewRunID(), NewRunID()
+	assert.Len(t, a, 12)
+	assert.NotEqual(t, a, b)
+	assert.Empty(t, strings.Trim(a, "0123456789abcdef"))
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "emailrss"
+
+// IMAP metrics
+var (
+	IMAPConnectDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "connect_duration_seconds",
+		Help:      "Time taken to establish the IMAP connection.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	IMAPLoginDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "login_duration_seconds",
+		Help:      "Time taken to authenticate against the IMAP server.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	IMAPFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "failures_total",
+		Help:      "IMAP operations that failed, by operation.",
+	}, []string{"operation"})
+	IMAPMessagesFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "messages_fetched_total",
+		Help:      "Message envelopes fetched from the IMAP server, by folder.",
+	}, []string{"folder"})
+	IMAPFetchBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "fetch_bytes_total",
+		Help:      "Bytes of message content fetched from the IMAP server.",
+	})
+	IMAPReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "reconnects_total",
+		Help:      "Times the IMAP connection was re-established after being lost.",
+	})
+	IMAPCircuitOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "imap",
+		Name:      "circuit_open",
+		Help:      "1 while repeated connection failures keep IMAP operations from being attempted.",
+	})
+)
+
+// Processing metrics
+var (
+	FolderProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "processing",
+		Name:      "folder_duration_seconds",
+		Help:      "Time taken to process a folder, by folder.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"folder"})
+	FolderNewItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processing",
+		Name:      "new_items_total",
+		Help:      "New messages added to feeds, by folder.",
+	}, []string{"folder"})
+	ProcessingErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "processing",
+		Name:      "errors_total",
+		Help:      "Processing errors, by folder and stage.",
+	}, []string{"folder", "stage"})
+	WorkerQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "processing",
+		Name:      "worker_queue_depth",
+		Help:      "Messages waiting for a free message processing worker.",
+	})
+	WorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "processing",
+		Name:      "workers_busy",
+		Help:      "Message processing workers currently running.",
+	})
+	FolderLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "folder",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful sync, by folder.",
+	}, []string{"folder"})
+	FolderItems = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "folder",
+		Name:      "items",
+		Help:      "Processed messages tracked in the database, by folder.",
+	}, []string{"folder"})
+)
+
+// Notification metrics
+var (
+	NotificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notify",
+		Name:      "sent_total",
+		Help:      "Notifications delivered, by kind (websub, webhook or hub).",
+	}, []string{"kind"})
+	NotificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notify",
+		Name:      "failures_total",
+		Help:      "Notifications that could not be delivered after every attempt, by kind.",
+	}, []string{"kind"})
+)
+
+// HTTP metrics
+var (
+	FeedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "feed_requests_total",
+		Help:      "Feed requests, by feed name, HTTP status and format.",
+	}, []string{"feed", "status", "format"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// Bus passes events to subscribers in the same process, such as the server's live streams.
+// It never blocks the publisher: each subscriber holds at most one pending signal, so a slow
+// subscriber sees several events as one and reads the new items from the database itself.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{} // by feed
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[string]map[chan struct{}]struct{})}
+}
+
+// Notify signals the subscribers of event's feed
+func (b *Bus) Notify(ctx context.Context, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[event.Feed] {
+		select {
+		case ch <- struct{}{}:
+		default: // a signal is already pending
+		}
+	}
+}
+
+// Subscribe returns a channel signalled whenever feed gains items, and a function that
+// unsubscribes it
+func (b *Bus) Subscribe(feed string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	if b.subscribers[feed] == nil {
+		b.subscribers[feed] = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[feed][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[feed], ch)
+		if len(b.subscribers[feed]) == 0 {
+			delete(b.subscribers, feed)
+		}
+	}
+}
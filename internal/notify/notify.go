@@ -0,0 +1,198 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+	"emailrss/internal/rss"
+)
+
+var logger = logging.For("notify")
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, keyed with the webhook's
+// secret and prefixed with "sha256="
+const SignatureHeader = "X-EmailRSS-Signature"
+
+// Event announces items added to a feed. It is also the JSON body of webhooks.
+type Event struct {
+	Feed    string         `json:"feed"`
+	FeedURL string         `json:"feed_url"`
+	Summary string         `json:"summary"`
+	Items   []rss.JSONItem `json:"items"`
+}
+
+// Config lists where events are announced
+type Config struct {
+	BaseURL        string // feeds are published under BaseURL/feeds/
+	Hub            string // WebSub hub pinged with the feeds' URLs; empty for none
+	Webhooks       []Webhook
+	Timeout        time.Duration // per request
+	MaxAttempts    int           // attempts per delivery, including the first
+	InitialBackoff time.Duration // wait before the first retry, doubled for each later one
+}
+
+// Webhook receives events as JSON POST requests
+type Webhook struct {
+	URL    string
+	Secret string   // signs the body when set
+	Feeds  []string // only events of these feeds; empty for every feed
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	return c
+}
+
+// Notifier pings a WebSub hub and posts webhooks when feeds gain items
+type Notifier struct {
+	config Config
+	client *http.Client
+}
+
+// New returns a notifier for config
+func New(config Config) *Notifier {
+	config = config.withDefaults()
+	return &Notifier{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// Notify announces event to the hub and every webhook interested in its feed, all at once,
+// and returns when each has been delivered or has run out of attempts. Failures are logged.
+func (n *Notifier) Notify(ctx context.Context, event Event) {
+	log := logging.FromContext(ctx, logger)
+	event.FeedURL = rss.FeedURL(n.config.BaseURL, event.Feed, "json")
+
+	var wg sync.WaitGroup
+	send := func(kind, target string, request func() (*http.Request, error)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.deliver(ctx, request); err != nil {
+				log.Warn("Failed to send notification", "kind", kind, "target", target, "error", err)
+				metrics.NotificationFailures.WithLabelValues(kind).Inc()
+				return
+			}
+			metrics.NotificationsSent.WithLabelValues(kind).Inc()
+		}()
+	}
+
+	if n.config.Hub != "" {
+		for _, ext := range []string{"xml", "json"} {
+			topic := rss.FeedURL(n.config.BaseURL, event.Feed, ext)
+			send("websub", n.config.Hub, func() (*http.Request, error) {
+				return publishRequest(ctx, n.config.Hub, topic)
+			})
+		}
+	}
+
+	var body []byte
+	for _, webhook := range n.config.Webhooks {
+		if len(webhook.Feeds) > 0 && !slices.Contains(webhook.Feeds, event.Feed) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(event); err != nil {
+				log.Error("Failed to encode notification", "error", err)
+				return
+			}
+		}
+		send("webhook", webhook.URL, func() (*http.Request, error) {
+			return webhookRequest(ctx, webhook, body)
+		})
+	}
+
+	wg.Wait()
+	log.Debug("Sent notifications", "items", len(event.Items))
+}
+
+// publishRequest builds a WebSub publish ping telling hub that topic changed
+func publishRequest(ctx context.Context, hub, topic string) (*http.Request, error) {
+	form := url.Values{"hub.mode": {"publish"}, "hub.url": {topic}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hub, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// webhookRequest builds the POST of body to webhook, signed with its secret
+func webhookRequest(ctx context.Context, webhook Webhook, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-EmailRSS-Event", "feed.updated")
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	}
+	return req, nil
+}
+
+// Sign returns the signature header value of body for secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver sends the request built by request, retrying with exponential backoff after
+// network errors, 429 and 5xx responses. Other responses outside 2xx fail at once.
+func (n *Notifier) deliver(ctx context.Context, request func() (*http.Request, error)) error {
+	for attempt := 1; ; attempt++ {
+		req, err := request()
+		if err != nil {
+			return err
+		}
+
+		retry := true
+		resp, err := n.client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+			retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		}
+		if !retry || attempt >= n.config.MaxAttempts {
+			return err
+		}
+
+		wait := n.config.InitialBackoff << (attempt - 1)
+		logging.FromContext(ctx, logger).Debug("Notification failed; retrying", "attempt", attempt, "wait", wait, "error", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("notification aborted: %v", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/rss"
+)
+
+// recorder is an HTTP endpoint answering with the next status of a list and recording requests
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newRecorder(t *testing.T, statuses ...int) (*recorder, string) {
+	r := &recorder{statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server.URL
+}
+
+func TestNotify(t *testing.T) {
+	hub, hubURL := newRecorder(t)
+	webhook, webhookURL := newRecorder(t)
+	other, otherURL := newRecorder(t)
+
+	notifier := New(Config{
+		BaseURL: "https://feeds.example.com/",
+		Hub:     hubURL,
+		Webhooks: []Webhook{
+			{URL: webhookURL, Secret: "s3cret"},
+			{URL: otherURL, Feeds: []string{"alerts"}},
+		},
+	})
+	notifier.Notify(context.Background(), Event{
+		Feed:    "inbox",
+		Summary: "New item in inbox: Hello",
+		Items:   []rss.JSONItem{{ID: "INBOX_1", Title: "Hello"}},
+	})
+
+	require.Len(t, hub.requests, 2)
+	assert.ElementsMatch(t, []string{
+		"hub.mode=publish&hub.url=https%3A%2F%2Ffeeds.example.com%2Ffeeds%2Finbox.xml",
+		"hub.mode=publish&hub.url=https%3A%2F%2Ffeeds.example.com%2Ffeeds%2Finbox.json",
+	}, hub.bodies)
+	assert.Equal(t, "application/x-www-form-urlencoded", hub.requests[0].Header.Get("Content-Type"))
+
+	require.Len(t, webhook.requests, 1)
+	body := []byte(webhook.bodies[0])
+	assert.Equal(t, Sign("s3cret", body), webhook.requests[0].Header.Get(SignatureHeader))
+	var event Event
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, "inbox", event.Feed)
+	assert.Equal(t, "https://feeds.example.com/feeds/inbox.json", event.FeedURL)
+	assert.Equal(t, "New item in inbox: Hello", event.Summary)
+	require.Len(t, event.Items, 1)
+	assert.Equal(t, "Hello", event.Items[0].Title)
+
+	assert.Empty(t, other.requests, "webhooks limited to other feeds are skipped")
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"feed":"inbox"}' | openssl dgst -sha256 -hmac key
+	assert.Equal(t, "sha256=93323fd0d4d1fbb5e3343e8e8468dac23a288c5d56b9bf3fa1d80a460a1ed086", Sign("key", []byte(`{"feed":"inbox"}`)))
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	flaky, flakyURL := newRecorder(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	rejecting, rejectingURL := newRecorder(t, http.StatusBadRequest)
+	down, downURL := newRecorder(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK)
+
+	notifier := New(Config{
+		BaseURL:        "https://feeds.example.com",
+		Webhooks:       []Webhook{{URL: flakyURL}, {URL: rejectingURL}, {URL: downURL}},
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})
+	notifier.Notify(context.Background(), Event{Feed: "inbox"})
+
+	assert.Len(t, flaky.requests, 3, "429 and 5xx responses are retried")
+	assert.Len(t, rejecting.requests, 1, "other errors are not retried")
+	assert.Len(t, down.requests, 3, "delivery stops after max attempts")
+}
+
+func TestDeliveryHonoursContext(t *testing.T) {
+	down, downURL := newRecorder(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	notifier := New(Config{Webhooks: []Webhook{{URL: downURL}}, InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	notifier.Notify(ctx, Event{Feed: "inbox"})
+	assert.Less(t, time.Since(start), time.Second, "a backoff is cut short by ctx")
+	assert.Len(t, down.requests, 1)
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	inbox, unsubscribe := bus.Subscribe("inbox")
+	alerts, _ := bus.Subscribe("alerts")
+
+	bus.Notify(context.Background(), Event{Feed: "inbox"})
+	bus.Notify(context.Background(), Event{Feed: "inbox"})
+	assert.Len(t, inbox, 1, "pending signals coalesce instead of blocking")
+	assert.Empty(t, alerts)
+
+	<-inbox
+	unsubscribe()
+	bus.Notify(context.Background(), Event{Feed: "inbox"})
+	assert.Empty(t, inbox, "unsubscribed channels are not signalled")
+}
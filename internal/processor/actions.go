@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+)
+
+// ActionClient is implemented by IMAP clients that can change messages after processing
+type ActionClient interface {
+	ApplyActions(ctx context.Context, folder string, uids []uint32, actions imap.Actions) error
+	MessagesBefore(ctx context.Context, folder string, before time.Time) ([]uint32, error)
+	DeleteMessages(ctx context.Context, folder string, uids []uint32) error
+}
+
+// SetActions configures the IMAP actions applied to processed messages, keyed by folder
+func (p *Processor) SetActions(actions map[string]imap.Actions) {
+	p.actions = actions
+}
+
+// SetDedupKeyword makes the server the source of truth for what has been published:
+// processed messages are tagged with keyword, and the IMAP client is expected to skip
+// tagged messages when searching. The local database then only acts as a cache.
+func (p *Processor) SetDedupKeyword(keyword string) {
+	p.dedupKeyword = keyword
+}
+
+// folderActions returns the actions for newly processed messages in folderPath, including
+// the dedup keyword
+func (p *Processor) folderActions(folderPath string) imap.Actions {
+	actions := p.actions[folderPath]
+	if p.dedupKeyword != "" {
+		actions.Keywords = append(slices.Clone(actions.Keywords), p.dedupKeyword)
+	}
+	return actions
+}
+
+// applyActions flags or moves newly recorded messages. Failures are only logged: the
+// messages are already published and recorded, so they are not processed again.
+func (p *Processor) applyActions(ctx context.Context, folderPath string, uids []uint32) {
+	actions := p.folderActions(folderPath)
+	client, ok := p.client(folderPath).(ActionClient)
+	if !ok || !actions.Enabled() {
+		return
+	}
+	log := logging.FromContext(ctx, logger)
+
+	if err := client.ApplyActions(ctx, folderPath, uids, actions); err != nil {
+		log.Warn("Failed to apply IMAP actions", "count", len(uids), "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "actions").Inc()
+		return
+	}
+	log.Debug("Applied IMAP actions", "count", len(uids))
+}
+
+// tagKnownMessages adds the dedup keyword to messages the database already knows but the
+// server returned as untagged, e.g. ones processed before the keyword was configured or
+// whose tagging failed. Other actions are not repeated for them. Only messages recorded in
+// the database are tagged, so ones not processed yet are still returned by later searches.
+func (p *Processor) tagKnownMessages(ctx context.Context, folderPath string, messages []imap.Message) {
+	client, ok := p.client(folderPath).(ActionClient)
+	if !ok || p.dedupKeyword == "" || len(messages) == 0 {
+		return
+	}
+	log := logging.FromContext(ctx, logger)
+
+	uids := make([]uint32, 0, len(messages))
+	for _, msg := range messages {
+		uids = append(uids, msg.UID)
+	}
+	fresh, err := p.database.FilterNewUIDs(ctx, folderPath, uids)
+	if err != nil {
+		log.Warn("Failed to find already processed messages", "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "actions").Inc()
+		return
+	}
+	isNew := make(map[uint32]bool, len(fresh))
+	for _, uid := range fresh {
+		isNew[uid] = true
+	}
+	var known []uint32
+	for _, uid := range uids {
+		if !isNew[uid] {
+			known = append(known, uid)
+		}
+	}
+	if len(known) == 0 {
+		return
+	}
+
+	if err := client.ApplyActions(ctx, folderPath, known, imap.Actions{Keywords: []string{p.dedupKeyword}}); err != nil {
+		log.Warn("Failed to tag already processed messages", "count", len(known), "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "actions").Inc()
+		return
+	}
+	log.Info("Tagged already processed messages", "count", len(known), "keyword", p.dedupKeyword)
+}
+
+// deleteExpired removes processed messages older than the folder's delete_after from the
+// server. Messages that were never processed are left alone.
+func (p *Processor) deleteExpired(ctx context.Context, folderPath string) {
+	deleteAfter := p.actions[folderPath].DeleteAfter
+	client, ok := p.client(folderPath).(ActionClient)
+	if !ok || deleteAfter <= 0 {
+		return
+	}
+	log := logging.FromContext(ctx, logger)
+
+	candidates, err := client.MessagesBefore(ctx, folderPath, time.Now().Add(-deleteAfter))
+	if err != nil {
+		log.Warn("Failed to find expired messages", "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "actions").Inc()
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	unprocessed, err := p.database.FilterNewUIDs(ctx, folderPath, candidates)
+	if err != nil {
+		log.Warn("Failed to check expired messages", "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "actions").Inc()
+		return
+	}
+	skip := make(map[uint32]bool, len(unprocessed))
+	for _, uid := range unprocessed {
+		skip[uid] = true
+	}
+	var expired []uint32
+	for _, uid := range candidates {
+		if !skip[uid] {
+			expired = append(expired, uid)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	if err := client.DeleteMessages(ctx, folderPath, expired); err != nil {
+		log.Warn("Failed to delete expired messages", "count", len(expired), "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "actions").Inc()
+		return
+	}
+	log.Info("Deleted expired messages from server", "count", len(expired))
+}
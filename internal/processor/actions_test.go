@@ -0,0 +1,205 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+// actionIMAPClient records the actions applied to processed messages
+type actionIMAPClient struct {
+	MockIMAPClient
+	applied  map[string][]uint32
+	keywords map[uint32][]string
+	deleted  map[string][]uint32
+	old      []uint32
+	applyErr error
+	before   time.Time
+}
+
+func (c *actionIMAPClient) ApplyActions(ctx context.Context, folder string, uids []uint32, actions imap.Actions) error {
+	if c.applyErr != nil {
+		return c.applyErr
+	}
+	c.applied[folder] = append(c.applied[folder], uids...)
+	for _, uid := range uids {
+		c.keywords[uid] = append(c.keywords[uid], actions.Keywords...)
+	}
+	return nil
+}
+
+func (c *actionIMAPClient) MessagesBefore(ctx context.Context, folder string, before time.Time) ([]uint32, error) {
+	c.before = before
+	return c.old, nil
+}
+
+func (c *actionIMAPClient) DeleteMessages(ctx context.Context, folder string, uids []uint32) error {
+	c.deleted[folder] = append(c.deleted[folder], uids...)
+	return nil
+}
+
+func TestProcessFoldersAppliesActions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "actions.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "Actions",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	client := &actionIMAPClient{
+		MockIMAPClient: MockIMAPClient{
+			messages: []imap.Message{
+				{ID: 1, UID: 1, Subject: "One", From: "a@example.com", Date: date},
+				{ID: 2, UID: 2, Subject: "Two", From: "b@example.com", Date: date},
+			},
+			messageContents: map[uint32]*imap.MessageContent{},
+		},
+		applied:  map[string][]uint32{},
+		keywords: map[uint32][]string{},
+		deleted:  map[string][]uint32{},
+		old:      []uint32{1, 7},
+	}
+
+	processor := New(client, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 10}})
+	processor.SetActions(map[string]imap.Actions{
+		"INBOX": {MarkSeen: true, Keywords: []string{"$EmailRSS"}, DeleteAfter: 30 * 24 * time.Hour},
+	})
+
+	folders := map[string]string{"INBOX": "inbox", "Other": "other"}
+	require.NoError(t, processor.ProcessFolders(context.Background(), folders).Err())
+
+	assert.ElementsMatch(t, []uint32{1, 2}, client.applied["INBOX"])
+	assert.NotContains(t, client.applied, "Other", "folders without actions are left alone")
+	assert.Equal(t, []uint32{1}, client.deleted["INBOX"], "unprocessed messages are never deleted")
+	assert.WithinDuration(t, time.Now().Add(-30*24*time.Hour), client.before, time.Minute)
+
+	// Messages already recorded are not flagged again
+	require.NoError(t, processor.ProcessFolders(context.Background(), folders).Err())
+	assert.Len(t, client.applied["INBOX"], 2)
+
+	// Action failures do not fail the run or undo the recorded messages
+	client.messages = append(client.messages, imap.Message{ID: 3, UID: 3, Subject: "Three", Date: date})
+	client.applyErr = errors.New("mailbox is read-only")
+	require.NoError(t, processor.ProcessFolders(context.Background(), folders).Err())
+
+	fresh, err := database.FilterNewUIDs(context.Background(), "INBOX", []uint32{3})
+	require.NoError(t, err)
+	assert.Empty(t, fresh)
+}
+
+func TestProcessFoldersTagsDedupKeyword(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "dedup.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "Dedup",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	// UID 1 was recorded before the keyword was configured, so the server still returns it
+	require.NoError(t, database.MarkMessageProcessed(context.Background(), "INBOX", 1, "Old", "a@example.com", date))
+
+	client := &actionIMAPClient{
+		MockIMAPClient: MockIMAPClient{
+			messages: []imap.Message{
+				{ID: 1, UID: 1, Subject: "Old", From: "a@example.com", Date: date},
+				{ID: 2, UID: 2, Subject: "New", From: "b@example.com", Date: date},
+			},
+			messageContents: map[uint32]*imap.MessageContent{},
+		},
+		applied:  map[string][]uint32{},
+		keywords: map[uint32][]string{},
+		deleted:  map[string][]uint32{},
+	}
+
+	processor := New(client, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 10}})
+	processor.SetActions(map[string]imap.Actions{"INBOX": {MarkSeen: true, Keywords: []string{"$Read"}}})
+	processor.SetDedupKeyword("$EmailRSS")
+
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+
+	assert.Equal(t, []string{"$Read", "$EmailRSS"}, client.keywords[2], "new messages get the folder actions and the dedup keyword")
+	assert.Equal(t, []string{"$EmailRSS"}, client.keywords[1], "known messages only get the dedup keyword")
+}
+
+// cancellingActionClient cancels the run while fetching the first message's content
+type cancellingActionClient struct {
+	actionIMAPClient
+	cancel context.CancelFunc
+}
+
+func (c *cancellingActionClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
+	c.cancel()
+	return c.actionIMAPClient.GetMessageContent(ctx, folder, uid)
+}
+
+func TestDedupKeywordSkipsUnprocessedMessages(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "dedup.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, database.MarkMessageProcessed(context.Background(), "INBOX", 1, "Old", "a@example.com", date))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &cancellingActionClient{cancel: cancel, actionIMAPClient: actionIMAPClient{
+		MockIMAPClient: MockIMAPClient{
+			messages: []imap.Message{
+				{ID: 1, UID: 1, Subject: "Old", From: "a@example.com", Date: date},
+				{ID: 2, UID: 2, Subject: "Two", From: "b@example.com", Date: date.Add(time.Hour)},
+				{ID: 3, UID: 3, Subject: "Three", From: "b@example.com", Date: date.Add(2 * time.Hour)},
+				{ID: 4, UID: 4, Subject: "Four", From: "b@example.com", Date: date.Add(3 * time.Hour)},
+			},
+			messageContents: map[uint32]*imap.MessageContent{},
+		},
+		applied:  map[string][]uint32{},
+		keywords: map[uint32][]string{},
+		deleted:  map[string][]uint32{},
+	}}
+
+	processor := New(client, database, rss.NewGenerator(rss.RSSConfig{OutputDir: tempDir}))
+	processor.SetMaxWorkers(1)
+	processor.SetDedupKeyword("$EmailRSS")
+	require.NoError(t, processor.ProcessFolders(ctx, map[string]string{"INBOX": "inbox"}).Err())
+
+	assert.Empty(t, client.keywords[1], "known messages are tagged by the next run")
+	assert.Equal(t, []string{"$EmailRSS"}, client.keywords[2], "the message being fetched is finished and tagged")
+	assert.Empty(t, client.keywords[3], "messages left for the next run are not tagged")
+	assert.Empty(t, client.keywords[4])
+
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+	assert.Equal(t, []string{"$EmailRSS"}, client.keywords[1])
+	assert.Equal(t, []string{"$EmailRSS"}, client.keywords[3], "the rest is processed and tagged once")
+	assert.Equal(t, []string{"$EmailRSS"}, client.keywords[4])
+}
@@ -2,6 +2,11 @@ package processor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,7 +29,7 @@ func (m *MockAsyncIMAPClient) GetMessages(ctx context.Context, folder string, si
 	return m.messages, nil
 }
 
-func (m *MockAsyncIMAPClient) GetMessageContent(ctx context.Context, uid uint32) (*imap.MessageContent, error) {
+func (m *MockAsyncIMAPClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
 	// Simulate network delay
 	if m.delay > 0 {
 		time.Sleep(m.delay)
@@ -89,7 +94,7 @@ func TestAsyncMessageProcessing(t *testing.T) {
 
 		// Measure processing time
 		start := time.Now()
-		newMessages, err := processor.processMessagesAsync(ctx, "INBOX", messages)
+		newMessages, _, err := processor.processMessagesAsync(ctx, "INBOX", messages)
 		duration := time.Since(start)
 
 		require.NoError(t, err)
@@ -111,7 +116,7 @@ func TestAsyncMessageProcessing(t *testing.T) {
 
 	t.Run("AsyncWithSingleWorker", func(t *testing.T) {
 		// Clear database for fresh test
-		err := database.ClearFolderHistory("INBOX2")
+		err := database.ClearFolderHistory(context.Background(), "INBOX2")
 		require.NoError(t, err)
 
 		processor := New(mockIMAP, database, rssGenerator)
@@ -120,7 +125,7 @@ func TestAsyncMessageProcessing(t *testing.T) {
 		ctx := context.Background()
 
 		start := time.Now()
-		newMessages, err := processor.processMessagesAsync(ctx, "INBOX2", messages)
+		newMessages, _, err := processor.processMessagesAsync(ctx, "INBOX2", messages)
 		duration := time.Since(start)
 
 		require.NoError(t, err)
@@ -173,10 +178,11 @@ func TestAsyncFeedGeneration(t *testing.T) {
 
 	// Test concurrent feed generation
 	start := time.Now()
-	err := processor.generateFeedsAsync(ctx, "INBOX", "test", testMessages)
+	items, err := processor.generateFeedsAsync(ctx, "INBOX", "test", testMessages)
 	duration := time.Since(start)
 
 	require.NoError(t, err)
+	assert.Len(t, items, len(testMessages))
 
 	// Verify both feeds were created
 	assert.FileExists(t, tempDir+"/test.xml")
@@ -237,7 +243,7 @@ func TestConcurrentFolderProcessing(t *testing.T) {
 
 	// Test concurrent folder processing
 	start := time.Now()
-	err = processor.ProcessFolders(ctx, folders)
+	err = processor.ProcessFolders(ctx, folders).Err()
 	duration := time.Since(start)
 
 	require.NoError(t, err)
@@ -254,3 +260,143 @@ func TestConcurrentFolderProcessing(t *testing.T) {
 
 	t.Logf("Folder processing took: %v", duration)
 }
+
+// countingIMAPClient counts content fetches
+type countingIMAPClient struct {
+	MockIMAPClient
+	fetches atomic.Int32
+}
+
+func (c *countingIMAPClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
+	c.fetches.Add(1)
+	return c.MockIMAPClient.GetMessageContent(ctx, folder, uid)
+}
+
+// failingBatchStore rejects batched writes
+type failingBatchStore struct {
+	db.Store
+}
+
+func (f *failingBatchStore) MarkMessagesProcessed(ctx context.Context, folder string, messages []db.NewMessage) error {
+	return errors.New("disk I/O error")
+}
+
+func TestProcessFolderRecordsAfterFeedsAreWritten(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "batch.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	mockIMAP := &countingIMAPClient{MockIMAPClient: MockIMAPClient{
+		messages: []imap.Message{
+			{ID: 1, UID: 1, Subject: "One", From: "a@example.com", Date: date},
+			{ID: 2, UID: 2, Subject: "Two", From: "a@example.com", Date: date.Add(time.Hour)},
+			{ID: 3, UID: 3, Subject: "Three", From: "a@example.com", Date: date.Add(2 * time.Hour)},
+		},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "one"}},
+	}}
+	require.NoError(t, database.MarkMessageProcessed(context.Background(), "INBOX", 2, "Two", "a@example.com", date.Add(time.Hour)))
+
+	// The feeds cannot be written when the output directory is a file
+	blocked := filepath.Join(tempDir, "blocked")
+	require.NoError(t, os.WriteFile(blocked, nil, 0644))
+	processor := New(mockIMAP, database, rss.NewGenerator(rss.RSSConfig{OutputDir: blocked}))
+
+	report := FolderReport{Folder: "INBOX", Feed: "inbox"}
+	err = processor.processFolder(context.Background(), &report)
+	require.Error(t, err)
+	assert.Zero(t, report.New)
+	assert.Equal(t, 2, report.Backlog)
+	assert.Equal(t, int32(2), mockIMAP.fetches.Load(), "content is only fetched for new messages")
+
+	fresh, err := database.FilterNewUIDs(context.Background(), "INBOX", []uint32{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 3}, fresh, "nothing is recorded when the feeds fail")
+
+	// A failed store write leaves the messages for the next run too
+	feedsDir := filepath.Join(tempDir, "feeds")
+	processor = New(mockIMAP, &failingBatchStore{Store: database}, rss.NewGenerator(rss.RSSConfig{OutputDir: feedsDir}))
+	report = FolderReport{Folder: "INBOX", Feed: "inbox"}
+	err = processor.processFolder(context.Background(), &report)
+	require.Error(t, err)
+	assert.Equal(t, 2, report.Backlog)
+
+	fresh, err = database.FilterNewUIDs(context.Background(), "INBOX", []uint32{1, 2, 3})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{1, 3}, fresh)
+
+	processor = New(mockIMAP, database, rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            feedsDir,
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	}))
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 10}})
+	report = FolderReport{Folder: "INBOX", Feed: "inbox"}
+	err = processor.processFolder(context.Background(), &report)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.New)
+	assert.Zero(t, report.Backlog)
+	assert.Equal(t, 3, report.Listed)
+
+	count, err := database.CountProcessedMessages(context.Background(), "INBOX")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	data, err := os.ReadFile(filepath.Join(feedsDir, "inbox.json"))
+	require.NoError(t, err)
+	var feed rss.JSONFeed
+	require.NoError(t, json.Unmarshal(data, &feed))
+	require.Len(t, feed.Items, 3, "the feed holds stored and new messages")
+	assert.Equal(t, "Three", feed.Items[0].Title)
+	assert.Equal(t, "Two", feed.Items[1].Title)
+	assert.Equal(t, "one", feed.Items[2].ContentText)
+}
+
+// cancellingIMAPClient cancels the run while fetching the first message's content
+type cancellingIMAPClient struct {
+	countingIMAPClient
+	cancel context.CancelFunc
+}
+
+func (c *cancellingIMAPClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
+	c.cancel()
+	return c.countingIMAPClient.GetMessageContent(ctx, folder, uid)
+}
+
+func TestProcessFoldersFinishesCurrentMessageOnCancel(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "cancel.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	mockIMAP := &cancellingIMAPClient{cancel: cancel, countingIMAPClient: countingIMAPClient{MockIMAPClient: MockIMAPClient{
+		messages: []imap.Message{
+			{ID: 1, UID: 1, Subject: "Three", From: "a@example.com", Date: date.Add(2 * time.Hour)},
+			{ID: 2, UID: 2, Subject: "One", From: "a@example.com", Date: date},
+			{ID: 3, UID: 3, Subject: "Two", From: "a@example.com", Date: date.Add(time.Hour)},
+		},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "three"}, 2: {TextBody: "one"}, 3: {TextBody: "two"}},
+	}}}
+
+	processor := New(mockIMAP, database, rss.NewGenerator(rss.RSSConfig{OutputDir: filepath.Join(tempDir, "feeds")}))
+	processor.SetMaxWorkers(1)
+	require.NoError(t, processor.ProcessFolders(ctx, map[string]string{"INBOX": "inbox"}).Err())
+
+	assert.Equal(t, int32(1), mockIMAP.fetches.Load(), "no message is started after cancellation")
+	stored, err := database.GetFeedMessages(context.Background(), "INBOX", db.RetentionPolicy{})
+	require.NoError(t, err)
+	require.Len(t, stored, 1, "the message being fetched is published and recorded")
+	assert.Equal(t, "one", stored[0].TextBody, "the oldest message is started first")
+
+	// The next run picks up the rest
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+	count, err := database.CountProcessedMessages(context.Background(), "INBOX")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
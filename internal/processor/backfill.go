@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+)
+
+// BackfillOptions limits a backfill to part of a folder
+type BackfillOptions struct {
+	Since     time.Time // only messages dated on or after this day; zero for no limit
+	Until     time.Time // only messages dated before this; zero for no limit
+	Limit     int       // process at most this many messages, newest first; 0 for no limit
+	ChunkSize int       // messages published and recorded together; 0 for the default
+	Progress  func(BackfillProgress)
+}
+
+// BackfillProgress reports how far a backfill has come
+type BackfillProgress struct {
+	Folder  string
+	Feed    string
+	Total   int // unprocessed messages selected for this backfill
+	Done    int // selected messages handled so far
+	Added   int // messages added to the feeds
+	Elapsed time.Duration
+	ETA     time.Duration // estimated time left, from the rate so far
+}
+
+const defaultBackfillChunkSize = 100
+
+// Backfill publishes a folder's unprocessed messages in chunks, newest first. Every chunk
+// is written to the feeds and recorded before the next one starts, so an interrupted
+// backfill continues where it stopped when run again. Cancelling ctx stops it once the
+// messages being fetched are published and recorded. The store is not pruned, as that would
+// drop the records of the messages just backfilled and they would be published again.
+func (p *Processor) Backfill(ctx context.Context, folders map[string]string, folderPath string, opts BackfillOptions) (BackfillProgress, error) {
+	runLog := logger.With("run_id", logging.NewRunID())
+	folders = p.discoverFolders(logging.WithContext(ctx, runLog), folders)
+
+	progress := BackfillProgress{Folder: folderPath, Feed: folders[folderPath]}
+	if progress.Feed == "" {
+		return progress, fmt.Errorf("folder %q is not configured", folderPath)
+	}
+	log := runLog.With("folder", folderPath, "feed", progress.Feed)
+	ctx = logging.WithContext(ctx, log)
+
+	messages, err := p.backfillMessages(ctx, folderPath, opts)
+	if err != nil {
+		p.recordFolderState(context.WithoutCancel(ctx), folderPath, progress.Feed, 0, err)
+		return progress, err
+	}
+	progress.Total = len(messages)
+	log.Info("Starting backfill", "messages", progress.Total)
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultBackfillChunkSize
+	}
+
+	start := time.Now()
+	var backlog int
+	for len(messages) > 0 {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		chunk := messages[:min(chunkSize, len(messages))]
+		messages = messages[len(chunk):]
+
+		report := FolderReport{Folder: folderPath, Feed: progress.Feed}
+		err = p.publishMessages(ctx, &report, chunk)
+		progress.Added += report.New
+		backlog = report.Backlog
+		if err == nil {
+			// A chunk cut short by cancellation is not done
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+
+		progress.Done += len(chunk)
+		progress.Elapsed = time.Since(start)
+		progress.ETA = progress.Elapsed / time.Duration(progress.Done) * time.Duration(progress.Total-progress.Done)
+		log.Debug("Backfilled chunk", "done", progress.Done, "total", progress.Total, "eta", progress.ETA)
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	finishCtx := context.WithoutCancel(ctx)
+	p.recordFolderState(finishCtx, folderPath, progress.Feed, backlog, err)
+	if progress.Added > 0 {
+		p.refreshSavedSearches(finishCtx)
+	}
+
+	if err != nil {
+		return progress, fmt.Errorf("backfill stopped after %d of %d messages: %v", progress.Done, progress.Total, err)
+	}
+	log.Info("Finished backfill", "added", progress.Added, "elapsed", time.Since(start))
+	return progress, nil
+}
+
+// backfillMessages lists the unprocessed messages of folderPath within the options'
+// date range, newest first and limited to opts.Limit
+func (p *Processor) backfillMessages(ctx context.Context, folderPath string, opts BackfillOptions) ([]imap.Message, error) {
+	listed, err := p.client(folderPath).GetMessages(ctx, folderPath, opts.Since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %v", err)
+	}
+
+	// The server only filters by start date
+	inRange := make(map[uint32]imap.Message, len(listed))
+	uids := make([]uint32, 0, len(listed))
+	for _, msg := range listed {
+		if opts.Until.IsZero() || msg.Date.Before(opts.Until) {
+			inRange[msg.UID] = msg
+			uids = append(uids, msg.UID)
+		}
+	}
+
+	fresh, err := p.database.FilterNewUIDs(ctx, folderPath, uids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check processed messages: %v", err)
+	}
+
+	messages := make([]imap.Message, 0, len(fresh))
+	for _, uid := range fresh {
+		messages = append(messages, inRange[uid])
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].Date.Equal(messages[j].Date) {
+			return messages[i].Date.After(messages[j].Date)
+		}
+		return messages[i].UID > messages[j].UID
+	})
+
+	if opts.Limit > 0 && len(messages) > opts.Limit {
+		messages = messages[:opts.Limit]
+	}
+	return messages, nil
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+func TestBackfill(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "backfill.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "Backfill",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	client := &MockIMAPClient{messageContents: map[uint32]*imap.MessageContent{}}
+	for day := 1; day <= 5; day++ {
+		client.messages = append(client.messages, imap.Message{
+			ID:      uint32(day),
+			UID:     uint32(day),
+			Subject: "Day",
+			Date:    time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+		})
+	}
+
+	processor := New(client, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 1}})
+	folders := map[string]string{"INBOX": "inbox"}
+	ctx := context.Background()
+
+	processed := func() []uint32 {
+		fresh, err := database.FilterNewUIDs(context.Background(), "INBOX", []uint32{1, 2, 3, 4, 5})
+		require.NoError(t, err)
+		return fresh
+	}
+
+	// The limit takes the newest messages, published one chunk at a time
+	var reports []BackfillProgress
+	progress, err := processor.Backfill(ctx, folders, "INBOX", BackfillOptions{
+		Limit:     2,
+		ChunkSize: 1,
+		Progress:  func(p BackfillProgress) { reports = append(reports, p) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, progress.Total)
+	assert.Equal(t, 2, progress.Added)
+	require.Len(t, reports, 2)
+	assert.Equal(t, 1, reports[0].Done)
+	assert.Equal(t, "inbox", reports[0].Feed)
+	assert.Zero(t, reports[1].ETA)
+	assert.Equal(t, []uint32{1, 2, 3}, processed())
+
+	// Until is exclusive
+	progress, err = processor.Backfill(ctx, folders, "INBOX", BackfillOptions{Until: time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, progress.Added)
+	assert.Equal(t, []uint32{3}, processed())
+
+	// An interrupted backfill publishes nothing more and can be resumed
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	progress, err = processor.Backfill(cancelled, folders, "INBOX", BackfillOptions{})
+	assert.ErrorContains(t, err, context.Canceled.Error())
+	assert.Zero(t, progress.Added)
+	assert.Zero(t, progress.Done)
+
+	progress, err = processor.Backfill(ctx, folders, "INBOX", BackfillOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, progress.Added)
+	assert.Empty(t, processed(), "backfilled messages stay recorded beyond max_items")
+
+	// Running it again publishes nothing twice
+	progress, err = processor.Backfill(ctx, folders, "INBOX", BackfillOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, progress.Total)
+
+	_, err = processor.Backfill(ctx, folders, "Archive", BackfillOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"context"
+
+	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+	"emailrss/internal/rss"
+)
+
+// BatchContentClient is implemented by IMAP clients that fetch the content of many messages
+// with a few pipelined commands rather than one per message
+type BatchContentClient interface {
+	GetMessageContents(ctx context.Context, folder string, uids []uint32) (map[uint32]*imap.MessageContent, error)
+}
+
+// contentBatchSize bounds how many messages' content is requested and held at once
+const contentBatchSize = 100
+
+// fetchContentBatches fetches the content of messages contentBatchSize at a time. Messages
+// whose content could not be fetched are kept with an empty body, as with GetMessageContent,
+// and counted in the second result.
+// Once ctx is cancelled the batch being fetched is finished and the rest left out.
+func (p *Processor) fetchContentBatches(ctx context.Context, folderPath string, client BatchContentClient, messages []imap.Message) ([]rss.EmailMessage, int) {
+	log := logging.FromContext(ctx, logger)
+
+	result := make([]rss.EmailMessage, 0, len(messages))
+	var contentErrors int
+	for start := 0; start < len(messages) && ctx.Err() == nil; start += contentBatchSize {
+		batch := messages[start:min(start+contentBatchSize, len(messages))]
+		uids := make([]uint32, len(batch))
+		for i, msg := range batch {
+			uids[i] = msg.UID
+		}
+
+		contents, err := client.GetMessageContents(context.WithoutCancel(ctx), folderPath, uids)
+		if err != nil {
+			log.Warn("Failed to get message contents", "messages", len(batch), "error", err)
+		}
+		for _, msg := range batch {
+			content, ok := contents[msg.UID]
+			if !ok {
+				if err == nil {
+					log.Warn("Server returned no content for message", "uid", msg.UID)
+				}
+				metrics.ProcessingErrors.WithLabelValues(folderPath, "content").Inc()
+				contentErrors++
+				content = &imap.MessageContent{}
+			}
+			result = append(result, emailMessage(msg, content))
+		}
+		log.Debug("Fetched message contents", "done", start+len(batch), "total", len(messages))
+	}
+	return result, contentErrors
+}
+
+// emailMessage combines a message's envelope with its content
+func emailMessage(msg imap.Message, content *imap.MessageContent) rss.EmailMessage {
+	return rss.EmailMessage{
+		UID:      msg.UID,
+		Subject:  msg.Subject,
+		From:     msg.From,
+		Date:     msg.Date,
+		TextBody: content.TextBody,
+		HTMLBody: content.HTMLBody,
+	}
+}
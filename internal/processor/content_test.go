@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+// batchIMAPClient fetches content in batches and fails single fetches
+type batchIMAPClient struct {
+	MockIMAPClient
+	batches [][]uint32
+}
+
+func (c *batchIMAPClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
+	return nil, fmt.Errorf("unexpected single fetch of %d", uid)
+}
+
+func (c *batchIMAPClient) GetMessageContents(ctx context.Context, folder string, uids []uint32) (map[uint32]*imap.MessageContent, error) {
+	c.batches = append(c.batches, uids)
+	contents := make(map[uint32]*imap.MessageContent)
+	for _, uid := range uids {
+		if content, ok := c.messageContents[uid]; ok {
+			contents[uid] = content
+		}
+	}
+	return contents, nil
+}
+
+func TestProcessFolderFetchesContentInBatches(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "content.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	client := &batchIMAPClient{MockIMAPClient: MockIMAPClient{
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "Batched body"}},
+	}}
+	for uid := uint32(1); uid <= 150; uid++ {
+		client.messages = append(client.messages, imap.Message{
+			ID: uid, UID: uid, Subject: fmt.Sprintf("Message %d", uid), From: "a@example.com", Date: date.Add(time.Duration(uid) * time.Minute),
+		})
+	}
+
+	outputDir := filepath.Join(tempDir, "feeds")
+	processor := New(client, database, rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            outputDir,
+		Title:                "Batches",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	}))
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 200}})
+
+	report := processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"})
+	require.Len(t, report.Folders, 1)
+	assert.Equal(t, 150, report.Folders[0].New)
+	assert.Equal(t, 149, report.Folders[0].ContentErrors)
+	assert.ErrorContains(t, report.Err(), "149 messages without content", "missing content fails the run")
+
+	require.Len(t, client.batches, 2)
+	assert.Len(t, client.batches[0], contentBatchSize)
+	assert.Len(t, client.batches[1], 50)
+
+	count, err := database.CountProcessedMessages(context.Background(), "INBOX")
+	require.NoError(t, err)
+	assert.Equal(t, 150, count, "messages without content are still published")
+
+	feed, err := os.ReadFile(filepath.Join(outputDir, "inbox.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(feed), "Batched body")
+}
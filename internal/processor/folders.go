@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"emailrss/internal/logging"
+)
+
+// FolderLister is implemented by IMAP clients that can list the server's folders
+type FolderLister interface {
+	ListFolders(ctx context.Context) ([]string, error)
+}
+
+// FolderRule publishes every folder matching Pattern as a feed named after Feed, a
+// template in which {name} is replaced by the pattern's capture groups (or the whole
+// path when it has none) and {path} by the folder path, both sanitized
+type FolderRule struct {
+	Pattern *regexp.Regexp
+	Feed    string
+}
+
+// FolderDiscovery expands folder rules against the server's folders at each run
+type FolderDiscovery struct {
+	Rules   []FolderRule
+	Exclude []*regexp.Regexp // folders matching any of these are never discovered
+}
+
+var nonFeedChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// IsFolderGlob reports whether a configured folder is a glob pattern rather than a folder name
+func IsFolderGlob(folder string) bool {
+	return strings.ContainsAny(folder, "*?")
+}
+
+// GlobRule turns a folder glob into a rule. * matches any characters, including the
+// hierarchy delimiter, and ? matches one character; each becomes a capture group.
+func GlobRule(glob, feed string) FolderRule {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteString("(.*)")
+		case '?':
+			pattern.WriteString("(.)")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return FolderRule{Pattern: regexp.MustCompile(pattern.String()), Feed: feed}
+}
+
+// SetFolderDiscovery configures the folder rules expanded at the start of each run
+func (p *Processor) SetFolderDiscovery(discovery FolderDiscovery) {
+	p.discovery = discovery
+}
+
+// discoverFolders adds the server folders matching the discovery rules to the configured
+// ones. When listing fails only the configured folders are processed.
+func (p *Processor) discoverFolders(ctx context.Context, folders map[string]string) map[string]string {
+	if len(p.discovery.Rules) == 0 {
+		return folders
+	}
+	log := logging.FromContext(ctx, logger)
+
+	lister, ok := p.imapClient.(FolderLister)
+	if !ok {
+		return folders
+	}
+	available, err := lister.ListFolders(ctx)
+	if err != nil {
+		log.Warn("Failed to list folders for discovery", "error", err)
+		return folders
+	}
+
+	reserved := make([]string, 0, len(p.searches))
+	for _, search := range p.searches {
+		reserved = append(reserved, search.Name)
+	}
+
+	expanded := p.discovery.Expand(ctx, available, folders, reserved)
+	if discovered := len(expanded) - len(folders); discovered > 0 {
+		log.Debug("Discovered folders", "count", discovered)
+	}
+	return expanded
+}
+
+// Expand returns folders plus the available folders matching the rules. Configured
+// folders take precedence, and feed names already in use or reserved are never reused.
+func (d FolderDiscovery) Expand(ctx context.Context, available []string, folders map[string]string, reserved []string) map[string]string {
+	log := logging.FromContext(ctx, logger)
+
+	expanded := make(map[string]string, len(folders))
+	taken := make(map[string]bool, len(folders)+len(reserved))
+	for folder, feed := range folders {
+		expanded[folder] = feed
+		taken[feed] = true
+	}
+	for _, name := range reserved {
+		taken[name] = true
+	}
+
+	for _, folder := range slices.Sorted(slices.Values(available)) {
+		if _, ok := expanded[folder]; ok || d.excluded(folder) {
+			continue
+		}
+		for _, rule := range d.Rules {
+			match := rule.Pattern.FindStringSubmatch(folder)
+			if match == nil {
+				continue
+			}
+			feed := feedName(rule.Feed, folder, match[1:])
+			if feed == "" || taken[feed] {
+				log.Warn("Skipping discovered folder without a unique feed name", "folder", folder, "feed", feed)
+				break
+			}
+			expanded[folder] = feed
+			taken[feed] = true
+			break
+		}
+	}
+	return expanded
+}
+
+func (d FolderDiscovery) excluded(folder string) bool {
+	for _, exclude := range d.Exclude {
+		if exclude.MatchString(folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// feedName fills in a feed name template for folder. Placeholders that sanitize to
+// nothing leave an empty name.
+func feedName(template, folder string, groups []string) string {
+	name := sanitizeFeedName(strings.Join(groups, "-"))
+	if len(groups) == 0 {
+		name = sanitizeFeedName(folder)
+	}
+	path := sanitizeFeedName(folder)
+
+	if (strings.Contains(template, "{name}") && name == "") || (strings.Contains(template, "{path}") && path == "") {
+		return ""
+	}
+	return strings.NewReplacer("{name}", name, "{path}", path).Replace(template)
+}
+
+// sanitizeFeedName lower-cases s and replaces everything but letters and digits with dashes
+func sanitizeFeedName(s string) string {
+	return strings.Trim(nonFeedChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/rss"
+)
+
+// listingIMAPClient serves a fixed folder list
+type listingIMAPClient struct {
+	MockIMAPClient
+	folders []string
+	listErr error
+}
+
+func (c *listingIMAPClient) ListFolders(ctx context.Context) ([]string, error) {
+	return c.folders, c.listErr
+}
+
+func TestDiscoverFolders(t *testing.T) {
+	client := &listingIMAPClient{folders: []string{
+		"INBOX",
+		"Lists/golang-nuts",
+		"Lists/Rust Users",
+		"Lists/spam",
+		"Lists/Golang Nuts",
+		"Projects/Apollo/2025",
+		"Trash",
+	}}
+
+	processor := New(client, nil, nil)
+	processor.SetSavedSearches([]SavedSearch{{Name: "trash"}})
+	processor.SetFolderDiscovery(FolderDiscovery{
+		Rules: []FolderRule{
+			GlobRule("Lists/*", "{name}"),
+			{Pattern: regexp.MustCompile(`^Projects/(.+)$`), Feed: "project-{name}"},
+			{Pattern: regexp.MustCompile(`^Projects/`), Feed: "{path}"},
+			{Pattern: regexp.MustCompile(`^Trash$`), Feed: "{path}"},
+		},
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`(?i)/spam$`)},
+	})
+
+	folders := processor.discoverFolders(context.Background(), map[string]string{"INBOX": "inbox", "Lists/golang-nuts": "go"})
+	assert.Equal(t, map[string]string{
+		"INBOX":                "inbox",
+		"Lists/golang-nuts":    "go",
+		"Lists/Golang Nuts":    "golang-nuts",
+		"Lists/Rust Users":     "rust-users",
+		"Projects/Apollo/2025": "project-apollo-2025",
+	}, folders, "configured folders win, excludes apply, the first matching rule names the feed and saved search names are reserved")
+
+	client.listErr = errors.New("connection reset")
+	folders = processor.discoverFolders(context.Background(), map[string]string{"INBOX": "inbox"})
+	assert.Equal(t, map[string]string{"INBOX": "inbox"}, folders, "listing failures fall back to the configured folders")
+}
+
+func TestDiscoverFoldersSkipsDuplicateFeeds(t *testing.T) {
+	client := &listingIMAPClient{folders: []string{"Lists/go-nuts", "Lists/Go Nuts", "Lists/日本"}}
+
+	processor := New(client, nil, nil)
+	processor.SetFolderDiscovery(FolderDiscovery{Rules: []FolderRule{GlobRule("Lists/*", "list-{name}")}})
+
+	folders := processor.discoverFolders(context.Background(), map[string]string{})
+	assert.Equal(t, map[string]string{"Lists/Go Nuts": "list-go-nuts"}, folders)
+}
+
+func TestFeedName(t *testing.T) {
+	assert.Equal(t, "golang-nuts", feedName("{name}", "Lists/Golang Nuts", []string{"Golang Nuts"}))
+	assert.Equal(t, "lists-golang-nuts", feedName("{path}", "Lists/Golang Nuts", nil))
+	assert.Equal(t, "list-a-b", feedName("list-{name}", "Lists/A/B", []string{"A", "B"}))
+	assert.Equal(t, "lists-a", feedName("{name}", "Lists.a", nil), "no groups uses the whole path")
+	assert.Empty(t, feedName("{name}", "Lists/日本", []string{"日本"}))
+}
+
+func TestProcessFoldersDiscoversFolders(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "discovery.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{OutputDir: tempDir, Title: "Discovery"})
+	client := &listingIMAPClient{folders: []string{"INBOX", "Lists/golang-nuts"}}
+
+	processor := New(client, database, rssGenerator)
+	processor.SetFolderDiscovery(FolderDiscovery{Rules: []FolderRule{GlobRule("Lists/*", "{name}")}})
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+
+	states, err := database.GetFolderStates(context.Background())
+	require.NoError(t, err)
+	feeds := map[string]string{}
+	for _, state := range states {
+		feeds[state.Folder] = state.FeedName
+	}
+	assert.Equal(t, map[string]string{"INBOX": "inbox", "Lists/golang-nuts": "golang-nuts"}, feeds)
+}
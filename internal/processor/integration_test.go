@@ -25,7 +25,7 @@ func (m *MockIMAPClient) GetMessages(ctx context.Context, folder string, since t
 	return m.messages, nil
 }
 
-func (m *MockIMAPClient) GetMessageBody(ctx context.Context, uid uint32) (string, error) {
+func (m *MockIMAPClient) GetMessageBody(ctx context.Context, folder string, uid uint32) (string, error) {
 	content := m.messageContents[uid]
 	if content.HTMLBody != "" {
 		return content.HTMLBody, nil
@@ -33,7 +33,7 @@ func (m *MockIMAPClient) GetMessageBody(ctx context.Context, uid uint32) (string
 	return content.TextBody, nil
 }
 
-func (m *MockIMAPClient) GetMessageContent(ctx context.Context, uid uint32) (*imap.MessageContent, error) {
+func (m *MockIMAPClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
 	if content, exists := m.messageContents[uid]; exists {
 		return content, nil
 	}
@@ -185,7 +185,7 @@ func TestBusinessLogicIntegration(t *testing.T) {
 	ctx := context.Background()
 
 	// Run the business logic
-	err = processor.ProcessFolders(ctx, folders)
+	err = processor.ProcessFolders(ctx, folders).Err()
 	require.NoError(t, err)
 
 	// Verify RSS feed was created
@@ -275,13 +275,13 @@ func TestBusinessLogicIntegration(t *testing.T) {
 		var processed bool
 
 		for _, msg := range messages {
-			processed, err = database.IsMessageProcessed("INBOX", msg.UID)
+			processed, err = database.IsMessageProcessed(ctx, "INBOX", msg.UID)
 			assert.NoError(t, err)
 			assert.True(t, processed, "Message UID %d should be marked as processed", msg.UID)
 		}
 
 		// Get processed messages
-		processedMsgs, err2 := database.GetProcessedMessages("INBOX", 10)
+		processedMsgs, err2 := database.GetProcessedMessages(ctx, "INBOX", 10)
 		assert.NoError(t, err2)
 		assert.Len(t, processedMsgs, 4)
 	})
@@ -289,11 +289,11 @@ func TestBusinessLogicIntegration(t *testing.T) {
 	// Test idempotency - running again should not duplicate
 	t.Run("Idempotency", func(t *testing.T) {
 		// Run processing again
-		err = processor.ProcessFolders(ctx, folders)
+		err = processor.ProcessFolders(ctx, folders).Err()
 		require.NoError(t, err)
 
 		// Should still have the same number of processed messages
-		processedMsgs, err := database.GetProcessedMessages("INBOX", 10)
+		processedMsgs, err := database.GetProcessedMessages(ctx, "INBOX", 10)
 		assert.NoError(t, err)
 		assert.Len(t, processedMsgs, 4)
 
@@ -362,7 +362,7 @@ func TestContentProcessingEdgeCases(t *testing.T) {
 	ctx := context.Background()
 
 	// Should handle edge cases without errors
-	err = processor.ProcessFolders(ctx, folders)
+	err = processor.ProcessFolders(ctx, folders).Err()
 	assert.NoError(t, err)
 
 	// Check that feeds were created
@@ -390,17 +390,17 @@ func TestResetFolderIntegration(t *testing.T) {
 
 	proc := New(nil, database, nil)
 
-	err = database.MarkMessageProcessed("INBOX", 1, "Test", "test@example.com", time.Now())
+	err = database.MarkMessageProcessed(context.Background(), "INBOX", 1, "Test", "test@example.com", time.Now())
 	require.NoError(t, err)
 
-	processed, err := database.IsMessageProcessed("INBOX", 1)
+	processed, err := database.IsMessageProcessed(context.Background(), "INBOX", 1)
 	require.NoError(t, err)
 	assert.True(t, processed)
 
-	err = proc.ResetFolder("INBOX")
+	err = proc.ResetFolder(context.Background(), "INBOX")
 	assert.NoError(t, err)
 
-	processed, err = database.IsMessageProcessed("INBOX", 1)
+	processed, err = database.IsMessageProcessed(context.Background(), "INBOX", 1)
 	require.NoError(t, err)
 	assert.False(t, processed)
 }
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/metrics"
+	"emailrss/internal/rss"
+)
+
+func TestProcessFoldersMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "metrics.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	mockIMAP := &MockIMAPClient{
+		messages: []imap.Message{
+			{ID: 1, UID: 1, Subject: "First", From: "a@example.com", Date: time.Now()},
+			{ID: 2, UID: 2, Subject: "Second", From: "b@example.com", Date: time.Now()},
+		},
+		messageContents: map[uint32]*imap.MessageContent{
+			1: {TextBody: "one"},
+			2: {TextBody: "two"},
+		},
+	}
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "Metrics",
+		BaseURL:              "http://localhost:8080",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	processor := New(mockIMAP, database, rssGenerator)
+	processor.SetMaxWorkers(1)
+
+	folder := "Metrics/Folder"
+	before := testutil.ToFloat64(metrics.FolderNewItems.WithLabelValues(folder))
+
+	err = processor.ProcessFolders(context.Background(), map[string]string{folder: "metrics"}).Err()
+	require.NoError(t, err)
+
+	assert.Equal(t, before+2, testutil.ToFloat64(metrics.FolderNewItems.WithLabelValues(folder)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.FolderItems.WithLabelValues(folder)))
+	assert.Greater(t, testutil.ToFloat64(metrics.FolderLastSuccess.WithLabelValues(folder)), float64(0))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.WorkerQueueDepth))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.WorkersBusy))
+}
+
+type failingIMAPClient struct {
+	MockIMAPClient
+}
+
+func (f *failingIMAPClient) GetMessages(ctx context.Context, folder string, since time.Time) ([]imap.Message, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+func TestProcessFoldersRecordsFolderState(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "state.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "State",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	mockIMAP := &MockIMAPClient{
+		messages:        []imap.Message{{ID: 1, UID: 1, Subject: "Hello", From: "a@example.com", Date: time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)}},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "hello"}},
+	}
+	err = New(mockIMAP, database, rssGenerator).ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err()
+	require.NoError(t, err)
+
+	states, err := database.GetFolderStates(context.Background())
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, "inbox", states[0].FeedName)
+	assert.Empty(t, states[0].LastError)
+	assert.False(t, states[0].LastSuccessAt.IsZero())
+	assert.Equal(t, 1, states[0].ItemCount)
+
+	err = New(&failingIMAPClient{}, database, rssGenerator).ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err()
+	assert.ErrorContains(t, err, "connection reset by peer", "the run reports the failed folder")
+
+	states, err = database.GetFolderStates(context.Background())
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Contains(t, states[0].LastError, "connection reset by peer")
+	assert.False(t, states[0].LastSuccessAt.IsZero(), "last success survives a failed run")
+	assert.Equal(t, 1, states[0].ItemCount)
+}
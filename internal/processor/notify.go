@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"emailrss/internal/notify"
+	"emailrss/internal/rss"
+)
+
+// Notifier is told about a feed's new items once they are in the feed and recorded
+type Notifier interface {
+	Notify(ctx context.Context, event notify.Event)
+}
+
+// AddNotifier announces feeds gaining items to notifier
+func (p *Processor) AddNotifier(notifier Notifier) {
+	p.notifiers = append(p.notifiers, notifier)
+}
+
+// WaitNotifications blocks until the notifications of finished runs are delivered, or given
+// up because the context of their run was cancelled
+func (p *Processor) WaitNotifications() {
+	p.notifying.Wait()
+}
+
+// notifyNewItems announces items just added to feedName in the background, so slow
+// receivers do not hold up processing. Cancelling ctx abandons the deliveries.
+func (p *Processor) notifyNewItems(ctx context.Context, feedName string, items []rss.JSONItem) {
+	if len(p.notifiers) == 0 || len(items) == 0 {
+		return
+	}
+
+	summary := fmt.Sprintf("%d new items in %s", len(items), feedName)
+	if len(items) == 1 {
+		summary = fmt.Sprintf("New item in %s: %s", feedName, items[0].Title)
+	}
+
+	event := notify.Event{Feed: feedName, Summary: summary, Items: items}
+	for _, notifier := range p.notifiers {
+		p.notifying.Add(1)
+		go func() {
+			defer p.notifying.Done()
+			notifier.Notify(ctx, event)
+		}()
+	}
+}
+
+// newItems picks the items of newMessages out of a feed's items, which follow feedMessages.
+// They keep the feed's newest first order; messages left out of the feed are not announced.
+func newItems(feedMessages []rss.EmailMessage, items []rss.JSONItem, newMessages []rss.EmailMessage) []rss.JSONItem {
+	isNew := make(map[uint32]bool, len(newMessages))
+	for _, msg := range newMessages {
+		isNew[msg.UID] = true
+	}
+
+	var picked []rss.JSONItem
+	for i, msg := range feedMessages {
+		if i < len(items) && isNew[msg.UID] {
+			picked = append(picked, items[i])
+		}
+	}
+	return picked
+}
@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/notify"
+	"emailrss/internal/rss"
+)
+
+// recordingNotifier keeps the events it is given
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event notify.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+}
+
+// blockingNotifier holds each notification until its context is cancelled
+type blockingNotifier struct {
+	started chan struct{}
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, event notify.Event) {
+	n.started <- struct{}{}
+	<-ctx.Done()
+}
+
+// countingAIHooks counts the summaries it is asked for
+type countingAIHooks struct {
+	calls atomic.Int32
+}
+
+func (h *countingAIHooks) SummarizeMessage(subject, body string) (string, error) {
+	h.calls.Add(1)
+	return body, nil
+}
+
+func TestProcessFoldersNotifiesNewItems(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "notify.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	mockIMAP := &MockIMAPClient{
+		messages: []imap.Message{
+			{ID: 1, UID: 1, Subject: "Older", From: "a@example.com", Date: date},
+			{ID: 2, UID: 2, Subject: "Newer", From: "a@example.com", Date: date.Add(time.Hour)},
+		},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "one"}, 2: {TextBody: "two"}},
+	}
+	notifier := &recordingNotifier{}
+	hooks := &countingAIHooks{}
+	processor := New(mockIMAP, database, rss.NewGenerator(rss.RSSConfig{OutputDir: filepath.Join(tempDir, "feeds")}))
+	processor.SetAIHooks(hooks)
+	processor.AddNotifier(notifier)
+
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+	processor.WaitNotifications()
+	require.Len(t, notifier.events, 1)
+	event := notifier.events[0]
+	assert.Equal(t, "inbox", event.Feed)
+	assert.Equal(t, "2 new items in inbox", event.Summary)
+	require.Len(t, event.Items, 2)
+	assert.Equal(t, "Newer", event.Items[0].Title, "items are newest first")
+	assert.Equal(t, "INBOX_1", event.Items[1].ID)
+	assert.Equal(t, int32(4), hooks.calls.Load(), "notifications reuse the items of the generated feed")
+
+	// Nothing is announced when a run finds nothing new
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+	processor.WaitNotifications()
+	assert.Len(t, notifier.events, 1)
+}
+
+func TestNotificationsDoNotHoldUpProcessing(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "notify.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	mockIMAP := &MockIMAPClient{
+		messages:        []imap.Message{{ID: 1, UID: 1, Subject: "Hello", From: "a@example.com", Date: time.Now()}},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "hello"}},
+	}
+	notifier := &blockingNotifier{started: make(chan struct{}, 1)}
+	processor := New(mockIMAP, database, rss.NewGenerator(rss.RSSConfig{OutputDir: filepath.Join(tempDir, "feeds")}))
+	processor.AddNotifier(notifier)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, processor.ProcessFolders(ctx, map[string]string{"INBOX": "inbox"}).Err())
+	<-notifier.started
+
+	// Cancelling the run's context abandons the notifications still being sent
+	cancel()
+	processor.WaitNotifications()
+}
@@ -3,30 +3,67 @@ package processor
 import (
 	"context"
 	"fmt"
-	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"emailrss/internal/db"
 	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
 	"emailrss/internal/rss"
 )
 
+var logger = logging.For("processor")
+
 // IMAPClient interface defines the methods needed from the IMAP client
 type IMAPClient interface {
 	GetMessages(ctx context.Context, folder string, since time.Time) ([]imap.Message, error)
-	GetMessageContent(ctx context.Context, uid uint32) (*imap.MessageContent, error)
+	GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error)
 }
 
 type Processor struct {
 	imapClient   IMAPClient
-	database     *db.DB
+	database     db.Store
 	rssGenerator *rss.Generator
+	notifiers    []Notifier
+	notifying    sync.WaitGroup // notifications being sent
 	aiHooks      rss.AIHooks
 	maxWorkers   int // Maximum concurrent workers for message processing
+	retention    RetentionConfig
+	lastVacuum   time.Time
+	searches     []SavedSearch
+	actions      map[string]imap.Actions // IMAP actions keyed by folder
+	dedupKeyword string
+	discovery    FolderDiscovery
+	sources      map[string]IMAPClient // local sources used instead of imapClient, keyed by folder
+}
+
+// SavedSearch is a full-text query published as its own feed
+type SavedSearch struct {
+	Name     string   // feed name
+	Query    string   // words that must all match
+	Folders  []string // folders to search; empty searches every folder
+	MaxItems int
+}
+
+// RetentionConfig limits what is kept per feed, both in the store and in generated feeds
+type RetentionConfig struct {
+	Default        db.RetentionPolicy
+	Feeds          map[string]db.RetentionPolicy // overrides keyed by feed name
+	VacuumInterval time.Duration                 // minimum time between vacuums after pruning
 }
 
-func New(imapClient IMAPClient, database *db.DB, rssGenerator *rss.Generator) *Processor {
+// policy returns the retention policy for feedName
+func (c RetentionConfig) policy(feedName string) db.RetentionPolicy {
+	if policy, ok := c.Feeds[feedName]; ok {
+		return policy
+	}
+	return c.Default
+}
+
+func New(imapClient IMAPClient, database db.Store, rssGenerator *rss.Generator) *Processor {
 	return &Processor{
 		imapClient:   imapClient,
 		database:     database,
@@ -47,9 +84,45 @@ func (p *Processor) SetAIHooks(hooks rss.AIHooks) {
 	p.aiHooks = hooks
 }
 
-func (p *Processor) ProcessFolders(ctx context.Context, folders map[string]string) error {
+// SetRetention configures the retention policies enforced after each run
+func (p *Processor) SetRetention(config RetentionConfig) {
+	p.retention = config
+}
+
+// SetSources reads the given folders from local sources, such as mbox files, instead of
+// the IMAP client
+func (p *Processor) SetSources(sources map[string]IMAPClient) {
+	p.sources = sources
+}
+
+// client returns the client that reads folderPath
+func (p *Processor) client(folderPath string) IMAPClient {
+	if source, ok := p.sources[folderPath]; ok {
+		return source
+	}
+	return p.imapClient
+}
+
+// SetSavedSearches configures the search feeds regenerated whenever a run adds messages
+func (p *Processor) SetSavedSearches(searches []SavedSearch) {
+	p.searches = searches
+}
+
+// ProcessFolders publishes the new messages of every folder and reports how each one went.
+// A failing folder does not stop the others; report.Err tells whether any failed.
+// Cancelling ctx stops the run once the messages being fetched are published and recorded.
+// Messages are started oldest first, so the ones left over and the folders not started yet
+// are picked up by the next run.
+func (p *Processor) ProcessFolders(ctx context.Context, folders map[string]string) *RunReport {
+	report := &RunReport{RunID: logging.NewRunID(), StartedAt: time.Now()}
+	runLog := logger.With("run_id", report.RunID)
+	folders = p.discoverFolders(logging.WithContext(ctx, runLog), folders)
+	runLog.Info("Starting processing run", "folders", len(folders))
+
 	// Process folders concurrently but with limited concurrency
+	var pruned, added atomic.Int64
 	var wg sync.WaitGroup
+	var reportMu sync.Mutex
 	semaphore := make(chan struct{}, p.maxWorkers)
 
 	for folderPath, feedName := range folders {
@@ -60,177 +133,416 @@ func (p *Processor) ProcessFolders(ctx context.Context, folders map[string]strin
 			// Acquire semaphore to limit concurrent folder processing
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			folderLog := runLog.With("folder", folderPath, "feed", feedName)
+			folderCtx := logging.WithContext(ctx, folderLog)
+
+			start := time.Now()
+			folder := FolderReport{Folder: folderPath, Feed: feedName}
+			err := p.processFolder(folderCtx, &folder)
+			added.Add(int64(folder.New))
+			metrics.FolderProcessingDuration.WithLabelValues(folderPath).Observe(time.Since(start).Seconds())
+			if err != nil && ctx.Err() != nil {
+				folderLog.Info("Folder processing interrupted", "error", err)
+			} else if err != nil {
+				folderLog.Error("Failed to process folder", "error", err)
+			} else if ctx.Err() == nil {
+				p.deleteExpired(folderCtx, folderPath)
+			}
+
+			// Bookkeeping completes even when the run is being cancelled
+			finishCtx := context.WithoutCancel(folderCtx)
+			folder.Pruned = p.enforceRetention(finishCtx, folderPath, feedName)
+			pruned.Add(int64(folder.Pruned))
+			p.recordFolderState(finishCtx, folderPath, feedName, folder.Backlog, err)
 
-			if err := p.processFolder(ctx, folderPath, feedName); err != nil {
-				log.Printf("Failed to process folder %s: %v", folderPath, err)
+			if err != nil {
+				folder.Error = err.Error()
 			}
+			folder.Duration = time.Since(start).Seconds()
+			reportMu.Lock()
+			report.Folders = append(report.Folders, folder)
+			reportMu.Unlock()
 		}(folderPath, feedName)
 	}
 
 	wg.Wait()
-	return nil
+
+	if ctx.Err() != nil {
+		report.Cancelled = true
+		runLog.Info("Processing run cancelled")
+	}
+	finishCtx := logging.WithContext(context.WithoutCancel(ctx), runLog)
+
+	if added.Load() > 0 {
+		p.refreshSavedSearches(finishCtx)
+	}
+
+	if pruned.Load() > 0 && ctx.Err() == nil && time.Since(p.lastVacuum) >= p.retention.VacuumInterval {
+		if err := p.database.Vacuum(finishCtx); err != nil {
+			runLog.Warn("Failed to vacuum database", "error", err)
+		} else {
+			p.lastVacuum = time.Now()
+			runLog.Debug("Vacuumed database")
+		}
+	}
+
+	report.finish()
+	runLog.Info("Finished processing run", "succeeded", report.Succeeded, "failed", report.Failed, "added", added.Load())
+	return report
 }
 
-func (p *Processor) processFolder(ctx context.Context, folderPath, feedName string) error {
-	log.Printf("Processing folder: %s -> %s", folderPath, feedName)
+// refreshSavedSearches re-evaluates every saved search and regenerates its feeds
+func (p *Processor) refreshSavedSearches(ctx context.Context) {
+	for _, search := range p.searches {
+		searchCtx := logging.WithContext(ctx, logging.FromContext(ctx, logger).With("feed", search.Name))
+		log := logging.FromContext(searchCtx, logger)
+
+		stored, err := p.database.SearchMessages(searchCtx, db.SearchQuery{
+			Text:    search.Query,
+			Folders: search.Folders,
+			Limit:   search.MaxItems,
+		})
+		if err != nil {
+			log.Error("Failed to run saved search", "error", err)
+			metrics.ProcessingErrors.WithLabelValues("", "search").Inc()
+			continue
+		}
 
-	lastProcessed, err := p.database.GetLastProcessedDate(folderPath)
+		if _, err := p.generateFeedsAsync(searchCtx, "search: "+search.Query, search.Name, feedItems(stored)); err != nil {
+			metrics.ProcessingErrors.WithLabelValues("", "search").Inc()
+			continue
+		}
+		log.Debug("Regenerated saved search feed", "items", len(stored))
+	}
+}
+
+// enforceRetention prunes the stored messages of a folder and returns how many were removed
+func (p *Processor) enforceRetention(ctx context.Context, folderPath, feedName string) int {
+	log := logging.FromContext(ctx, logger)
+
+	pruned, err := p.database.PruneMessages(ctx, folderPath, p.retention.policy(feedName))
+	if err != nil {
+		log.Warn("Failed to enforce retention", "error", err)
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "retention").Inc()
+		return 0
+	}
+	if pruned > 0 {
+		log.Info("Pruned messages outside retention", "count", pruned)
+	}
+	return pruned
+}
+
+// recordFolderState publishes the outcome of a folder run to the database and metrics
+func (p *Processor) recordFolderState(ctx context.Context, folderPath, feedName string, backlog int, runErr error) {
+	log := logging.FromContext(ctx, logger)
+	now := time.Now()
+	state := db.FolderState{
+		Folder:     folderPath,
+		FeedName:   feedName,
+		LastSyncAt: now,
+		Backlog:    backlog,
+	}
+
+	if runErr != nil {
+		state.LastError = runErr.Error()
+	} else {
+		state.LastSuccessAt = now
+		metrics.FolderLastSuccess.WithLabelValues(folderPath).Set(float64(now.Unix()))
+	}
+
+	count, err := p.database.CountProcessedMessages(ctx, folderPath)
+	if err != nil {
+		log.Warn("Failed to count processed messages", "error", err)
+	} else {
+		state.ItemCount = count
+		metrics.FolderItems.WithLabelValues(folderPath).Set(float64(count))
+	}
+
+	if err := p.database.UpdateFolderState(ctx, state); err != nil {
+		log.Warn("Failed to record folder state", "error", err)
+	}
+}
+
+// processFolder processes the new messages of report.Folder, counting them in report
+func (p *Processor) processFolder(ctx context.Context, report *FolderReport) error {
+	log := logging.FromContext(ctx, logger)
+	log.Info("Processing folder")
+	folderPath := report.Folder
+
+	lastProcessed, err := p.database.GetLastProcessedDate(ctx, folderPath)
 	if err != nil {
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "state").Inc()
 		return fmt.Errorf("failed to get last processed date: %v", err)
 	}
 
-	messages, err := p.imapClient.GetMessages(ctx, folderPath, lastProcessed)
+	messages, err := p.client(folderPath).GetMessages(ctx, folderPath, lastProcessed)
 	if err != nil {
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "fetch").Inc()
 		return fmt.Errorf("failed to get messages: %v", err)
 	}
 
-	log.Printf("Retrieved %d messages from IMAP for processing", len(messages))
+	log.Info("Retrieved messages", "count", len(messages))
+	report.Listed = len(messages)
+
+	return p.publishMessages(ctx, report, messages)
+}
+
+// publishMessages fetches the content of the messages not processed yet, adds them to the
+// folder's feeds and records them. It counts the new messages in report, along with those
+// left for a later run and those published without content.
+func (p *Processor) publishMessages(ctx context.Context, report *FolderReport, messages []imap.Message) error {
+	log := logging.FromContext(ctx, logger)
+	folderPath, feedName := report.Folder, report.Feed
 
 	// Process messages concurrently
-	newMessages, err := p.processMessagesAsync(ctx, folderPath, messages)
+	newMessages, contentErrors, err := p.processMessagesAsync(ctx, folderPath, messages)
 	if err != nil {
 		return fmt.Errorf("failed to process messages: %v", err)
 	}
 
+	// Messages already fetched are published even if ctx is cancelled meanwhile; their
+	// notifications still end with runCtx
+	runCtx := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	// Tagging is left to the next run when this one is cut short
+	if runCtx.Err() == nil {
+		p.tagKnownMessages(ctx, folderPath, messages)
+	}
+
 	if len(newMessages) == 0 {
-		log.Printf("No new messages in folder %s", folderPath)
+		log.Info("No new messages")
 		return nil
 	}
+	report.Backlog = len(newMessages)
 
-	// For now, just use the new messages with bodies for the RSS feed
-	// TODO: In the future, we could store message bodies in the database
-	// and retrieve them for older messages as well
+	// New messages are only recorded once the feeds are written, so a failed run is retried
+	feedMessages, err := p.feedMessages(ctx, folderPath, feedName, newMessages)
+	if err != nil {
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "feed").Inc()
+		return fmt.Errorf("failed to load feed messages: %v", err)
+	}
 
-	log.Printf("Generating RSS and JSON feeds with %d new messages (all have bodies)", len(newMessages))
+	log.Debug("Generating RSS and JSON feeds", "new", len(newMessages), "items", len(feedMessages))
 
 	// Generate RSS and JSON feeds concurrently
-	err = p.generateFeedsAsync(ctx, folderPath, feedName, newMessages)
+	items, err := p.generateFeedsAsync(ctx, folderPath, feedName, feedMessages)
 	if err != nil {
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "feed").Inc()
 		return fmt.Errorf("failed to generate feeds: %v", err)
 	}
 
-	log.Printf("Processed %d new messages for folder %s", len(newMessages), folderPath)
+	if err := p.recordMessages(ctx, folderPath, newMessages); err != nil {
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "store").Inc()
+		return fmt.Errorf("failed to record messages: %v", err)
+	}
+
+	uids := make([]uint32, 0, len(newMessages))
+	for _, msg := range newMessages {
+		uids = append(uids, msg.UID)
+	}
+	p.applyActions(ctx, folderPath, uids)
+	p.notifyNewItems(runCtx, feedName, newItems(feedMessages, items, newMessages))
+
+	metrics.FolderNewItems.WithLabelValues(folderPath).Add(float64(len(newMessages)))
+	log.Info("Processed new messages", "count", len(newMessages))
+	report.New, report.Backlog = len(newMessages), 0
+	report.ContentErrors = contentErrors
 	return nil
 }
 
-func (p *Processor) ResetFolder(folderPath string) error {
-	if err := p.database.ClearFolderHistory(folderPath); err != nil {
+// feedMessages combines the stored messages of a folder with new, not yet recorded ones
+// and applies the feed's retention policy, so feeds keep older items
+func (p *Processor) feedMessages(ctx context.Context, folderPath, feedName string, newMessages []rss.EmailMessage) ([]rss.EmailMessage, error) {
+	policy := p.retention.policy(feedName)
+	stored, err := p.database.GetFeedMessages(ctx, folderPath, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	isNew := make(map[uint32]bool, len(newMessages))
+	combined := make([]db.StoredMessage, 0, len(newMessages)+len(stored))
+	for _, msg := range newMessages {
+		isNew[msg.UID] = true
+		combined = append(combined, db.StoredMessage{
+			ProcessedMessage: db.ProcessedMessage{
+				Folder:  folderPath,
+				UID:     msg.UID,
+				Subject: msg.Subject,
+				From:    msg.From,
+				Date:    msg.Date,
+			},
+			TextBody: msg.TextBody,
+			HTMLBody: msg.HTMLBody,
+		})
+	}
+	for _, msg := range stored {
+		if !isNew[msg.UID] {
+			combined = append(combined, msg)
+		}
+	}
+
+	sort.SliceStable(combined, func(i, j int) bool {
+		return combined[i].Date.After(combined[j].Date)
+	})
+	return feedItems(policy.Apply(combined)), nil
+}
+
+// recordMessages marks new messages processed and stores their bodies in one transaction
+func (p *Processor) recordMessages(ctx context.Context, folderPath string, messages []rss.EmailMessage) error {
+	batch := make([]db.NewMessage, 0, len(messages))
+	for _, msg := range messages {
+		batch = append(batch, db.NewMessage{
+			UID:      msg.UID,
+			Subject:  msg.Subject,
+			From:     msg.From,
+			Date:     msg.Date,
+			TextBody: msg.TextBody,
+			HTMLBody: msg.HTMLBody,
+		})
+	}
+	return p.database.MarkMessagesProcessed(ctx, folderPath, batch)
+}
+
+// feedItems converts stored messages into feed items
+func feedItems(stored []db.StoredMessage) []rss.EmailMessage {
+	items := make([]rss.EmailMessage, 0, len(stored))
+	for _, msg := range stored {
+		items = append(items, rss.EmailMessage{
+			Folder:   msg.Folder,
+			UID:      msg.UID,
+			Subject:  msg.Subject,
+			From:     msg.From,
+			Date:     msg.Date,
+			TextBody: msg.TextBody,
+			HTMLBody: msg.HTMLBody,
+		})
+	}
+	return items
+}
+
+func (p *Processor) ResetFolder(ctx context.Context, folderPath string) error {
+	if err := p.database.ClearFolderHistory(ctx, folderPath); err != nil {
 		return fmt.Errorf("failed to clear folder history: %v", err)
 	}
 
-	log.Printf("Reset history for folder: %s", folderPath)
+	logger.Info("Reset folder history", "folder", folderPath)
 	return nil
 }
 
-// processMessagesAsync processes messages concurrently with limited concurrency
-func (p *Processor) processMessagesAsync(ctx context.Context, folderPath string, messages []imap.Message) ([]rss.EmailMessage, error) {
-	// Channel to collect processed messages
-	resultChan := make(chan rss.EmailMessage, len(messages))
-	errorChan := make(chan error, len(messages))
-
-	// Worker pool for message processing
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, p.maxWorkers)
+// processMessagesAsync skips already processed messages and fetches the content of the
+// new ones concurrently with limited concurrency, returning them along with the number
+// whose content could not be fetched. Nothing is recorded in the database.
+// Messages are started oldest first. Once ctx is cancelled no further message is started
+// and the ones being fetched are finished, so an interrupted run returns the oldest new
+// messages and the rest are still listed by the next run's search since the last date.
+func (p *Processor) processMessagesAsync(ctx context.Context, folderPath string, messages []imap.Message) ([]rss.EmailMessage, int, error) {
+	log := logging.FromContext(ctx, logger)
+
+	// Look up which messages are new with one query instead of one per message
+	uids := make([]uint32, 0, len(messages))
+	for _, msg := range messages {
+		uids = append(uids, msg.UID)
+	}
+	fresh, err := p.database.FilterNewUIDs(ctx, folderPath, uids)
+	if err != nil {
+		metrics.ProcessingErrors.WithLabelValues(folderPath, "dedup").Inc()
+		return nil, 0, fmt.Errorf("failed to check processed messages: %v", err)
+	}
+	isNew := make(map[uint32]bool, len(fresh))
+	for _, uid := range fresh {
+		isNew[uid] = true
+	}
+	log.Debug("Skipping already processed messages", "count", len(messages)-len(fresh))
 
-	// Process each message concurrently
+	pending := make([]imap.Message, 0, len(fresh))
 	for _, msg := range messages {
-		wg.Add(1)
-		go func(msg imap.Message) {
-			defer wg.Done()
+		if isNew[msg.UID] {
+			pending = append(pending, msg)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Date.Before(pending[j].Date)
+	})
 
-			// Acquire semaphore to limit concurrent operations
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+	if batch, ok := p.client(folderPath).(BatchContentClient); ok {
+		result, contentErrors := p.fetchContentBatches(ctx, folderPath, batch, pending)
+		return result, contentErrors, nil
+	}
 
-			// Check if message is already processed
-			processed, checkErr := p.database.IsMessageProcessed(folderPath, msg.UID)
-			if checkErr != nil {
-				log.Printf("Failed to check if message UID %d is processed: %v", msg.UID, checkErr)
-				errorChan <- checkErr
-				return
-			}
+	// Channel to collect processed messages
+	resultChan := make(chan rss.EmailMessage, len(fresh))
 
-			if processed {
-				log.Printf("Message UID %d already processed, skipping", msg.UID)
-				return
-			}
+	// Worker pool for fetching message content
+	var wg sync.WaitGroup
+	var contentErrors atomic.Int64
+	semaphore := make(chan struct{}, p.maxWorkers)
 
-			log.Printf("Processing message UID %d: %s", msg.UID, msg.Subject)
+	for _, msg := range pending {
+		// Acquire semaphore before starting a worker so messages start in date order
+		metrics.WorkerQueueDepth.Inc()
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		metrics.WorkerQueueDepth.Dec()
+		if ctx.Err() != nil {
+			break
+		}
 
-			// Get message content
-			content, contentErr := p.imapClient.GetMessageContent(ctx, msg.UID)
+		wg.Add(1)
+		metrics.WorkersBusy.Inc()
+		go func(msg imap.Message) {
+			defer func() {
+				metrics.WorkersBusy.Dec()
+				<-semaphore
+				wg.Done()
+			}()
+
+			msgLog := log.With("uid", msg.UID)
+			msgLog.Debug("Processing message", "subject", msg.Subject)
+
+			// Get message content; a started message is finished during shutdown
+			msgCtx := logging.WithContext(context.WithoutCancel(ctx), msgLog)
+			content, contentErr := p.client(folderPath).GetMessageContent(msgCtx, folderPath, msg.UID)
 			if contentErr != nil {
-				log.Printf("Failed to get message content for UID %d: %v", msg.UID, contentErr)
+				msgLog.Warn("Failed to get message content", "error", contentErr)
+				metrics.ProcessingErrors.WithLabelValues(folderPath, "content").Inc()
+				contentErrors.Add(1)
 				// Create empty content if error
 				content = &imap.MessageContent{TextBody: "", HTMLBody: ""}
 			}
 
-			// Create RSS message
-			rssMsg := rss.EmailMessage{
-				UID:      msg.UID,
-				Subject:  msg.Subject,
-				From:     msg.From,
-				Date:     msg.Date,
-				TextBody: content.TextBody,
-				HTMLBody: content.HTMLBody,
-			}
-
-			// Mark message as processed
-			if markErr := p.database.MarkMessageProcessed(folderPath, msg.UID, msg.Subject, msg.From, msg.Date); markErr != nil {
-				log.Printf("Failed to mark message UID %d as processed: %v", msg.UID, markErr)
-				errorChan <- markErr
-				return
-			}
-
-			// Send result
-			resultChan <- rssMsg
+			resultChan <- emailMessage(msg, content)
 		}(msg)
 	}
 
-	// Close channels when all workers are done
+	// Close the channel when all workers are done
 	go func() {
 		wg.Wait()
 		close(resultChan)
-		close(errorChan)
 	}()
 
-	// Collect results
 	var newMessages []rss.EmailMessage
-	var errors []error
-
-	for {
-		select {
-		case msg, ok := <-resultChan:
-			if !ok {
-				resultChan = nil
-			} else {
-				newMessages = append(newMessages, msg)
-			}
-		case err, ok := <-errorChan:
-			if !ok {
-				errorChan = nil
-			} else {
-				errors = append(errors, err)
-			}
-		}
-
-		if resultChan == nil && errorChan == nil {
-			break
-		}
+	for msg := range resultChan {
+		newMessages = append(newMessages, msg)
 	}
 
-	// Log any errors but don't fail the entire operation
-	for _, err := range errors {
-		log.Printf("Error during message processing: %v", err)
-	}
-
-	log.Printf("Processed %d new messages concurrently", len(newMessages))
-	return newMessages, nil
+	log.Debug("Fetched new messages concurrently", "new", len(newMessages))
+	return newMessages, int(contentErrors.Load()), nil
 }
 
-// generateFeedsAsync generates RSS and JSON feeds concurrently
-func (p *Processor) generateFeedsAsync(ctx context.Context, folderPath, feedName string, messages []rss.EmailMessage) error {
+// generateFeedsAsync generates RSS and JSON feeds concurrently and returns the JSON feed's
+// items, one per message
+func (p *Processor) generateFeedsAsync(ctx context.Context, folderPath, feedName string, messages []rss.EmailMessage) ([]rss.JSONItem, error) {
+	log := logging.FromContext(ctx, logger)
+
 	var wg sync.WaitGroup
+	var items []rss.JSONItem
 	var rssErr, jsonErr error
 
 	// Generate RSS feed
@@ -239,7 +551,7 @@ func (p *Processor) generateFeedsAsync(ctx context.Context, folderPath, feedName
 		defer wg.Done()
 		rssErr = p.rssGenerator.GenerateFeed(folderPath, feedName, messages, p.aiHooks)
 		if rssErr != nil {
-			log.Printf("Failed to generate RSS feed for %s: %v", folderPath, rssErr)
+			log.Error("Failed to generate RSS feed", "error", rssErr)
 		}
 	}()
 
@@ -247,9 +559,9 @@ func (p *Processor) generateFeedsAsync(ctx context.Context, folderPath, feedName
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		jsonErr = p.rssGenerator.GenerateJSONFeed(folderPath, feedName, messages, p.aiHooks)
+		items, jsonErr = p.rssGenerator.GenerateJSONFeed(folderPath, feedName, messages, p.aiHooks)
 		if jsonErr != nil {
-			log.Printf("Failed to generate JSON feed for %s: %v", folderPath, jsonErr)
+			log.Error("Failed to generate JSON feed", "error", jsonErr)
 		}
 	}()
 
@@ -257,12 +569,12 @@ func (p *Processor) generateFeedsAsync(ctx context.Context, folderPath, feedName
 
 	// Return error if either feed generation failed
 	if rssErr != nil {
-		return fmt.Errorf("RSS feed generation failed: %v", rssErr)
+		return nil, fmt.Errorf("RSS feed generation failed: %v", rssErr)
 	}
 	if jsonErr != nil {
-		return fmt.Errorf("JSON feed generation failed: %v", jsonErr)
+		return nil, fmt.Errorf("JSON feed generation failed: %v", jsonErr)
 	}
 
-	log.Printf("Successfully generated both RSS and JSON feeds for %s", folderPath)
-	return nil
+	log.Debug("Generated RSS and JSON feeds")
+	return items, nil
 }
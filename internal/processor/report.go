@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FolderReport is the outcome of processing one folder during a run
+type FolderReport struct {
+	Folder        string  `json:"folder"`
+	Feed          string  `json:"feed"`
+	Listed        int     `json:"listed"`         // messages the server returned since the last processed date
+	New           int     `json:"new"`            // messages added to the feeds
+	Backlog       int     `json:"backlog"`        // new messages left for the next run
+	ContentErrors int     `json:"content_errors"` // messages published without their content
+	Pruned        int     `json:"pruned"`
+	Duration      float64 `json:"duration_seconds"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Failed reports whether the folder could not be processed or lost message content
+func (f FolderReport) Failed() bool {
+	return f.Error != "" || f.ContentErrors > 0
+}
+
+// RunReport summarizes a processing run, one entry per folder in folder order
+type RunReport struct {
+	RunID      string         `json:"run_id"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Duration   float64        `json:"duration_seconds"`
+	Cancelled  bool           `json:"cancelled"` // folders not started before cancellation are missing
+	Folders    []FolderReport `json:"folders"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+}
+
+// finish records the end of the run, sorts the folders and counts failures
+func (r *RunReport) finish() {
+	r.FinishedAt = time.Now()
+	r.Duration = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	sort.Slice(r.Folders, func(i, j int) bool {
+		return r.Folders[i].Folder < r.Folders[j].Folder
+	})
+	r.Succeeded, r.Failed = 0, 0
+	for _, folder := range r.Folders {
+		if folder.Failed() {
+			r.Failed++
+		} else {
+			r.Succeeded++
+		}
+	}
+}
+
+// Err returns an error naming the failed folders, or nil when every folder succeeded
+func (r *RunReport) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	var first FolderReport
+	for _, folder := range r.Folders {
+		if folder.Failed() {
+			first = folder
+			break
+		}
+	}
+	reason := first.Error
+	if reason == "" {
+		reason = fmt.Sprintf("%d messages without content", first.ContentErrors)
+	}
+	return fmt.Errorf("%d of %d folders failed; %s: %s", r.Failed, len(r.Folders), first.Folder, reason)
+}
+
+// WriteFile writes the report as JSON to path, replacing it in one step so that monitoring
+// never reads a partial report
+func (r *RunReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run report: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write run report: %v", err)
+	}
+	return nil
+}
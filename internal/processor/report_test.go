@@ -0,0 +1,67 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+func TestProcessFoldersReport(t *testing.T) {
+	tempDir := t.TempDir()
+	database, err := db.New(filepath.Join(tempDir, "report.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	mockIMAP := &MockIMAPClient{
+		messages: []imap.Message{
+			{ID: 1, UID: 1, Subject: "One", From: "a@example.com", Date: date},
+			{ID: 2, UID: 2, Subject: "Two", From: "a@example.com", Date: date.Add(time.Hour)},
+		},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "one"}, 2: {TextBody: "two"}},
+	}
+	processor := New(mockIMAP, database, rss.NewGenerator(rss.RSSConfig{OutputDir: filepath.Join(tempDir, "feeds")}))
+	processor.SetSources(map[string]IMAPClient{"Broken": &failingIMAPClient{}})
+
+	report := processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox", "Broken": "broken"})
+	assert.NotEmpty(t, report.RunID)
+	assert.False(t, report.Cancelled)
+	assert.Equal(t, 1, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+
+	require.Len(t, report.Folders, 2, "folders are sorted")
+	broken, inbox := report.Folders[0], report.Folders[1]
+	assert.Equal(t, "Broken", broken.Folder)
+	assert.Contains(t, broken.Error, "connection reset by peer")
+	assert.Equal(t, FolderReport{Folder: "INBOX", Feed: "inbox", Listed: 2, New: 2, Duration: inbox.Duration}, inbox)
+
+	err = report.Err()
+	require.Error(t, err, "one failed folder fails the run")
+	assert.Contains(t, err.Error(), "1 of 2 folders failed; Broken:")
+
+	// A second run finds nothing new and succeeds without the broken folder
+	report = processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"})
+	require.NoError(t, report.Err())
+	assert.Equal(t, 2, report.Folders[0].Listed)
+	assert.Zero(t, report.Folders[0].New)
+
+	path := filepath.Join(tempDir, "report.json")
+	require.NoError(t, report.WriteFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, report.RunID, decoded["run_id"])
+	assert.Equal(t, float64(1), decoded["succeeded"])
+	assert.NotContains(t, string(data), `"error"`, "errors are only written for failed folders")
+}
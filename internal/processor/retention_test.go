@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+func TestProcessFoldersEnforcesRetention(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "retention.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "Retention",
+		BaseURL:              "http://localhost:8080",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	newest := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	mockIMAP := &MockIMAPClient{messageContents: map[uint32]*imap.MessageContent{}}
+	for i := 1; i <= 5; i++ {
+		uid := uint32(i)
+		mockIMAP.messages = append(mockIMAP.messages, imap.Message{
+			ID:      uid,
+			UID:     uid,
+			Subject: fmt.Sprintf("Message %d", i),
+			From:    "sender@example.com",
+			Date:    newest.Add(-time.Duration(5-i) * 24 * time.Hour),
+		})
+		mockIMAP.messageContents[uid] = &imap.MessageContent{TextBody: fmt.Sprintf("body %d", i)}
+	}
+
+	processor := New(mockIMAP, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{
+		Default: db.RetentionPolicy{MaxItems: 10},
+		Feeds:   map[string]db.RetentionPolicy{"alerts": {MaxItems: 2}},
+	})
+
+	err = processor.ProcessFolders(context.Background(), map[string]string{"Alerts": "alerts"}).Err()
+	require.NoError(t, err)
+
+	count, err := database.CountProcessedMessages(context.Background(), "Alerts")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "store is pruned to the feed's max_items")
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "alerts.json"))
+	require.NoError(t, err)
+
+	var feed rss.JSONFeed
+	require.NoError(t, json.Unmarshal(data, &feed))
+	require.Len(t, feed.Items, 2)
+	assert.Equal(t, "Message 5", feed.Items[0].Title)
+	assert.Equal(t, "Message 4", feed.Items[1].Title)
+	assert.Equal(t, "body 5", feed.Items[0].ContentText)
+}
+
+func TestFeedIncludesPreviouslyStoredMessages(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "history.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "History",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	first := time.Date(2025, 8, 8, 10, 0, 0, 0, time.UTC)
+	mockIMAP := &MockIMAPClient{
+		messages:        []imap.Message{{ID: 1, UID: 1, Subject: "Yesterday", From: "a@example.com", Date: first}},
+		messageContents: map[uint32]*imap.MessageContent{1: {TextBody: "old"}, 2: {TextBody: "new"}},
+	}
+	processor := New(mockIMAP, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 10}})
+
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+
+	mockIMAP.messages = []imap.Message{{ID: 2, UID: 2, Subject: "Today", From: "b@example.com", Date: first.Add(24 * time.Hour)}}
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "inbox.json"))
+	require.NoError(t, err)
+
+	var feed rss.JSONFeed
+	require.NoError(t, json.Unmarshal(data, &feed))
+	require.Len(t, feed.Items, 2, "earlier items stay in the feed")
+	assert.Equal(t, "Today", feed.Items[0].Title)
+	assert.Equal(t, "old", feed.Items[1].ContentText)
+}
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/imap"
+	"emailrss/internal/rss"
+)
+
+func TestSavedSearchFeeds(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "search.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            tempDir,
+		Title:                "Search",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	date := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	mockIMAP := &MockIMAPClient{
+		messages: []imap.Message{
+			{ID: 1, UID: 1, Subject: "Disk alert", From: "monitor@example.com", Date: date},
+			{ID: 2, UID: 2, Subject: "Lunch", From: "friend@example.com", Date: date.Add(time.Hour)},
+		},
+		messageContents: map[uint32]*imap.MessageContent{
+			1: {TextBody: "db-01 is almost full"},
+			2: {TextBody: "Pizza or an alert-free salad?"},
+		},
+	}
+
+	processor := New(mockIMAP, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 10}})
+	processor.SetSavedSearches([]SavedSearch{
+		{Name: "alerts", Query: "alert", MaxItems: 10},
+		{Name: "full-disks", Query: "full", Folders: []string{"Other"}},
+	})
+
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "alerts.json"))
+	require.NoError(t, err)
+	var feed rss.JSONFeed
+	require.NoError(t, json.Unmarshal(data, &feed))
+	require.Len(t, feed.Items, 2)
+	assert.Equal(t, "Lunch", feed.Items[0].Title)
+	assert.Equal(t, "INBOX_2", feed.Items[0].ID)
+	assert.Equal(t, "Disk alert", feed.Items[1].Title)
+	assert.FileExists(t, filepath.Join(tempDir, "alerts.xml"))
+
+	data, err = os.ReadFile(filepath.Join(tempDir, "full-disks.json"))
+	require.NoError(t, err)
+	feed = rss.JSONFeed{}
+	require.NoError(t, json.Unmarshal(data, &feed))
+	assert.Empty(t, feed.Items, "searches are limited to their folders")
+
+	// Runs that add nothing leave the search feeds alone
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "alerts.json")))
+	require.NoError(t, processor.ProcessFolders(context.Background(), map[string]string{"INBOX": "inbox"}).Err())
+	assert.NoFileExists(t, filepath.Join(tempDir, "alerts.json"))
+}
@@ -0,0 +1,71 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/rss"
+	"emailrss/internal/source"
+)
+
+// TestProcessFoldersFromLocalSources runs the whole pipeline without an IMAP server
+func TestProcessFoldersFromLocalSources(t *testing.T) {
+	tempDir := t.TempDir()
+
+	database, err := db.New(filepath.Join(tempDir, "sources.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	outputDir := filepath.Join(tempDir, "feeds")
+	rssGenerator := rss.NewGenerator(rss.RSSConfig{
+		OutputDir:            outputDir,
+		Title:                "Sources",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+	})
+
+	mboxPath := filepath.Join(tempDir, "archive.mbox")
+	require.NoError(t, os.WriteFile(mboxPath, []byte("From a@example.com Sat Aug  9 10:00:00 2025\n"+
+		"From: a@example.com\nSubject: Archived post\nDate: Sat, 09 Aug 2025 10:00:00 +0000\n\nFrom the archive\n\n"), 0644))
+
+	maildir := filepath.Join(tempDir, "Maildir")
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(maildir, sub), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(maildir, "new", "1754733600.M1P1.host"), []byte(
+		"From: b@example.com\nSubject: Local delivery\nDate: Sat, 09 Aug 2025 11:00:00 +0000\n\nFrom the Maildir\n"), 0644))
+
+	processor := New(nil, database, rssGenerator)
+	processor.SetRetention(RetentionConfig{Default: db.RetentionPolicy{MaxItems: 10}})
+	processor.SetSources(map[string]IMAPClient{
+		"archive": source.NewMbox(mboxPath),
+		"local":   source.NewMaildir(maildir),
+	})
+
+	folders := map[string]string{"archive": "archive", "local": "local"}
+	require.NoError(t, processor.ProcessFolders(context.Background(), folders).Err())
+
+	archive, err := os.ReadFile(filepath.Join(outputDir, "archive.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(archive), "Archived post")
+	assert.Contains(t, string(archive), "From the archive")
+
+	local, err := os.ReadFile(filepath.Join(outputDir, "local.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(local), "Local delivery")
+
+	// A second run finds nothing new
+	require.NoError(t, processor.ProcessFolders(context.Background(), folders).Err())
+	count, err := database.CountProcessedMessages(context.Background(), "archive")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -52,7 +52,7 @@ func (m *ValidationMockIMAPClient) GetMessages(ctx context.Context, folder strin
 	return messages, nil
 }
 
-func (m *ValidationMockIMAPClient) GetMessageContent(ctx context.Context, uid uint32) (*imap.MessageContent, error) {
+func (m *ValidationMockIMAPClient) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
 	for _, sample := range m.samples {
 		if sample.UID == uid {
 			return &imap.MessageContent{
@@ -147,7 +147,7 @@ func runValidationTest(t *testing.T, inputFile, expectedFile string) {
 		"INBOX": "validation",
 	}
 
-	err = processor.ProcessFolders(ctx, folders)
+	err = processor.ProcessFolders(ctx, folders).Err()
 	require.NoError(t, err, "Failed to process folders")
 
 	// Read generated RSS feed
@@ -2,17 +2,21 @@ package rss
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"html"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gorilla/feeds"
+
+	"emailrss/internal/logging"
 )
 
+var logger = logging.For("rss")
+
 type Generator struct {
 	config RSSConfig
 }
@@ -27,9 +31,12 @@ type RSSConfig struct {
 	MaxRSSTextLength     int
 	MaxSummaryLength     int
 	RemoveCSS            bool
+	Hub                  string // WebSub hub advertised by the feeds; empty for none
 }
 
 type EmailMessage struct {
+	// Folder is the message's source folder when it differs from the feed's, as in search feeds
+	Folder   string
 	UID      uint32
 	Subject  string
 	From     string
@@ -55,9 +62,16 @@ type JSONFeed struct {
 	HomePageURL string     `json:"home_page_url,omitempty"`
 	FeedURL     string     `json:"feed_url,omitempty"`
 	Description string     `json:"description,omitempty"`
+	Hubs        []JSONHub  `json:"hubs,omitempty"`
 	Items       []JSONItem `json:"items"`
 }
 
+// JSONHub is an endpoint readers subscribe to for real-time updates of a JSON feed
+type JSONHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
 type JSONItem struct {
 	ID            string   `json:"id"`
 	URL           string   `json:"url,omitempty"`
@@ -73,6 +87,38 @@ type Author struct {
 	Name string `json:"name,omitempty"`
 }
 
+// atomLink is an atom:link element in an RSS channel, used for WebSub discovery
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// rssChannel adds atom:link elements to the channel gorilla/feeds builds
+type rssChannel struct {
+	XMLName xml.Name   `xml:"channel"`
+	Links   []atomLink `xml:"atom:link"`
+	*feeds.RssFeed
+}
+
+// rssDocument is the <rss> element with the Atom namespace declared
+type rssDocument struct {
+	XMLName          xml.Name `xml:"rss"`
+	Version          string   `xml:"version,attr"`
+	ContentNamespace string   `xml:"xmlns:content,attr"`
+	AtomNamespace    string   `xml:"xmlns:atom,attr"`
+	Channel          rssChannel
+}
+
+func (d rssDocument) FeedXml() interface{} {
+	return d
+}
+
+// FeedURL returns the URL the server publishes a feed at; ext is "xml" or "json"
+func FeedURL(baseURL, feedName, ext string) string {
+	return fmt.Sprintf("%s/feeds/%s.%s", strings.TrimSuffix(baseURL, "/"), feedName, ext)
+}
+
 func NewGenerator(config RSSConfig) *Generator {
 	return &Generator{
 		config: config,
@@ -92,38 +138,7 @@ func (g *Generator) GenerateFeed(folder, feedName string, messages []EmailMessag
 	}
 
 	for _, msg := range messages {
-		log.Printf("Processing RSS item for UID %d, text: %d chars, html: %d chars",
-			msg.UID, len(msg.TextBody), len(msg.HTMLBody))
-
-		// Choose the best content for RSS (prefer HTML if available)
-		var contentForSummary string
-		if msg.HTMLBody != "" {
-			contentForSummary = msg.HTMLBody
-		} else {
-			contentForSummary = msg.TextBody
-		}
-
-		summary, err := aiHooks.SummarizeMessage(msg.Subject, contentForSummary)
-		if err != nil {
-			log.Printf("AI summarization failed for UID %d: %v, using original content", msg.UID, err)
-			summary = contentForSummary
-		}
-
-		// log.Printf("Summary for UID %d length: %d", msg.UID, len(summary))
-
-		processedContent := g.processContent(summary)
-		// log.Printf("Processed content for UID %d length: %d", msg.UID, len(processedContent))
-
-		item := &feeds.Item{
-			Title:       msg.Subject,
-			Link:        &feeds.Link{Href: fmt.Sprintf("%s/message/%d", g.config.BaseURL, msg.UID)},
-			Description: processedContent,
-			Author:      &feeds.Author{Name: msg.From, Email: msg.From},
-			Created:     msg.Date,
-			Id:          fmt.Sprintf("%s_%d", folder, msg.UID),
-		}
-
-		feed.Items = append(feed.Items, item)
+		feed.Items = append(feed.Items, g.rssItem(folder, msg, aiHooks))
 	}
 
 	if err := os.MkdirAll(g.config.OutputDir, 0755); err != nil {
@@ -132,19 +147,62 @@ func (g *Generator) GenerateFeed(folder, feedName string, messages []EmailMessag
 
 	feedPath := filepath.Join(g.config.OutputDir, fmt.Sprintf("%s.xml", feedName))
 
-	rssXML, err := feed.ToRss()
+	// The self link names the topic WebSub subscribers follow
+	channel := rssChannel{RssFeed: (&feeds.Rss{Feed: feed}).RssFeed()}
+	if g.config.Hub != "" {
+		channel.Links = append(channel.Links, atomLink{Rel: "hub", Href: g.config.Hub})
+	}
+	channel.Links = append(channel.Links, atomLink{Rel: "self", Href: FeedURL(g.config.BaseURL, feedName, "xml"), Type: "application/rss+xml"})
+
+	rssXML, err := feeds.ToXML(rssDocument{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		AtomNamespace:    "http://www.w3.org/2005/Atom",
+		Channel:          channel,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to generate RSS XML: %v", err)
 	}
 
-	if err := os.WriteFile(feedPath, []byte(rssXML), 0644); err != nil {
+	if err := writeFileAtomic(feedPath, []byte(rssXML), 0644); err != nil {
 		return fmt.Errorf("failed to write RSS feed file: %v", err)
 	}
 
 	return nil
 }
 
-func (g *Generator) GenerateJSONFeed(folder, feedName string, messages []EmailMessage, aiHooks AIHooks) error {
+// rssItem converts msg into an RSS item
+func (g *Generator) rssItem(folder string, msg EmailMessage, aiHooks AIHooks) *feeds.Item {
+	logger.Debug("Processing RSS item", "uid", msg.UID, "text_bytes", len(msg.TextBody), "html_bytes", len(msg.HTMLBody))
+
+	// Choose the best content for RSS (prefer HTML if available)
+	var contentForSummary string
+	if msg.HTMLBody != "" {
+		contentForSummary = msg.HTMLBody
+	} else {
+		contentForSummary = msg.TextBody
+	}
+
+	summary, err := aiHooks.SummarizeMessage(msg.Subject, contentForSummary)
+	if err != nil {
+		logger.Warn("AI summarization failed, using original content", "folder", folder, "uid", msg.UID, "error", err)
+		summary = contentForSummary
+	}
+
+	processedContent := g.processContent(summary)
+
+	return &feeds.Item{
+		Title:       msg.Subject,
+		Link:        &feeds.Link{Href: fmt.Sprintf("%s/message/%d", g.config.BaseURL, msg.UID)},
+		Description: processedContent,
+		Author:      &feeds.Author{Name: msg.From, Email: msg.From},
+		Created:     msg.Date,
+		Id:          itemID(folder, msg),
+	}
+}
+
+// GenerateJSONFeed writes the JSON feed of messages and returns its items, one per message
+func (g *Generator) GenerateJSONFeed(folder, feedName string, messages []EmailMessage, aiHooks AIHooks) ([]JSONItem, error) {
 	if aiHooks == nil {
 		aiHooks = &stubAIHooks{}
 	}
@@ -153,89 +211,129 @@ func (g *Generator) GenerateJSONFeed(folder, feedName string, messages []EmailMe
 		Version:     "https://jsonfeed.org/version/1.1",
 		Title:       fmt.Sprintf("%s - %s", g.config.Title, feedName),
 		HomePageURL: g.config.BaseURL,
-		FeedURL:     fmt.Sprintf("%s/%s.json", g.config.BaseURL, feedName),
+		FeedURL:     FeedURL(g.config.BaseURL, feedName, "json"),
 		Description: fmt.Sprintf("JSON feed for email folder: %s", folder),
 		Items:       []JSONItem{},
 	}
+	if g.config.Hub != "" {
+		jsonFeed.Hubs = []JSONHub{{Type: "WebSub", URL: g.config.Hub}}
+	}
 
 	for _, msg := range messages {
-		log.Printf("Processing JSON feed item for UID %d, text: %d chars, html: %d chars",
-			msg.UID, len(msg.TextBody), len(msg.HTMLBody))
+		jsonFeed.Items = append(jsonFeed.Items, g.jsonItem(folder, msg, aiHooks))
+	}
 
-		var contentHTML, contentText string
+	if err := os.MkdirAll(g.config.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
 
-		// Process HTML content if available
-		if msg.HTMLBody != "" {
-			summary, err := aiHooks.SummarizeMessage(msg.Subject, msg.HTMLBody)
-			if err != nil {
-				log.Printf("AI summarization failed for HTML UID %d: %v, using original", msg.UID, err)
-				summary = msg.HTMLBody
-			}
-			contentHTML = g.processHTMLContent(summary)
-		}
+	feedPath := filepath.Join(g.config.OutputDir, fmt.Sprintf("%s.json", feedName))
 
-		// Process text content if available
-		if msg.TextBody != "" {
-			summary, err := aiHooks.SummarizeMessage(msg.Subject, msg.TextBody)
-			if err != nil {
-				log.Printf("AI summarization failed for text UID %d: %v, using original", msg.UID, err)
-				summary = msg.TextBody
-			}
-			contentText = g.processTextContent(summary)
-		}
+	jsonData, err := json.MarshalIndent(jsonFeed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JSON feed: %v", err)
+	}
 
-		// If we only have one type, derive the other
-		if contentHTML == "" && contentText != "" {
-			contentHTML = fmt.Sprintf("<pre>%s</pre>", html.EscapeString(contentText))
-		} else if contentText == "" && contentHTML != "" {
-			contentText = g.stripHTML(contentHTML)
-		}
+	if err := writeFileAtomic(feedPath, jsonData, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write JSON feed file: %v", err)
+	}
+
+	logger.Debug("Generated JSON feed", "folder", folder, "items", len(jsonFeed.Items), "path", feedPath)
+	return jsonFeed.Items, nil
+}
+
+// jsonItem converts msg into a JSON Feed item
+func (g *Generator) jsonItem(folder string, msg EmailMessage, aiHooks AIHooks) JSONItem {
+	logger.Debug("Processing JSON feed item", "uid", msg.UID, "text_bytes", len(msg.TextBody), "html_bytes", len(msg.HTMLBody))
 
-		// log.Printf("Final content for UID %d - HTML: %d chars, Text: %d chars",
-		// 	msg.UID, len(contentHTML), len(contentText))
-
-		item := JSONItem{
-			ID:            fmt.Sprintf("%s_%d", folder, msg.UID),
-			URL:           fmt.Sprintf("%s/message/%d", g.config.BaseURL, msg.UID),
-			Title:         msg.Subject,
-			ContentHTML:   contentHTML,
-			ContentText:   contentText,
-			DatePublished: msg.Date.Format(time.RFC3339),
-			Authors:       []Author{{Name: msg.From}},
+	var contentHTML, contentText string
+
+	// Process HTML content if available
+	if msg.HTMLBody != "" {
+		summary, err := aiHooks.SummarizeMessage(msg.Subject, msg.HTMLBody)
+		if err != nil {
+			logger.Warn("AI summarization failed for HTML part, using original", "folder", folder, "uid", msg.UID, "error", err)
+			summary = msg.HTMLBody
 		}
+		contentHTML = g.processHTMLContent(summary)
+	}
 
-		// Create summary from first 5 lines of text content
-		if contentText != "" {
-			item.Summary = g.createSummaryFromText(contentText)
+	// Process text content if available
+	if msg.TextBody != "" {
+		summary, err := aiHooks.SummarizeMessage(msg.Subject, msg.TextBody)
+		if err != nil {
+			logger.Warn("AI summarization failed for text part, using original", "folder", folder, "uid", msg.UID, "error", err)
+			summary = msg.TextBody
 		}
+		contentText = g.processTextContent(summary)
+	}
 
-		jsonFeed.Items = append(jsonFeed.Items, item)
+	// If we only have one type, derive the other
+	if contentHTML == "" && contentText != "" {
+		contentHTML = fmt.Sprintf("<pre>%s</pre>", html.EscapeString(contentText))
+	} else if contentText == "" && contentHTML != "" {
+		contentText = g.stripHTML(contentHTML)
 	}
 
-	if err := os.MkdirAll(g.config.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+	item := JSONItem{
+		ID:            itemID(folder, msg),
+		URL:           fmt.Sprintf("%s/message/%d", g.config.BaseURL, msg.UID),
+		Title:         msg.Subject,
+		ContentHTML:   contentHTML,
+		ContentText:   contentText,
+		DatePublished: msg.Date.Format(time.RFC3339),
+		Authors:       []Author{{Name: msg.From}},
 	}
 
-	feedPath := filepath.Join(g.config.OutputDir, fmt.Sprintf("%s.json", feedName))
+	// Create summary from first 5 lines of text content
+	if contentText != "" {
+		item.Summary = g.createSummaryFromText(contentText)
+	}
 
-	jsonData, err := json.MarshalIndent(jsonFeed, "", "  ")
+	return item
+}
+
+// ItemPreview is how a message would appear in the RSS and JSON feeds
+type ItemPreview struct {
+	RSSItem  string // the RSS <item> element
+	JSONItem JSONItem
+}
+
+// PreviewItem renders msg as an RSS and a JSON Feed item without writing any feed
+func (g *Generator) PreviewItem(folder string, msg EmailMessage, aiHooks AIHooks) (*ItemPreview, error) {
+	if aiHooks == nil {
+		aiHooks = &stubAIHooks{}
+	}
+
+	rss := (&feeds.Rss{Feed: &feeds.Feed{Items: []*feeds.Item{g.rssItem(folder, msg, aiHooks)}}}).RssFeed()
+	rssItem, err := xml.MarshalIndent(rss.Items[0], "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to generate JSON feed: %v", err)
+		return nil, fmt.Errorf("failed to generate RSS item XML: %v", err)
 	}
 
-	if err := os.WriteFile(feedPath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write JSON feed file: %v", err)
+	return &ItemPreview{
+		RSSItem:  string(rssItem),
+		JSONItem: g.jsonItem(folder, msg, aiHooks),
+	}, nil
+}
+
+// JSONItems converts messages into the items folder's JSON feed holds for them, for
+// live streams of new items
+func (g *Generator) JSONItems(folder string, messages []EmailMessage, aiHooks AIHooks) []JSONItem {
+	if aiHooks == nil {
+		aiHooks = &stubAIHooks{}
 	}
 
-	log.Printf("Generated JSON feed with %d items at %s", len(jsonFeed.Items), feedPath)
-	return nil
+	items := make([]JSONItem, 0, len(messages))
+	for _, msg := range messages {
+		items = append(items, g.jsonItem(folder, msg, aiHooks))
+	}
+	return items
 }
 
 func (g *Generator) processContent(content string) string {
-	// log.Printf("processContent input: %d characters", len(content))
-
 	if len(content) == 0 {
-		log.Printf("processContent: empty content, returning empty string")
+		logger.Debug("processContent: empty content, returning empty string")
 		return ""
 	}
 
@@ -245,7 +343,7 @@ func (g *Generator) processContent(content string) string {
 		strings.Contains(strings.ToLower(content), "<div") ||
 		strings.Contains(strings.ToLower(content), "<p>")
 
-	log.Printf("processContent: content detected as HTML: %v", isHTML)
+	logger.Debug("processContent: detected content type", "html", isHTML, "bytes", len(content))
 
 	var result string
 	if isHTML {
@@ -258,7 +356,6 @@ func (g *Generator) processContent(content string) string {
 		} else {
 			result = processedHTML
 		}
-		// log.Printf("processContent: HTML content processed, output length: %d", len(result))
 	} else {
 		// Content is plain text, wrap in <pre> to preserve formatting
 		escapedContent := html.EscapeString(content)
@@ -273,7 +370,6 @@ func (g *Generator) processContent(content string) string {
 			}
 			result = fmt.Sprintf("<pre>%s</pre>", innerContent)
 		}
-		// log.Printf("processContent: text content processed, output length: %d", len(result))
 	}
 
 	return result
@@ -369,8 +465,6 @@ func (g *Generator) hexToInt(hex string) (int, error) {
 // }
 
 func (g *Generator) processHTMLContent(content string) string {
-	// log.Printf("processHTMLContent input: %d characters", len(content))
-
 	if len(content) == 0 {
 		return ""
 	}
@@ -383,13 +477,10 @@ func (g *Generator) processHTMLContent(content string) string {
 		content = content[:g.config.MaxHTMLContentLength] + "..."
 	}
 
-	// log.Printf("processHTMLContent output: %d characters", len(content))
 	return content
 }
 
 func (g *Generator) processTextContent(content string) string {
-	// log.Printf("processTextContent input: %d characters", len(content))
-
 	if len(content) == 0 {
 		return ""
 	}
@@ -399,7 +490,6 @@ func (g *Generator) processTextContent(content string) string {
 		content = content[:g.config.MaxTextContentLength] + "..."
 	}
 
-	// log.Printf("processTextContent output: %d characters", len(content))
 	return content
 }
 
@@ -473,8 +563,6 @@ func (g *Generator) removeCSS(htmlContent string) string {
 		return htmlContent
 	}
 
-	// log.Printf("Removing CSS from HTML content (%d chars)", len(htmlContent))
-
 	// Remove <style> tags and their content
 	result := htmlContent
 
@@ -647,10 +735,60 @@ func (g *Generator) removeCSS(htmlContent string) string {
 		result = strings.ReplaceAll(result, pattern, "")
 	}
 
-	log.Printf("CSS removal complete, result: %d chars", len(result))
+	logger.Debug("CSS removal complete", "bytes", len(result))
 	return result
 }
 
+// writeFileAtomic replaces path with data so readers see either the old or the new file,
+// never a partial one. The data is synced before the rename and the rename before returning.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	// Temp files are hidden and lack a feed extension, so the server never lists or serves them
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// itemID identifies msg uniquely across folders
+func itemID(folder string, msg EmailMessage) string {
+	if msg.Folder != "" {
+		folder = msg.Folder
+	}
+	return fmt.Sprintf("%s_%d", folder, msg.UID)
+}
+
 func (g *Generator) GetFeedPath(feedName string) string {
 	return filepath.Join(g.config.OutputDir, fmt.Sprintf("%s.xml", feedName))
 }
@@ -1,6 +1,7 @@
 package rss
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"os"
 	"path/filepath"
@@ -370,3 +371,108 @@ func TestGenerateFeedEmptyMessages(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, rss.Channel.Items, 0)
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "inbox.xml")
+
+	require.NoError(t, writeFileAtomic(path, []byte("first"), 0644))
+	require.NoError(t, writeFileAtomic(path, []byte("second"), 0644))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temp files are left behind")
+
+	err = writeFileAtomic(filepath.Join(dir, "missing", "inbox.xml"), []byte("x"), 0644)
+	assert.Error(t, err)
+}
+
+func TestPreviewItem(t *testing.T) {
+	tmpDir := filepath.Join(t.TempDir(), "feeds")
+	generator := NewGenerator(RSSConfig{
+		OutputDir:            tmpDir,
+		Title:                "Test RSS",
+		BaseURL:              "http://localhost:8080",
+		MaxHTMLContentLength: 8000,
+		MaxTextContentLength: 3000,
+		MaxRSSHTMLLength:     5000,
+		MaxRSSTextLength:     2900,
+		MaxSummaryLength:     300,
+		RemoveCSS:            true,
+	})
+
+	msg := EmailMessage{
+		UID:      7,
+		Subject:  "Preview",
+		From:     "sender@example.com",
+		Date:     time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC),
+		HTMLBody: `<p style="color:red">Hello</p>`,
+	}
+	preview, err := generator.PreviewItem("INBOX", msg, nil)
+	require.NoError(t, err)
+
+	var item struct {
+		Title string `xml:"title"`
+		GUID  string `xml:"guid"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(preview.RSSItem), &item))
+	assert.Equal(t, "Preview", item.Title)
+	assert.Equal(t, "INBOX_7", item.GUID)
+
+	assert.Equal(t, "INBOX_7", preview.JSONItem.ID)
+	assert.NotContains(t, preview.JSONItem.ContentHTML, "style=", "the preview applies the same cleaning as the feeds")
+	assert.Equal(t, "Hello", preview.JSONItem.ContentText)
+
+	_, err = os.Stat(tmpDir)
+	assert.True(t, os.IsNotExist(err), "previewing writes nothing")
+}
+
+func TestGenerateFeedWebSubLinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	generator := NewGenerator(RSSConfig{
+		OutputDir: tmpDir,
+		Title:     "Test RSS",
+		BaseURL:   "https://feeds.example.com/",
+		Hub:       "https://hub.example.com/",
+	})
+	messages := []EmailMessage{{UID: 1, Subject: "Hello", From: "a@example.com", Date: time.Now(), TextBody: "hi"}}
+
+	require.NoError(t, generator.GenerateFeed("INBOX", "inbox", messages, nil))
+	data, err := os.ReadFile(filepath.Join(tmpDir, "inbox.xml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `xmlns:atom="http://www.w3.org/2005/Atom"`)
+
+	var rss struct {
+		Channel struct {
+			Links []struct {
+				Rel  string `xml:"rel,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"http://www.w3.org/2005/Atom link"`
+			Items []struct{} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &rss))
+	require.Len(t, rss.Channel.Links, 2)
+	assert.Equal(t, "hub", rss.Channel.Links[0].Rel)
+	assert.Equal(t, "https://hub.example.com/", rss.Channel.Links[0].Href)
+	assert.Equal(t, "self", rss.Channel.Links[1].Rel)
+	assert.Equal(t, "https://feeds.example.com/feeds/inbox.xml", rss.Channel.Links[1].Href)
+	assert.Len(t, rss.Channel.Items, 1)
+
+	_, err = generator.GenerateJSONFeed("INBOX", "inbox", messages, nil)
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(tmpDir, "inbox.json"))
+	require.NoError(t, err)
+	var feed JSONFeed
+	require.NoError(t, json.Unmarshal(data, &feed))
+	assert.Equal(t, "https://feeds.example.com/feeds/inbox.json", feed.FeedURL)
+	assert.Equal(t, []JSONHub{{Type: "WebSub", URL: "https://hub.example.com/"}}, feed.Hubs)
+}
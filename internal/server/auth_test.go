@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTokenStore struct {
+	tokens map[string]string // token -> feed
+	err    error
+}
+
+func (f *fakeTokenStore) ValidateFeedToken(ctx context.Context, feed, token string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.tokens[token] == feed, nil
+}
+
+func newAuthTestServer(t *testing.T) *Server {
+	tmpDir := t.TempDir()
+	createTestFeed(t, tmpDir, "inbox.xml")
+	createTestFeed(t, tmpDir, "inbox.json")
+	createTestFeed(t, tmpDir, "work.xml")
+
+	server := New(ServerConfig{
+		Host:     "localhost",
+		Port:     8080,
+		FeedsDir: tmpDir,
+		Auth: AuthConfig{
+			Enabled: true,
+			Realm:   "EmailRSS",
+			Users: []User{
+				{Username: "admin", Password: "secret"},
+				{Username: "reader", Password: "pass", Feeds: []string{"inbox"}},
+			},
+		},
+	})
+	server.SetTokenStore(&fakeTokenStore{tokens: map[string]string{"inbox-token": "inbox"}})
+	return server
+}
+
+func TestHandleFeedAuth(t *testing.T) {
+	server := newAuthTestServer(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		username       string
+		password       string
+		expectedStatus int
+	}{
+		{name: "no credentials", path: "/feeds/inbox.xml", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong password", path: "/feeds/inbox.xml", username: "admin", password: "nope", expectedStatus: http.StatusUnauthorized},
+		{name: "admin reads any feed", path: "/feeds/work.xml", username: "admin", password: "secret", expectedStatus: http.StatusOK},
+		{name: "reader allowed feed", path: "/feeds/inbox.xml", username: "reader", password: "pass", expectedStatus: http.StatusOK},
+		{name: "reader allowed json feed", path: "/feeds/inbox.json", username: "reader", password: "pass", expectedStatus: http.StatusOK},
+		{name: "reader denied feed", path: "/feeds/work.xml", username: "reader", password: "pass", expectedStatus: http.StatusForbidden},
+		{name: "valid token", path: "/feeds/inbox.xml?token=inbox-token", expectedStatus: http.StatusOK},
+		{name: "valid token json", path: "/feeds/inbox.json?token=inbox-token", expectedStatus: http.StatusOK},
+		{name: "token for other feed", path: "/feeds/work.xml?token=inbox-token", expectedStatus: http.StatusUnauthorized},
+		{name: "unknown token", path: "/feeds/inbox.xml?token=bogus", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			w := httptest.NewRecorder()
+
+			server.handleFeed(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Contains(t, resp.Header.Get("WWW-Authenticate"), `Basic realm="EmailRSS"`)
+			}
+		})
+	}
+}
+
+func TestHandleFeedTokenStoreError(t *testing.T) {
+	server := newAuthTestServer(t)
+	server.SetTokenStore(&fakeTokenStore{err: errors.New("database is locked")})
+
+	req := httptest.NewRequest("GET", "/feeds/inbox.xml?token=inbox-token", nil)
+	w := httptest.NewRecorder()
+
+	server.handleFeed(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func TestHandleRootAuth(t *testing.T) {
+	server := newAuthTestServer(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	server.handleRoot(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+
+	req = httptest.NewRequest("GET", "/?token=inbox-token", nil)
+	w = httptest.NewRecorder()
+	server.handleRoot(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode, "tokens only grant access to feeds, not the listing")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("reader", "pass")
+	w = httptest.NewRecorder()
+	server.handleRoot(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	body := w.Body.String()
+	assert.Contains(t, body, "inbox.xml")
+	assert.Contains(t, body, "inbox.json")
+	assert.NotContains(t, body, "work.xml")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("admin", "secret")
+	w = httptest.NewRecorder()
+	server.handleRoot(w, req)
+	assert.Contains(t, w.Body.String(), "work.xml")
+}
+
+func TestUserCanAccess(t *testing.T) {
+	all := User{Username: "admin"}
+	assert.True(t, all.CanAccess("anything"))
+
+	limited := User{Username: "reader", Feeds: []string{"inbox", "work"}}
+	assert.True(t, limited.CanAccess("inbox"))
+	assert.True(t, limited.CanAccess("work"))
+	assert.False(t, limited.CanAccess("personal"))
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"emailrss/internal/db"
+)
+
+// StatusStore exposes the processing state recorded by the processor
+type StatusStore interface {
+	Ping(ctx context.Context) error
+	GetFolderStates(ctx context.Context) ([]db.FolderState, error)
+}
+
+// SetStatusStore enables database checks in /readyz and the /status endpoint
+func (s *Server) SetStatusStore(store StatusStore) {
+	s.status = store
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type folderStatus struct {
+	Folder        string     `json:"folder"`
+	Feed          string     `json:"feed"`
+	LastSync      *time.Time `json:"last_sync,omitempty"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Backlog       int        `json:"backlog"`
+	ItemCount     int        `json:"item_count"`
+	LastRunFailed bool       `json:"last_run_failed"`
+}
+
+type statusResponse struct {
+	Service string         `json:"service"`
+	Folders []folderStatus `json:"folders"`
+}
+
+// handleReady reports whether the server can serve traffic: the database must
+// answer queries and the feeds directory must be writable
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	response := readinessResponse{Status: "ok", Checks: map[string]string{}}
+
+	if s.status != nil {
+		if err := s.status.Ping(r.Context()); err != nil {
+			logger.Warn("Readiness check: database unavailable", "error", err)
+			response.Checks["database"] = err.Error()
+			response.Status = "unavailable"
+		} else {
+			response.Checks["database"] = "ok"
+		}
+	}
+
+	if err := checkWritable(s.config.FeedsDir); err != nil {
+		logger.Warn("Readiness check: feeds directory not writable", "error", err)
+		response.Checks["feeds_dir"] = err.Error()
+		response.Status = "unavailable"
+	} else {
+		response.Checks["feeds_dir"] = "ok"
+	}
+
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
+
+// handleStatus reports the last sync, last error, backlog and item count of every folder
+// whose feed the user may read
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var user *User
+	if s.config.Auth.Enabled {
+		user = s.authenticateUser(r)
+		if user == nil {
+			s.requestCredentials(w)
+			return
+		}
+	}
+
+	if s.status == nil {
+		http.Error(w, "Status is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	states, err := s.status.GetFolderStates(r.Context())
+	if err != nil {
+		logger.Error("Failed to read folder states", "error", err)
+		http.Error(w, "Failed to read folder states", http.StatusInternalServerError)
+		return
+	}
+
+	response := statusResponse{Service: "emailrss", Folders: []folderStatus{}}
+	for _, state := range states {
+		if user != nil && !user.CanAccess(state.FeedName) {
+			continue
+		}
+		response.Folders = append(response.Folders, folderStatus{
+			Folder:        state.Folder,
+			Feed:          state.FeedName,
+			LastSync:      optionalTime(state.LastSyncAt),
+			LastSuccess:   optionalTime(state.LastSuccessAt),
+			LastError:     state.LastError,
+			Backlog:       state.Backlog,
+			ItemCount:     state.ItemCount,
+			LastRunFailed: state.LastError != "",
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// checkWritable verifies a file can be created in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("Failed to write JSON response", "error", err)
+	}
+}
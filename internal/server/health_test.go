@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+)
+
+type fakeStatusStore struct {
+	pingErr error
+	states  []db.FolderState
+}
+
+func (f *fakeStatusStore) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f *fakeStatusStore) GetFolderStates(ctx context.Context) ([]db.FolderState, error) {
+	return f.states, nil
+}
+
+func TestHandleHealthz(t *testing.T) {
+	server := New(ServerConfig{FeedsDir: t.TempDir()})
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.JSONEq(t, `{"status": "ok", "service": "emailrss"}`, w.Body.String())
+}
+
+func TestHandleReady(t *testing.T) {
+	tests := []struct {
+		name           string
+		feedsDir       string
+		pingErr        error
+		expectedStatus int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "all checks pass",
+			feedsDir:       t.TempDir(),
+			expectedStatus: http.StatusOK,
+			expectedChecks: map[string]string{"database": "ok", "feeds_dir": "ok"},
+		},
+		{
+			name:           "database unavailable",
+			feedsDir:       t.TempDir(),
+			pingErr:        errors.New("database is locked"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": "database is locked", "feeds_dir": "ok"},
+		},
+		{
+			name:           "feeds directory missing",
+			feedsDir:       "/nonexistent/feeds",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(ServerConfig{FeedsDir: tt.feedsDir})
+			server.SetStatusStore(&fakeStatusStore{pingErr: tt.pingErr})
+
+			w := httptest.NewRecorder()
+			server.handleReady(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Result().StatusCode)
+
+			var response readinessResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedChecks != nil {
+				assert.Equal(t, tt.expectedChecks, response.Checks)
+			} else {
+				assert.NotEqual(t, "ok", response.Checks["feeds_dir"])
+			}
+		})
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	lastSuccess := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	server := New(ServerConfig{FeedsDir: t.TempDir()})
+	server.SetStatusStore(&fakeStatusStore{states: []db.FolderState{
+		{
+			Folder:        "INBOX",
+			FeedName:      "inbox",
+			LastSyncAt:    lastSuccess,
+			LastSuccessAt: lastSuccess,
+			ItemCount:     42,
+		},
+		{
+			Folder:     "INBOX/Work",
+			FeedName:   "work",
+			LastSyncAt: lastSuccess.Add(time.Hour),
+			LastError:  "failed to login",
+			Backlog:    3,
+		},
+	}})
+
+	w := httptest.NewRecorder()
+	server.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+
+	var response statusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Folders, 2)
+
+	assert.Equal(t, "inbox", response.Folders[0].Feed)
+	assert.Equal(t, 42, response.Folders[0].ItemCount)
+	assert.False(t, response.Folders[0].LastRunFailed)
+	require.NotNil(t, response.Folders[0].LastSuccess)
+	assert.True(t, lastSuccess.Equal(*response.Folders[0].LastSuccess))
+
+	assert.True(t, response.Folders[1].LastRunFailed)
+	assert.Equal(t, "failed to login", response.Folders[1].LastError)
+	assert.Equal(t, 3, response.Folders[1].Backlog)
+	assert.Nil(t, response.Folders[1].LastSuccess)
+}
+
+func TestHandleStatusRequiresAuth(t *testing.T) {
+	server := newAuthTestServer(t)
+	server.SetStatusStore(&fakeStatusStore{})
+
+	w := httptest.NewRecorder()
+	server.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.SetBasicAuth("admin", "secret")
+	w = httptest.NewRecorder()
+	server.handleStatus(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.JSONEq(t, `{"service": "emailrss", "folders": []}`, w.Body.String())
+}
+
+func TestHandleStatusHonoursFeedACLs(t *testing.T) {
+	server := newAuthTestServer(t)
+	server.SetStatusStore(&fakeStatusStore{states: []db.FolderState{
+		{Folder: "INBOX", FeedName: "inbox"},
+		{Folder: "INBOX/Work", FeedName: "work", LastError: "failed to login"},
+	}})
+
+	status := func(username, password string) []string {
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.SetBasicAuth(username, password)
+		w := httptest.NewRecorder()
+		server.handleStatus(w, req)
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+		var response statusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		var feeds []string
+		for _, folder := range response.Folders {
+			feeds = append(feeds, folder.Feed)
+		}
+		return feeds
+	}
+
+	assert.Equal(t, []string{"inbox", "work"}, status("admin", "secret"))
+	assert.Equal(t, []string{"inbox"}, status("reader", "pass"), "folders of other feeds are hidden")
+}
+
+func TestHandleStatusWithoutStore(t *testing.T) {
+	server := New(ServerConfig{FeedsDir: t.TempDir()})
+
+	w := httptest.NewRecorder()
+	server.handleStatus(w, httptest.NewRequest("GET", "/status", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+}
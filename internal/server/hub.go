@@ -0,0 +1,420 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"emailrss/internal/db"
+	"emailrss/internal/metrics"
+)
+
+// Limits for requests to and from the built-in WebSub hub
+const (
+	hubRequestTimeout = 10 * time.Second
+	maxHubFormBytes   = 64 << 10
+	maxHubSecretBytes = 200 // the WebSub limit on hub.secret
+)
+
+// SubscriptionStore persists the built-in hub's subscriptions
+type SubscriptionStore interface {
+	SaveSubscription(ctx context.Context, sub db.Subscription) error
+	DeleteSubscription(ctx context.Context, topic, callback string) error
+	GetSubscriptions(ctx context.Context, topic string) ([]db.Subscription, error)
+}
+
+// HubConfig runs a WebSub hub for the served feeds at /hub. Readers subscribe to a feed's
+// URL and the processor's publish ping makes the hub push the new feed to them.
+type HubConfig struct {
+	Enabled  bool
+	BaseURL  string        // public URL of the server; topics are BaseURL/feeds/NAME.xml and .json
+	Lease    time.Duration // granted when a subscriber does not ask for one
+	MaxLease time.Duration
+	// AllowPrivateCallbacks lets callbacks be on loopback, private and link-local addresses.
+	// Otherwise anyone able to subscribe could make the hub send requests into its network.
+	AllowPrivateCallbacks bool
+}
+
+// URL returns the address the hub is advertised at
+func (c HubConfig) URL() string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/hub"
+}
+
+// hubState tracks the hub's background requests and what it last distributed
+type hubState struct {
+	client *http.Client
+	wg     sync.WaitGroup // intent verifications and distributions in flight
+
+	mu        sync.Mutex
+	published map[string][sha256.Size]byte // content hash last delivered, by subscriberKey
+}
+
+// subscriberKey identifies a subscription in hubState.published
+func subscriberKey(topic, callback string) string {
+	return topic + " " + callback
+}
+
+// delivered reports whether the content with hash sum already reached the subscriber at key
+func (h *hubState) delivered(key string, sum [sha256.Size]byte) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.published[key] == sum
+}
+
+// setDelivered records that the content with hash sum reached the subscriber at key
+func (h *hubState) setDelivered(key string, sum [sha256.Size]byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.published[key] = sum
+}
+
+// forget drops what was delivered to the subscriber at key once it is unsubscribed
+func (h *hubState) forget(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.published, key)
+}
+
+// newHubClient returns the client the hub calls subscribers with. Unless allowPrivate is set it
+// refuses to connect to private addresses, checked once host names are resolved, so neither
+// DNS names nor redirects get around it.
+func newHubClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: hubRequestTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if privateAddr(addr.Addr()) {
+				return fmt.Errorf("refusing to connect to private address %s", addr.Addr())
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: hubRequestTimeout, Transport: transport}
+}
+
+// privateAddr reports whether ip is loopback, private, link-local, multicast or unspecified
+func privateAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// privateHost reports whether a callback host is obviously private, so that the subscriber
+// learns at once rather than when the hub fails to reach it
+func privateHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && privateAddr(ip)
+}
+
+// SetSubscriptionStore stores the built-in hub's subscriptions in store
+func (s *Server) SetSubscriptionStore(store SubscriptionStore) {
+	s.subscriptions = store
+}
+
+// handleHub accepts WebSub subscribe, unsubscribe and publish requests
+func (s *Server) handleHub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.subscriptions == nil {
+		http.Error(w, "Hub is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxHubFormBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	switch mode := r.PostForm.Get("hub.mode"); mode {
+	case "subscribe", "unsubscribe":
+		s.handleSubscription(w, r, mode)
+	case "publish":
+		s.handlePublish(w, r)
+	default:
+		http.Error(w, "Unsupported hub.mode", http.StatusBadRequest)
+	}
+}
+
+// handleSubscription validates a (un)subscription request and verifies the subscriber's
+// intent in the background, as WebSub requires
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request, mode string) {
+	topic := r.PostForm.Get("hub.topic")
+	feedFile, ok := s.topicFeed(topic)
+	if !ok {
+		http.Error(w, "Unknown hub.topic", http.StatusBadRequest)
+		return
+	}
+
+	callback := r.PostForm.Get("hub.callback")
+	parsed, err := url.Parse(callback)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		http.Error(w, "Invalid hub.callback", http.StatusBadRequest)
+		return
+	}
+	if !s.config.Hub.AllowPrivateCallbacks && privateHost(parsed.Hostname()) {
+		http.Error(w, "hub.callback must be a public address", http.StatusBadRequest)
+		return
+	}
+
+	sub := db.Subscription{Topic: topic, Callback: callback}
+	if mode == "subscribe" {
+		// Subscribers receive the feed's content, so they need the same access as readers
+		if !s.authorizeFeed(w, r, feedBaseName(feedFile)) {
+			return
+		}
+
+		sub.Secret = r.PostForm.Get("hub.secret")
+		if len(sub.Secret) > maxHubSecretBytes {
+			http.Error(w, "hub.secret is too long", http.StatusBadRequest)
+			return
+		}
+
+		lease := s.config.Hub.Lease
+		if seconds, err := strconv.Atoi(r.PostForm.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+			lease = time.Duration(seconds) * time.Second
+		}
+		lease = min(lease, s.config.Hub.MaxLease)
+		sub.ExpiresAt = time.Now().Add(lease)
+	}
+
+	s.hub.wg.Add(1)
+	go func() {
+		defer s.hub.wg.Done()
+		s.verifyIntent(mode, sub)
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyIntent asks the subscriber to echo a challenge and applies the request once it does
+func (s *Server) verifyIntent(mode string, sub db.Subscription) {
+	log := logger.With("callback", sub.Callback, "topic", sub.Topic, "mode", mode)
+	ctx, cancel := context.WithTimeout(context.Background(), hubRequestTimeout)
+	defer cancel()
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		log.Error("Failed to generate hub challenge", "error", err)
+		return
+	}
+	challenge := hex.EncodeToString(raw)
+
+	verifyURL, _ := url.Parse(sub.Callback)
+	query := verifyURL.Query()
+	query.Set("hub.mode", mode)
+	query.Set("hub.topic", sub.Topic)
+	query.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		query.Set("hub.lease_seconds", strconv.Itoa(int(time.Until(sub.ExpiresAt).Round(time.Second).Seconds())))
+	}
+	verifyURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, verifyURL.String(), nil)
+	if err != nil {
+		log.Warn("Failed to verify subscription intent", "error", err)
+		return
+	}
+	resp, err := s.hub.client.Do(req)
+	if err != nil {
+		log.Warn("Failed to verify subscription intent", "error", err)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || strings.TrimSpace(string(body)) != challenge {
+		log.Info("Subscriber did not confirm intent", "status", resp.StatusCode)
+		return
+	}
+
+	if mode == "subscribe" {
+		err = s.subscriptions.SaveSubscription(ctx, sub)
+	} else {
+		err = s.subscriptions.DeleteSubscription(ctx, sub.Topic, sub.Callback)
+		s.hub.forget(subscriberKey(sub.Topic, sub.Callback))
+	}
+	if err != nil {
+		log.Error("Failed to update subscription", "error", err)
+		return
+	}
+	log.Info("Updated subscription", "expires_at", sub.ExpiresAt)
+}
+
+// handlePublish pushes the current content of each topic in hub.url to its subscribers
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	topics := r.PostForm["hub.url"]
+	if len(topics) == 0 {
+		topics = r.PostForm["hub.topic"]
+	}
+	if len(topics) == 0 {
+		http.Error(w, "hub.url is required", http.StatusBadRequest)
+		return
+	}
+
+	feedFiles := make([]string, len(topics))
+	for i, topic := range topics {
+		feedFile, ok := s.topicFeed(topic)
+		if !ok {
+			http.Error(w, "Unknown hub.url", http.StatusBadRequest)
+			return
+		}
+		feedFiles[i] = feedFile
+	}
+
+	for i, topic := range topics {
+		s.hub.wg.Add(1)
+		go func() {
+			defer s.hub.wg.Done()
+			s.distribute(topic, feedFiles[i])
+		}()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// distribute sends the feed file behind topic to every active subscriber. Content already
+// distributed is not sent again, so repeated or forged pings cost nothing. Expired
+// subscriptions and subscribers answering 410 Gone are removed.
+func (s *Server) distribute(topic, feedFile string) {
+	log := logger.With("topic", topic)
+	ctx := context.Background()
+
+	content, err := os.ReadFile(filepath.Join(s.config.FeedsDir, feedFile))
+	if err != nil {
+		log.Error("Failed to read feed for distribution", "error", err)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	subs, err := s.subscriptions.GetSubscriptions(ctx, topic)
+	if err != nil {
+		log.Error("Failed to get subscriptions", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	now := time.Now()
+	for _, sub := range subs {
+		key := subscriberKey(sub.Topic, sub.Callback)
+		if sub.Expired(now) {
+			if err := s.subscriptions.DeleteSubscription(ctx, sub.Topic, sub.Callback); err != nil {
+				log.Error("Failed to delete expired subscription", "callback", sub.Callback, "error", err)
+			}
+			s.hub.forget(key)
+			continue
+		}
+
+		// Subscribers whose last push failed get the content again on the next publish
+		if s.hub.delivered(key, sum) {
+			log.Debug("Feed unchanged since last delivery", "callback", sub.Callback)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.push(ctx, sub, feedContentType(feedFile), content) {
+				s.hub.setDelivered(key, sum)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// push delivers content to one subscriber, signed with its secret, and reports whether the
+// subscriber accepted it
+func (s *Server) push(ctx context.Context, sub db.Subscription, contentType string, content []byte) bool {
+	log := logger.With("topic", sub.Topic, "callback", sub.Callback)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Callback, bytes.NewReader(content))
+	if err != nil {
+		log.Warn("Failed to push feed", "error", err)
+		metrics.NotificationFailures.WithLabelValues("hub").Inc()
+		return false
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Link", fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, s.config.Hub.URL(), sub.Topic))
+	if sub.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(sub.Secret))
+		mac.Write(content)
+		req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.hub.client.Do(req)
+	if err != nil {
+		log.Warn("Failed to push feed", "error", err)
+		metrics.NotificationFailures.WithLabelValues("hub").Inc()
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		log.Info("Subscriber is gone; removing subscription")
+		if err := s.subscriptions.DeleteSubscription(ctx, sub.Topic, sub.Callback); err != nil {
+			log.Error("Failed to delete subscription", "error", err)
+		}
+		s.hub.forget(subscriberKey(sub.Topic, sub.Callback))
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		log.Warn("Failed to push feed", "status", resp.Status)
+		metrics.NotificationFailures.WithLabelValues("hub").Inc()
+	default:
+		metrics.NotificationsSent.WithLabelValues("hub").Inc()
+		return true
+	}
+	return false
+}
+
+// topicFeed maps a topic URL to its feed file, reporting false for anything that is not a
+// feed this server publishes
+func (s *Server) topicFeed(topic string) (string, bool) {
+	name, ok := strings.CutPrefix(topic, strings.TrimSuffix(s.config.Hub.BaseURL, "/")+"/feeds/")
+	if !ok || name == "" || strings.ContainsAny(name, `/\?#`) {
+		return "", false
+	}
+
+	feedPath := filepath.Join(s.config.FeedsDir, name)
+	if !s.isValidFeedPath(feedPath) {
+		return "", false
+	}
+	if _, err := os.Stat(feedPath); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// hubLinks advertises the hub and the feed's topic in Link headers for WebSub discovery
+func (s *Server) hubLinks(w http.ResponseWriter, feedFile string) {
+	topic := fmt.Sprintf("%s/feeds/%s", strings.TrimSuffix(s.config.Hub.BaseURL, "/"), feedFile)
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, s.config.Hub.URL()))
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, topic))
+}
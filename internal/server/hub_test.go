@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+)
+
+const hubBaseURL = "https://feeds.example.com"
+
+// memorySubscriptions is an in-memory SubscriptionStore
+type memorySubscriptions struct {
+	mu   sync.Mutex
+	subs map[string]db.Subscription // by topic and callback
+}
+
+func (m *memorySubscriptions) SaveSubscription(ctx context.Context, sub db.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subs == nil {
+		m.subs = make(map[string]db.Subscription)
+	}
+	m.subs[sub.Topic+" "+sub.Callback] = sub
+	return nil
+}
+
+func (m *memorySubscriptions) DeleteSubscription(ctx context.Context, topic, callback string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subs, topic+" "+callback)
+	return nil
+}
+
+func (m *memorySubscriptions) GetSubscriptions(ctx context.Context, topic string) ([]db.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subs []db.Subscription
+	for _, sub := range m.subs {
+		if sub.Topic == topic {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+func (m *memorySubscriptions) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.subs)
+}
+
+// subscriber is a WebSub subscriber confirming intents when confirm is set and recording
+// content distribution requests, which it answers with status
+type subscriber struct {
+	mu      sync.Mutex
+	confirm bool
+	status  int
+	pushes  []*http.Request
+	bodies  []string
+}
+
+func (s *subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		if !s.confirm {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, r.URL.Query().Get("hub.challenge"))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	s.pushes = append(s.pushes, r)
+	s.bodies = append(s.bodies, string(body))
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+}
+
+// newHubServer returns a server whose hub accepts the loopback callbacks of httptest servers
+func newHubServer(t *testing.T, auth AuthConfig) (*Server, *memorySubscriptions, string) {
+	feedsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(feedsDir, "inbox.xml"), []byte("<rss>first</rss>"), 0644))
+
+	server := New(ServerConfig{
+		FeedsDir: feedsDir,
+		Auth:     auth,
+		Hub: HubConfig{
+			Enabled:               true,
+			BaseURL:               hubBaseURL + "/",
+			Lease:                 time.Hour,
+			MaxLease:              2 * time.Hour,
+			AllowPrivateCallbacks: true,
+		},
+	})
+	store := &memorySubscriptions{}
+	server.SetSubscriptionStore(store)
+	return server, store, feedsDir
+}
+
+func postHub(server *Server, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/hub", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, req)
+	server.hub.wg.Wait()
+	return w
+}
+
+func TestHubSubscribeAndPublish(t *testing.T) {
+	server, store, feedsDir := newHubServer(t, AuthConfig{})
+	reader := &subscriber{confirm: true}
+	callback := httptest.NewServer(reader)
+	defer callback.Close()
+
+	topic := hubBaseURL + "/feeds/inbox.xml"
+	w := postHub(server, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {callback.URL + "/push?id=1"},
+		"hub.secret":        {"s3cret"},
+		"hub.lease_seconds": {"86400"},
+	})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	subs, err := store.GetSubscriptions(context.Background(), topic)
+	require.NoError(t, err)
+	require.Len(t, subs, 1, "the verified subscription is stored")
+	assert.Equal(t, "s3cret", subs[0].Secret)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), subs[0].ExpiresAt, time.Minute, "leases are capped at MaxLease")
+
+	w = postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	require.Len(t, reader.pushes, 1)
+	push := reader.pushes[0]
+	assert.Equal(t, "/push", push.URL.Path)
+	assert.Equal(t, "<rss>first</rss>", reader.bodies[0])
+	assert.Equal(t, "application/rss+xml", push.Header.Get("Content-Type"))
+	assert.Equal(t, `<https://feeds.example.com/hub>; rel="hub", <`+topic+`>; rel="self"`, push.Header.Get("Link"))
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("<rss>first</rss>"))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), push.Header.Get("X-Hub-Signature"))
+
+	postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	assert.Len(t, reader.pushes, 1, "unchanged feeds are not pushed again")
+
+	require.NoError(t, os.WriteFile(filepath.Join(feedsDir, "inbox.xml"), []byte("<rss>second</rss>"), 0644))
+	postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	require.Len(t, reader.pushes, 2)
+	assert.Equal(t, "<rss>second</rss>", reader.bodies[1])
+
+	w = postHub(server, url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {topic}, "hub.callback": {callback.URL + "/push?id=1"}})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Zero(t, store.count())
+}
+
+func TestHubRetriesFailedPushes(t *testing.T) {
+	server, store, _ := newHubServer(t, AuthConfig{})
+	failing := &subscriber{status: http.StatusInternalServerError}
+	failingServer := httptest.NewServer(failing)
+	defer failingServer.Close()
+	healthy := &subscriber{}
+	healthyServer := httptest.NewServer(healthy)
+	defer healthyServer.Close()
+
+	topic := hubBaseURL + "/feeds/inbox.xml"
+	for _, callback := range []string{failingServer.URL, healthyServer.URL} {
+		require.NoError(t, store.SaveSubscription(context.Background(), db.Subscription{Topic: topic, Callback: callback, ExpiresAt: time.Now().Add(time.Hour)}))
+	}
+
+	postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	assert.Len(t, failing.pushes, 1)
+	assert.Len(t, healthy.pushes, 1)
+
+	failing.mu.Lock()
+	failing.status = 0
+	failing.mu.Unlock()
+
+	postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	assert.Len(t, failing.pushes, 2, "a failed push is retried on the next publish")
+	assert.Equal(t, "<rss>first</rss>", failing.bodies[1])
+	assert.Len(t, healthy.pushes, 1, "subscribers that got the content are not pushed it again")
+
+	postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	assert.Len(t, failing.pushes, 2)
+}
+
+func TestHubRejectsRequests(t *testing.T) {
+	server, store, _ := newHubServer(t, AuthConfig{Enabled: true, Users: []User{{Username: "reader", Password: "secret"}}})
+	unconfirmed := httptest.NewServer(&subscriber{})
+	defer unconfirmed.Close()
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+	}{
+		{"unknown mode", url.Values{"hub.mode": {"list"}}, http.StatusBadRequest},
+		{"foreign topic", url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"https://other.example.com/feeds/inbox.xml"}, "hub.callback": {unconfirmed.URL}}, http.StatusBadRequest},
+		{"missing feed", url.Values{"hub.mode": {"subscribe"}, "hub.topic": {hubBaseURL + "/feeds/missing.xml"}, "hub.callback": {unconfirmed.URL}}, http.StatusBadRequest},
+		{"invalid callback", url.Values{"hub.mode": {"subscribe"}, "hub.topic": {hubBaseURL + "/feeds/inbox.xml"}, "hub.callback": {"ftp://reader"}}, http.StatusBadRequest},
+		{"subscribing needs feed access", url.Values{"hub.mode": {"subscribe"}, "hub.topic": {hubBaseURL + "/feeds/inbox.xml"}, "hub.callback": {unconfirmed.URL}}, http.StatusUnauthorized},
+		{"publishing an unknown feed", url.Values{"hub.mode": {"publish"}, "hub.url": {hubBaseURL + "/feeds/missing.xml"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, postHub(server, tt.form).Code)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/hub", strings.NewReader(url.Values{
+		"hub.mode":     {"subscribe"},
+		"hub.topic":    {hubBaseURL + "/feeds/inbox.xml"},
+		"hub.callback": {unconfirmed.URL},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("reader", "secret")
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, req)
+	server.hub.wg.Wait()
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Zero(t, store.count(), "subscriptions whose intent is not confirmed are dropped")
+}
+
+func TestHubRejectsPrivateCallbacks(t *testing.T) {
+	server, _, _ := newHubServer(t, AuthConfig{})
+	server.config.Hub.AllowPrivateCallbacks = false
+	server.hub.client = newHubClient(false)
+
+	for _, callback := range []string{
+		"http://127.0.0.1:8080/push",
+		"http://localhost/push",
+		"http://[::1]/push",
+		"http://10.1.2.3/push",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::ffff:192.168.1.1]/push",
+	} {
+		w := postHub(server, url.Values{"hub.mode": {"subscribe"}, "hub.topic": {hubBaseURL + "/feeds/inbox.xml"}, "hub.callback": {callback}})
+		assert.Equal(t, http.StatusBadRequest, w.Code, callback)
+	}
+
+	// Host names resolving to private addresses are refused when the hub connects
+	callback := httptest.NewServer(&subscriber{confirm: true})
+	defer callback.Close()
+	_, err := server.hub.client.Get(strings.Replace(callback.URL, "127.0.0.1", "localhost", 1))
+	assert.ErrorContains(t, err, "private address")
+}
+
+func TestHubRemovesStaleSubscriptions(t *testing.T) {
+	server, store, _ := newHubServer(t, AuthConfig{})
+	gone := &subscriber{status: http.StatusGone}
+	goneServer := httptest.NewServer(gone)
+	defer goneServer.Close()
+	expired := &subscriber{}
+	expiredServer := httptest.NewServer(expired)
+	defer expiredServer.Close()
+
+	topic := hubBaseURL + "/feeds/inbox.xml"
+	require.NoError(t, store.SaveSubscription(context.Background(), db.Subscription{Topic: topic, Callback: goneServer.URL, ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, store.SaveSubscription(context.Background(), db.Subscription{Topic: topic, Callback: expiredServer.URL, ExpiresAt: time.Now().Add(-time.Minute)}))
+
+	postHub(server, url.Values{"hub.mode": {"publish"}, "hub.url": {topic}})
+	assert.Len(t, gone.pushes, 1)
+	assert.Empty(t, expired.pushes, "expired subscribers are not pushed to")
+	assert.Zero(t, store.count(), "expired and gone subscriptions are removed")
+}
+
+func TestHubLinkHeaders(t *testing.T) {
+	server, _, _ := newHubServer(t, AuthConfig{})
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feeds/inbox.xml", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{
+		`<https://feeds.example.com/hub>; rel="hub"`,
+		`<https://feeds.example.com/feeds/inbox.xml>; rel="self"`,
+	}, w.Header().Values("Link"))
+
+	w = httptest.NewRecorder()
+	New(ServerConfig{FeedsDir: t.TempDir()}).routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/hub", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "the hub is only served when enabled")
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"emailrss/internal/metrics"
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrumentFeed counts feed requests by feed name, status and format
+func (s *Server) instrumentFeed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		fileName := strings.TrimPrefix(r.URL.Path, "/feeds/")
+		format := "rss"
+		if strings.HasSuffix(fileName, ".json") {
+			format = "json"
+		}
+
+		// Names come straight from the URL; only label feeds that actually exist so
+		// arbitrary requests cannot create new label values
+		feed := feedBaseName(fileName)
+		if !s.feedExists(feed) {
+			feed = "unknown"
+		}
+
+		metrics.FeedRequests.WithLabelValues(feed, strconv.Itoa(recorder.status), format).Inc()
+	}
+}
+
+// feedExists reports whether an RSS or JSON file for feed is present in the feeds directory
+func (s *Server) feedExists(feed string) bool {
+	if feed == "" || strings.ContainsAny(feed, `/\`) {
+		return false
+	}
+	for _, ext := range []string{".xml", ".json"} {
+		if _, err := os.Stat(filepath.Join(s.config.FeedsDir, feed+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
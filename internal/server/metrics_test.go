@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"emailrss/internal/metrics"
+)
+
+func TestInstrumentFeed(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTestFeed(t, tmpDir, "metrics-inbox.xml")
+	createTestFeed(t, tmpDir, "metrics-inbox.json")
+
+	server := New(ServerConfig{FeedsDir: tmpDir})
+	handler := server.instrumentFeed(server.handleFeed)
+
+	okRSS := metrics.FeedRequests.WithLabelValues("metrics-inbox", "200", "rss")
+	okJSON := metrics.FeedRequests.WithLabelValues("metrics-inbox", "200", "json")
+	notFound := metrics.FeedRequests.WithLabelValues("unknown", "404", "rss")
+	beforeRSS := testutil.ToFloat64(okRSS)
+	beforeJSON := testutil.ToFloat64(okJSON)
+	beforeNotFound := testutil.ToFloat64(notFound)
+
+	for _, path := range []string{"/feeds/metrics-inbox.xml", "/feeds/metrics-inbox", "/feeds/metrics-inbox.json", "/feeds/nope.xml"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, beforeRSS+2, testutil.ToFloat64(okRSS))
+	assert.Equal(t, beforeJSON+1, testutil.ToFloat64(okJSON))
+	assert.Equal(t, beforeNotFound+1, testutil.ToFloat64(notFound))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server := New(ServerConfig{FeedsDir: t.TempDir(), MetricsPath: "/metrics"})
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), "emailrss_processing_worker_queue_depth")
+}
+
+func TestMetricsEndpointDisabled(t *testing.T) {
+	server := New(ServerConfig{FeedsDir: t.TempDir()})
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
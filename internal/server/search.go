@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"emailrss/internal/db"
+)
+
+// Result limits for /api/search
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+	excerptLength      = 200
+)
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// SearchStore runs full-text searches over processed messages
+type SearchStore interface {
+	SearchMessages(ctx context.Context, query db.SearchQuery) ([]db.StoredMessage, error)
+}
+
+// SetSearchStore enables the /api/search endpoint
+func (s *Server) SetSearchStore(store SearchStore) {
+	s.search = store
+}
+
+type searchResult struct {
+	Folder  string    `json:"folder"`
+	Feed    string    `json:"feed,omitempty"`
+	UID     uint32    `json:"uid"`
+	Subject string    `json:"subject"`
+	From    string    `json:"from"`
+	Date    time.Time `json:"date"`
+	Excerpt string    `json:"excerpt,omitempty"`
+}
+
+type searchResponse struct {
+	Query   string         `json:"query"`
+	Results []searchResult `json:"results"`
+}
+
+// handleSearch answers /api/search?q=...&folder=...&limit=... with matching messages, newest
+// first. Users restricted to some feeds only see messages from the folders behind those feeds.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var user *User
+	if s.config.Auth.Enabled {
+		user = s.authenticateUser(r)
+		if user == nil {
+			s.requestCredentials(w)
+			return
+		}
+	}
+
+	if s.search == nil {
+		http.Error(w, "Search is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		http.Error(w, "Query parameter q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	response := searchResponse{Query: text, Results: []searchResult{}}
+
+	feeds := s.folderFeeds(r.Context())
+	folders, ok := searchableFolders(feeds, user, params["folder"])
+	if !ok {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	messages, err := s.search.SearchMessages(r.Context(), db.SearchQuery{Text: text, Folders: folders, Limit: limit})
+	if err != nil {
+		logger.Error("Failed to search messages", "error", err)
+		http.Error(w, "Failed to search messages", http.StatusInternalServerError)
+		return
+	}
+
+	for _, msg := range messages {
+		response.Results = append(response.Results, searchResult{
+			Folder:  msg.Folder,
+			Feed:    feeds[msg.Folder],
+			UID:     msg.UID,
+			Subject: msg.Subject,
+			From:    msg.From,
+			Date:    msg.Date,
+			Excerpt: excerpt(msg),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// folderFeeds maps folders to feed names: the configured folders plus any discovered
+// folders the processor has recorded
+func (s *Server) folderFeeds(ctx context.Context) map[string]string {
+	feeds := make(map[string]string, len(s.config.Folders))
+	if s.status != nil {
+		states, err := s.status.GetFolderStates(ctx)
+		if err != nil {
+			logger.Warn("Failed to load folder states", "error", err)
+		}
+		for _, state := range states {
+			feeds[state.Folder] = state.FeedName
+		}
+	}
+	for folder, feed := range s.config.Folders {
+		feeds[folder] = feed
+	}
+	return feeds
+}
+
+// searchableFolders narrows the requested folders to those the user may read, given the
+// feed behind each folder. It returns false when nothing is left to search; nil folders
+// with true means every folder.
+func searchableFolders(feeds map[string]string, user *User, requested []string) ([]string, bool) {
+	if user == nil || len(user.Feeds) == 0 {
+		return requested, true
+	}
+
+	var allowed []string
+	for folder, feed := range feeds {
+		if user.CanAccess(feed) {
+			allowed = append(allowed, folder)
+		}
+	}
+
+	if len(requested) > 0 {
+		var folders []string
+		for _, folder := range requested {
+			if feed, ok := feeds[folder]; ok && user.CanAccess(feed) {
+				folders = append(folders, folder)
+			}
+		}
+		allowed = folders
+	}
+
+	return allowed, len(allowed) > 0
+}
+
+// excerpt returns the start of a message's text, falling back to its HTML with tags removed
+func excerpt(msg db.StoredMessage) string {
+	body := msg.TextBody
+	if body == "" {
+		body = htmlTagPattern.ReplaceAllString(msg.HTMLBody, " ")
+	}
+
+	text := strings.Join(strings.Fields(body), " ")
+	if runes := []rune(text); len(runes) > excerptLength {
+		return string(runes[:excerptLength]) + "..."
+	}
+	return text
+}
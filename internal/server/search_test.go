@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+)
+
+type fakeSearchStore struct {
+	queries  []db.SearchQuery
+	messages []db.StoredMessage
+}
+
+func (f *fakeSearchStore) SearchMessages(ctx context.Context, query db.SearchQuery) ([]db.StoredMessage, error) {
+	f.queries = append(f.queries, query)
+	return f.messages, nil
+}
+
+func TestHandleSearch(t *testing.T) {
+	store := &fakeSearchStore{messages: []db.StoredMessage{
+		{
+			ProcessedMessage: db.ProcessedMessage{
+				Folder: "INBOX", UID: 7, Subject: "Disk alert", From: "monitor@example.com",
+				Date: time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC),
+			},
+			HTMLBody: "<p>db-01   is <b>full</b></p>",
+		},
+	}}
+	server := New(ServerConfig{FeedsDir: t.TempDir(), Folders: map[string]string{"INBOX": "inbox"}})
+	server.SetSearchStore(store)
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("GET", "/api/search?q=disk+alert&limit=500&folder=INBOX", nil))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var response searchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "disk alert", response.Query)
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "inbox", response.Results[0].Feed)
+	assert.Equal(t, uint32(7), response.Results[0].UID)
+	assert.Equal(t, "db-01 is full", response.Results[0].Excerpt)
+
+	require.Len(t, store.queries, 1)
+	assert.Equal(t, db.SearchQuery{Text: "disk alert", Folders: []string{"INBOX"}, Limit: maxSearchLimit}, store.queries[0])
+}
+
+func TestHandleSearchValidation(t *testing.T) {
+	server := New(ServerConfig{FeedsDir: t.TempDir()})
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("GET", "/api/search?q=x", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode, "no store configured")
+
+	server.SetSearchStore(&fakeSearchStore{})
+	for _, target := range []string{"/api/search", "/api/search?q=+", "/api/search?q=x&limit=0", "/api/search?q=x&limit=ten"} {
+		w := httptest.NewRecorder()
+		server.routes().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, target)
+	}
+
+	w = httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("POST", "/api/search?q=x", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Result().StatusCode)
+}
+
+func TestHandleSearchHonoursFeedACLs(t *testing.T) {
+	store := &fakeSearchStore{}
+	server := New(ServerConfig{
+		FeedsDir: t.TempDir(),
+		Folders:  map[string]string{"INBOX": "inbox", "Alerts": "alerts"},
+		Auth: AuthConfig{
+			Enabled: true,
+			Users: []User{
+				{Username: "admin", Password: "secret"},
+				{Username: "oncall", Password: "secret", Feeds: []string{"alerts"}},
+				{Username: "guest", Password: "secret", Feeds: []string{"public"}},
+			},
+		},
+	})
+	server.SetSearchStore(store)
+
+	search := func(username, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if username != "" {
+			req.SetBasicAuth(username, "secret")
+		}
+		w := httptest.NewRecorder()
+		server.routes().ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, search("", "/api/search?q=x").Result().StatusCode)
+
+	require.Equal(t, http.StatusOK, search("admin", "/api/search?q=x").Result().StatusCode)
+	require.Equal(t, http.StatusOK, search("oncall", "/api/search?q=x").Result().StatusCode)
+	require.Equal(t, http.StatusOK, search("oncall", "/api/search?q=x&folder=INBOX&folder=Alerts").Result().StatusCode)
+	require.Len(t, store.queries, 3)
+	assert.Nil(t, store.queries[0].Folders, "unrestricted users search every folder")
+	assert.Equal(t, []string{"Alerts"}, store.queries[1].Folders)
+	assert.Equal(t, []string{"Alerts"}, store.queries[2].Folders)
+
+	w := search("guest", "/api/search?q=x")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.True(t, strings.Contains(w.Body.String(), `"results":[]`))
+	assert.Len(t, store.queries, 3, "users without searchable folders never reach the store")
+}
+
+func TestHandleSearchCoversDiscoveredFolders(t *testing.T) {
+	store := &fakeSearchStore{messages: []db.StoredMessage{
+		{ProcessedMessage: db.ProcessedMessage{Folder: "Lists/golang-nuts", UID: 3, Subject: "Generics"}},
+	}}
+	server := New(ServerConfig{
+		FeedsDir: t.TempDir(),
+		Folders:  map[string]string{"INBOX": "inbox"},
+		Auth: AuthConfig{
+			Enabled: true,
+			Users:   []User{{Username: "reader", Password: "secret", Feeds: []string{"golang-nuts"}}},
+		},
+	})
+	server.SetSearchStore(store)
+	server.SetStatusStore(&fakeStatusStore{states: []db.FolderState{
+		{Folder: "INBOX", FeedName: "inbox"},
+		{Folder: "Lists/golang-nuts", FeedName: "golang-nuts"},
+	}})
+
+	req := httptest.NewRequest("GET", "/api/search?q=generics", nil)
+	req.SetBasicAuth("reader", "secret")
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var response searchResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "golang-nuts", response.Results[0].Feed)
+
+	require.Len(t, store.queries, 1)
+	assert.Equal(t, []string{"Lists/golang-nuts"}, store.queries[0].Folders)
+}
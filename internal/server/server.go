@@ -1,42 +1,144 @@
 package server
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"emailrss/internal/logging"
+	"emailrss/internal/metrics"
+)
+
+var logger = logging.For("server")
+
+// Timeouts applied to every listener so slow or idle clients cannot hold connections open indefinitely
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 120 * time.Second
 )
 
 type Server struct {
-	config ServerConfig
+	config        ServerConfig
+	tokens        TokenStore
+	status        StatusStore
+	search        SearchStore
+	subscriptions SubscriptionStore
+	hub           *hubState
+	events        FeedEvents
+	stream        StreamStore
+	renderer      ItemRenderer
 }
 
 type ServerConfig struct {
 	Host     string
 	Port     int
 	FeedsDir string
+	Auth     AuthConfig
+	TLS      TLSConfig
+	// MetricsPath exposes Prometheus metrics at this path when non-empty
+	MetricsPath string
+	// Folders maps IMAP folders to feed names so search results honour feed ACLs
+	Folders map[string]string
+	Hub     HubConfig
+}
+
+// TLSConfig enables a native HTTPS listener when both files are set
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// RedirectHTTPPort, when non-zero, starts a plain HTTP listener on this
+	// port that redirects every request to the HTTPS listener
+	RedirectHTTPPort int
+}
+
+// Enabled reports whether a certificate pair is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
 }
 
 func New(config ServerConfig) *Server {
 	return &Server{
 		config: config,
+		hub: &hubState{
+			client:    newHubClient(config.Hub.AllowPrivateCallbacks),
+			published: make(map[string][sha256.Size]byte),
+		},
 	}
 }
 
 func (s *Server) Start() error {
+	mux := s.routes()
+
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+	srv := newHTTPServer(addr, mux)
+
+	if !s.config.TLS.Enabled() {
+		logger.Info("Starting server", "addr", addr, "feeds_dir", s.config.FeedsDir)
+		return srv.ListenAndServe()
+	}
+
+	reloader, err := newCertReloader(s.config.TLS.CertFile, s.config.TLS.KeyFile)
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if s.config.TLS.RedirectHTTPPort != 0 {
+		redirectAddr := fmt.Sprintf("%s:%d", s.config.Host, s.config.TLS.RedirectHTTPPort)
+		redirectSrv := newHTTPServer(redirectAddr, redirectHandler(s.config.Port))
+		go func() {
+			logger.Info("Redirecting HTTP to HTTPS", "addr", redirectAddr)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("HTTP redirect listener failed", "error", err)
+			}
+		}()
+	}
+
+	logger.Info("Starting HTTPS server", "addr", addr, "feeds_dir", s.config.FeedsDir)
+
+	return srv.ListenAndServeTLS("", "")
+}
+
+func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", s.handleRoot)
-	mux.HandleFunc("/feeds/", s.handleFeed)
+	mux.HandleFunc("/feeds/", s.instrumentFeed(s.handleFeed))
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/api/search", s.handleSearch)
+	mux.HandleFunc("/stream/", s.handleStream)
+	if s.config.Hub.Enabled {
+		mux.HandleFunc("/hub", s.handleHub)
+	}
+	if s.config.MetricsPath != "" {
+		mux.Handle(s.config.MetricsPath, metrics.Handler())
+	}
 
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	log.Printf("Starting server on %s", addr)
-	log.Printf("Serving RSS feeds from %s", s.config.FeedsDir)
+	return mux
+}
 
-	return http.ListenAndServe(addr, mux)
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
 }
 
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +147,15 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var user *User
+	if s.config.Auth.Enabled {
+		user = s.authenticateUser(r)
+		if user == nil {
+			s.requestCredentials(w)
+			return
+		}
+	}
+
 	feeds, err := s.listFeeds()
 	if err != nil {
 		http.Error(w, "Failed to list feeds", http.StatusInternalServerError)
@@ -57,6 +168,9 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "<ul>")
 
 	for _, feed := range feeds {
+		if user != nil && !user.CanAccess(feedBaseName(feed)) {
+			continue
+		}
 		feedURL := fmt.Sprintf("/feeds/%s", feed)
 		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>", feedURL, feed)
 	}
@@ -72,17 +186,11 @@ func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine feed type and set appropriate extension
-	var contentType string
-	if strings.HasSuffix(feedName, ".json") {
-		contentType = "application/feed+json"
-	} else if strings.HasSuffix(feedName, ".xml") {
-		contentType = "application/rss+xml"
-	} else {
-		// Default to XML if no extension specified
+	// Default to XML if no extension specified
+	if !strings.HasSuffix(feedName, ".json") && !strings.HasSuffix(feedName, ".xml") {
 		feedName += ".xml"
-		contentType = "application/rss+xml"
 	}
+	contentType := feedContentType(feedName)
 
 	feedPath := filepath.Join(s.config.FeedsDir, feedName)
 
@@ -91,6 +199,10 @@ func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeFeed(w, r, feedBaseName(feedName)) {
+		return
+	}
+
 	feedData, err := os.ReadFile(feedPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -103,12 +215,16 @@ func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Cache-Control", "max-age=3600")
+	if s.config.Hub.Enabled {
+		s.hubLinks(w, feedName)
+	}
 	if _, err := w.Write(feedData); err != nil {
 		http.Error(w, "Failed to write response", http.StatusInternalServerError)
 		return
 	}
 }
 
+// handleHealth is the liveness check: it succeeds as long as the process can serve requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"status": "ok", "service": "emailrss"}`)
@@ -133,6 +249,19 @@ func (s *Server) listFeeds() ([]string, error) {
 	return feeds, nil
 }
 
+// feedBaseName strips the format extension, so inbox.xml and inbox.json both map to inbox
+func feedBaseName(fileName string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(fileName, ".xml"), ".json")
+}
+
+// feedContentType returns the media type of a feed file
+func feedContentType(fileName string) string {
+	if strings.HasSuffix(fileName, ".json") {
+		return "application/feed+json"
+	}
+	return "application/rss+xml"
+}
+
 func (s *Server) isValidFeedPath(feedPath string) bool {
 	cleanPath := filepath.Clean(feedPath)
 	expectedDir := filepath.Clean(s.config.FeedsDir)
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"emailrss/internal/db"
+	"emailrss/internal/rss"
+)
+
+// Settings of /stream
+const (
+	streamBatchSize   = 100
+	streamKeepalive   = 30 * time.Second
+	streamRetryMillis = 5000
+)
+
+// FeedEvents signals when feeds gain items. notify.Bus implements it.
+type FeedEvents interface {
+	Subscribe(feed string) (<-chan struct{}, func())
+}
+
+// StreamStore reads messages in the order they were stored, so streams can resume
+type StreamStore interface {
+	GetMessagesSince(ctx context.Context, folders []string, afterID int64, limit int) ([]db.StoredMessage, error)
+	LatestMessageID(ctx context.Context, folders []string) (int64, error)
+}
+
+// ItemRenderer turns messages into the items of a folder's JSON feed. rss.Generator implements it.
+type ItemRenderer interface {
+	JSONItems(folder string, messages []rss.EmailMessage, aiHooks rss.AIHooks) []rss.JSONItem
+}
+
+// SetStream enables /stream/{feed}, which pushes a feed's items as events signals them,
+// rendered by renderer from store. It needs the processor in the same process.
+func (s *Server) SetStream(events FeedEvents, store StreamStore, renderer ItemRenderer) {
+	s.events = events
+	s.stream = store
+	s.renderer = renderer
+}
+
+// handleStream sends a feed's new items as Server-Sent Events, each a JSON Feed item with the
+// message's database ID as event ID. A client reconnecting with Last-Event-ID, or the
+// last_event_id parameter, first receives the items it missed.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	feed := strings.TrimPrefix(r.URL.Path, "/stream/")
+	if !s.authorizeFeed(w, r, feed) {
+		return
+	}
+	folders := s.feedFolders(r.Context(), feed)
+	if len(folders) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if s.events == nil || s.stream == nil || s.renderer == nil {
+		http.Error(w, "Streaming is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		parsed, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = parsed
+	} else {
+		// New clients only receive items stored from now on
+		latest, err := s.stream.LatestMessageID(r.Context(), folders)
+		if err != nil {
+			logger.Error("Failed to start stream", "feed", feed, "error", err)
+			http.Error(w, "Failed to start stream", http.StatusInternalServerError)
+			return
+		}
+		lastID = latest
+	}
+
+	// Subscribe before catching up so that nothing stored meanwhile is missed
+	signals, unsubscribe := s.events.Subscribe(feed)
+	defer unsubscribe()
+
+	// Streams outlive the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("Failed to clear the write deadline of a stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		var err error
+		if lastID, err = s.sendNewItems(r.Context(), w, folders, lastID); err != nil {
+			if r.Context().Err() == nil {
+				logger.Warn("Stream ended", "feed", feed, "error", err)
+			}
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-signals:
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendNewItems writes an event for each message of folders stored after lastID and returns
+// the ID of the last one sent
+func (s *Server) sendNewItems(ctx context.Context, w http.ResponseWriter, folders []string, lastID int64) (int64, error) {
+	for {
+		messages, err := s.stream.GetMessagesSince(ctx, folders, lastID, streamBatchSize)
+		if err != nil {
+			return lastID, err
+		}
+
+		for _, msg := range messages {
+			item := s.renderer.JSONItems(msg.Folder, []rss.EmailMessage{{
+				Folder:   msg.Folder,
+				UID:      msg.UID,
+				Subject:  msg.Subject,
+				From:     msg.From,
+				Date:     msg.Date,
+				TextBody: msg.TextBody,
+				HTMLBody: msg.HTMLBody,
+			}}, nil)[0]
+			data, err := json.Marshal(item)
+			if err != nil {
+				return lastID, err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: item\ndata: %s\n\n", msg.ID, data); err != nil {
+				return lastID, err
+			}
+			lastID = msg.ID
+		}
+
+		if len(messages) < streamBatchSize {
+			return lastID, nil
+		}
+	}
+}
+
+// feedFolders returns the folders published as feed, sorted
+func (s *Server) feedFolders(ctx context.Context, feed string) []string {
+	if feed == "" {
+		return nil
+	}
+
+	var folders []string
+	for folder, name := range s.folderFeeds(ctx) {
+		if name == feed {
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+	return folders
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"emailrss/internal/db"
+	"emailrss/internal/notify"
+	"emailrss/internal/rss"
+)
+
+// memoryStream is a StreamStore over messages kept in the order they were stored
+type memoryStream struct {
+	mu       sync.Mutex
+	messages []db.StoredMessage
+}
+
+func (m *memoryStream) add(folder string, uid uint32, subject string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, db.StoredMessage{ProcessedMessage: db.ProcessedMessage{
+		ID: int64(len(m.messages) + 1), Folder: folder, UID: uid, Subject: subject, Date: time.Now(),
+	}, TextBody: subject})
+}
+
+func (m *memoryStream) GetMessagesSince(ctx context.Context, folders []string, afterID int64, limit int) ([]db.StoredMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []db.StoredMessage
+	for _, msg := range m.messages {
+		if msg.ID > afterID && slices.Contains(folders, msg.Folder) && len(messages) < limit {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *memoryStream) LatestMessageID(ctx context.Context, folders []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest int64
+	for _, msg := range m.messages {
+		if slices.Contains(folders, msg.Folder) {
+			latest = msg.ID
+		}
+	}
+	return latest, nil
+}
+
+type streamEvent struct {
+	ID   string
+	Item rss.JSONItem
+}
+
+// openStream connects to path and returns a function reading the next item event
+func openStream(t *testing.T, baseURL, path, lastEventID string) func() streamEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	return func() streamEvent {
+		var event streamEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Item))
+			case line == "" && event.ID != "":
+				return event
+			}
+		}
+		t.Fatalf("stream ended: %v", scanner.Err())
+		return event
+	}
+}
+
+func TestStream(t *testing.T) {
+	store := &memoryStream{}
+	store.add("INBOX", 1, "First")
+	store.add("INBOX", 2, "Second")
+	store.add("Alerts", 3, "Elsewhere")
+
+	bus := notify.NewBus()
+	server := New(ServerConfig{FeedsDir: t.TempDir(), Folders: map[string]string{"INBOX": "inbox", "Alerts": "alerts"}})
+	server.SetStream(bus, store, rss.NewGenerator(rss.RSSConfig{}))
+	httpServer := httptest.NewServer(server.routes())
+	t.Cleanup(httpServer.Close) // after the streams are closed
+
+	resumed := openStream(t, httpServer.URL, "/stream/inbox", "1")
+	event := resumed()
+	assert.Equal(t, "2", event.ID, "a resumed stream first sends what it missed")
+	assert.Equal(t, "Second", event.Item.Title)
+	assert.Equal(t, "INBOX_2", event.Item.ID)
+
+	live := openStream(t, httpServer.URL, "/stream/inbox", "")
+
+	store.add("Alerts", 4, "Other feed")
+	store.add("INBOX", 5, "Third")
+	bus.Notify(context.Background(), notify.Event{Feed: "inbox"})
+
+	event = resumed()
+	assert.Equal(t, "5", event.ID, "items of other feeds are skipped")
+	assert.Equal(t, "Third", event.Item.Title)
+
+	event = live()
+	assert.Equal(t, "5", event.ID, "new clients only receive new items")
+}
+
+func TestStreamRejectsRequests(t *testing.T) {
+	folders := map[string]string{"INBOX": "inbox"}
+
+	tests := []struct {
+		name    string
+		path    string
+		header  string
+		status  int
+		enabled bool
+	}{
+		{name: "unknown feed", path: "/stream/missing", status: http.StatusNotFound, enabled: true},
+		{name: "invalid last event id", path: "/stream/inbox", header: "abc", status: http.StatusBadRequest, enabled: true},
+		{name: "without the processor", path: "/stream/inbox", status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := New(ServerConfig{FeedsDir: t.TempDir(), Folders: folders})
+			if tt.enabled {
+				server.SetStream(notify.NewBus(), &memoryStream{}, rss.NewGenerator(rss.RSSConfig{}))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	server := New(ServerConfig{
+		FeedsDir: t.TempDir(),
+		Folders:  folders,
+		Auth:     AuthConfig{Enabled: true, Users: []User{{Username: "reader", Password: "secret", Feeds: []string{"alerts"}}}},
+	})
+	server.SetStream(notify.NewBus(), &memoryStream{}, rss.NewGenerator(rss.RSSConfig{}))
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream/inbox", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/stream/inbox", nil)
+	req.SetBasicAuth("reader", "secret")
+	w = httptest.NewRecorder()
+	server.routes().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, "streams honour feed ACLs")
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert writes a self-signed certificate pair for commonName to dir
+func writeTestCert(t *testing.T, dir, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func certCommonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	reloader.checkInterval = 0
+
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", certCommonName(t, cert))
+
+	writeTestCert(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+
+	cert, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", certCommonName(t, cert))
+}
+
+func TestCertReloaderKeepsPreviousOnBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "good")
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	reloader.checkInterval = 0
+
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "good", certCommonName(t, cert))
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	_, err := newCertReloader("/nonexistent/tls.crt", "/nonexistent/tls.key")
+	assert.Error(t, err)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort int
+		host      string
+		path      string
+		expected  string
+	}{
+		{
+			name:      "standard port",
+			httpsPort: 443,
+			host:      "feeds.example.com:80",
+			path:      "/feeds/inbox.xml?token=abc",
+			expected:  "https://feeds.example.com/feeds/inbox.xml?token=abc",
+		},
+		{
+			name:      "custom port",
+			httpsPort: 8443,
+			host:      "feeds.example.com:8080",
+			path:      "/",
+			expected:  "https://feeds.example.com:8443/",
+		},
+		{
+			name:      "host without port",
+			httpsPort: 443,
+			host:      "feeds.example.com",
+			path:      "/health",
+			expected:  "https://feeds.example.com/health",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			redirectHandler(tt.httpsPort).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, w.Result().StatusCode)
+			assert.Equal(t, tt.expected, w.Result().Header.Get("Location"))
+		})
+	}
+}
+
+func TestStartServerTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("Could not find available port")
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "localhost")
+
+	server := New(ServerConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		FeedsDir: t.TempDir(),
+		TLS:      TLSConfig{CertFile: certFile, KeyFile: keyFile},
+	})
+	go func() {
+		_ = server.Start()
+	}()
+
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, //nolint:gosec // self-signed test certificate
+	}
+
+	var resp *http.Response
+	for i := 0; i < 20; i++ {
+		resp, err = client.Get("https://127.0.0.1:" + strconv.Itoa(port) + "/health")
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, resp.TLS)
+}
+
+func TestStartServerTLSMissingCert(t *testing.T) {
+	server := New(ServerConfig{
+		Host:     "127.0.0.1",
+		Port:     0,
+		FeedsDir: t.TempDir(),
+		TLS:      TLSConfig{CertFile: "/nonexistent/tls.crt", KeyFile: "/nonexistent/tls.key"},
+	})
+
+	err := server.Start()
+	assert.Error(t, err)
+}
+
+func TestNewHTTPServerTimeouts(t *testing.T) {
+	srv := newHTTPServer(":0", http.NewServeMux())
+
+	assert.Equal(t, readHeaderTimeout, srv.ReadHeaderTimeout)
+	assert.Equal(t, readTimeout, srv.ReadTimeout)
+	assert.Equal(t, writeTimeout, srv.WriteTimeout)
+	assert.Equal(t, idleTimeout, srv.IdleTimeout)
+}
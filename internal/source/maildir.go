@@ -0,0 +1,253 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+)
+
+// maildirUIDList is the file in a Maildir's root keeping the UID given to each message
+const maildirUIDList = "emailrss-uidlist"
+
+// Maildir reads messages from the new and cur subdirectories of a Maildir. A message's UID
+// is a hash of the unique part of its file name, so it survives being moved from new to
+// cur or having its flags changed by a mail client. UIDs are kept in maildirUIDList, so a
+// message whose hash collides with another's is given a free UID that it keeps.
+type Maildir struct {
+	path string
+
+	mu    sync.Mutex
+	files map[uint32]string // message file by UID, from the last scan
+	uids  map[string]uint32 // UID of every unique name seen, including removed messages
+	used  map[uint32]bool
+}
+
+// NewMaildir returns a source for the Maildir at path
+func NewMaildir(path string) *Maildir {
+	return &Maildir{path: path}
+}
+
+// GetMessages reads the headers of every message and returns those dated since the given day
+func (m *Maildir) GetMessages(ctx context.Context, folder string, since time.Time) ([]imap.Message, error) {
+	log := logging.FromContext(ctx, logger)
+
+	files, err := m.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []imap.Message
+	for uid, path := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		header, err := readHeader(path)
+		if err != nil {
+			log.Warn("Skipping unreadable Maildir message", "file", filepath.Base(path), "error", err)
+			continue
+		}
+		msg, err := imap.ParseRawHeader(uid, header)
+		if err != nil {
+			log.Warn("Skipping unparseable Maildir message", "file", filepath.Base(path), "error", err)
+			continue
+		}
+		if msg.Date.IsZero() {
+			if info, err := os.Stat(path); err == nil {
+				msg.Date = info.ModTime()
+			}
+		}
+		if receivedSince(msg.Date, since) {
+			messages = append(messages, msg)
+		}
+	}
+
+	log.Debug("Scanned Maildir", "path", m.path, "messages", len(files), "matching", len(messages))
+	return messages, nil
+}
+
+// GetMessageContent reads a message found by the last GetMessages call, looking it up
+// again if it has since been moved or renamed
+func (m *Maildir) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
+	m.mu.Lock()
+	path, ok := m.files[uid]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown Maildir message %d", uid)
+	}
+
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		files, scanErr := m.scan(ctx)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		if path, ok = files[uid]; !ok {
+			return nil, fmt.Errorf("message %d no longer exists in Maildir", uid)
+		}
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Maildir message %d: %v", uid, err)
+	}
+
+	_, content, err := imap.ParseRaw(ctx, uid, raw)
+	return content, err
+}
+
+// scan lists the message files in new and cur by UID, giving new messages a UID
+func (m *Maildir) scan(ctx context.Context) (map[uint32]string, error) {
+	log := logging.FromContext(ctx, logger)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.uids == nil {
+		if err := m.loadUIDs(); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make(map[uint32]string)
+	added := false
+	for _, dir := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(m.path, dir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Maildir: %v", err)
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			unique, _, _ := strings.Cut(entry.Name(), ":")
+			if strings.Contains(unique, "\n") {
+				log.Warn("Skipping Maildir message with a newline in its file name", "file", entry.Name())
+				continue
+			}
+			uid, ok := m.uids[unique]
+			if !ok {
+				uid = m.assignUID(unique)
+				if uid != maildirUID(unique) {
+					log.Info("Maildir message UID collides with another; using a free one", "file", entry.Name(), "uid", uid)
+				}
+				added = true
+			}
+			files[uid] = filepath.Join(m.path, dir, entry.Name())
+		}
+	}
+
+	// Without the list UIDs stay the same unless hashes collide, so a read-only Maildir still works
+	if added {
+		if err := m.saveUIDs(); err != nil {
+			log.Warn("Failed to save Maildir UIDs", "error", err)
+		}
+	}
+
+	m.files = files
+	return files, nil
+}
+
+// assignUID gives unique the UID derived from its name, or when another message has it, the
+// first free one derived from the name with a counter
+func (m *Maildir) assignUID(unique string) uint32 {
+	uid := maildirUID(unique)
+	for n := 1; m.used[uid]; n++ {
+		uid = maildirUID(fmt.Sprintf("%s#%d", unique, n))
+	}
+	m.uids[unique] = uid
+	m.used[uid] = true
+	return uid
+}
+
+// loadUIDs reads the UID list, in which each line is a UID and a unique name
+func (m *Maildir) loadUIDs() error {
+	m.uids = make(map[string]uint32)
+	m.used = make(map[uint32]bool)
+
+	data, err := os.ReadFile(filepath.Join(m.path, maildirUIDList))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Maildir UIDs: %v", err)
+	}
+
+	for n, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		field, unique, ok := strings.Cut(line, " ")
+		uid, err := strconv.ParseUint(field, 10, 32)
+		if !ok || err != nil || uid == 0 || unique == "" {
+			return fmt.Errorf("invalid line %d in %s", n+1, maildirUIDList)
+		}
+		m.uids[unique] = uint32(uid)
+		m.used[uint32(uid)] = true
+	}
+	return nil
+}
+
+// saveUIDs replaces the UID list with the UIDs given so far
+func (m *Maildir) saveUIDs() error {
+	uniques := make([]string, 0, len(m.uids))
+	for unique := range m.uids {
+		uniques = append(uniques, unique)
+	}
+	sort.Strings(uniques)
+
+	var buf bytes.Buffer
+	for _, unique := range uniques {
+		fmt.Fprintf(&buf, "%d %s\n", m.uids[unique], unique)
+	}
+
+	path := filepath.Join(m.path, maildirUIDList)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// maildirUID derives a non-zero UID from a Maildir unique name
+func maildirUID(unique string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(unique))
+	if uid := h.Sum32(); uid != 0 {
+		return uid
+	}
+	return 1
+}
+
+// readHeader reads a message file up to and including the blank line ending its header
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header bytes.Buffer
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		header.Write(line)
+		if err == io.EOF || len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return header.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
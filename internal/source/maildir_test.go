@@ -0,0 +1,103 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMaildir creates an empty Maildir in a temporary directory
+func newMaildir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, sub), 0755))
+	}
+	return dir
+}
+
+func TestMaildir(t *testing.T) {
+	dir := newMaildir(t)
+	write := func(path, subject string) {
+		raw := "From: list@example.com\nSubject: " + subject + "\nDate: Sat, 09 Aug 2025 10:00:00 +0000\n\n" + subject + " body\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(raw), 0644))
+	}
+	write("new/1754733600.M1P1.host", "Unread")
+	write("cur/1754733601.M2P1.host:2,S", "Read")
+	write("tmp/1754733602.M3P1.host", "Still being delivered")
+
+	maildir := NewMaildir(dir)
+	ctx := context.Background()
+
+	messages, err := maildir.GetMessages(ctx, "lists", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+
+	uids := map[string]uint32{}
+	for _, msg := range messages {
+		uids[msg.Subject] = msg.UID
+	}
+	assert.Equal(t, maildirUID("1754733600.M1P1.host"), uids["Unread"])
+
+	// A mail client marks the new message read, moving it to cur
+	require.NoError(t, os.Rename(filepath.Join(dir, "new/1754733600.M1P1.host"), filepath.Join(dir, "cur/1754733600.M1P1.host:2,S")))
+
+	content, err := maildir.GetMessageContent(ctx, "lists", uids["Unread"])
+	require.NoError(t, err)
+	assert.Equal(t, "Unread body\r\n", content.TextBody)
+
+	messages, err = maildir.GetMessages(ctx, "lists", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	for _, msg := range messages {
+		assert.Equal(t, uids[msg.Subject], msg.UID, "UIDs survive moves and flag changes")
+	}
+
+	messages, err = maildir.GetMessages(ctx, "lists", time.Date(2025, 8, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	_, err = NewMaildir(t.TempDir()).GetMessages(ctx, "missing", time.Time{})
+	assert.Error(t, err)
+}
+
+func TestMaildirUIDCollisions(t *testing.T) {
+	dir := newMaildir(t)
+	raw := "From: list@example.com\nSubject: Colliding\nDate: Sat, 09 Aug 2025 10:00:00 +0000\n\nbody\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new/1754733600.M1P1.host"), []byte(raw), 0644))
+
+	// A message seen before, possibly since removed, already has the hash of the new one
+	taken := maildirUID("1754733600.M1P1.host")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, maildirUIDList), []byte(fmt.Sprintf("%d 1754000000.M9P9.host\n", taken)), 0644))
+
+	ctx := context.Background()
+	messages, err := NewMaildir(dir).GetMessages(ctx, "lists", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 1, "colliding messages are not skipped")
+	uid := messages[0].UID
+	assert.NotEqual(t, taken, uid)
+
+	list, err := os.ReadFile(filepath.Join(dir, maildirUIDList))
+	require.NoError(t, err)
+	assert.Contains(t, string(list), fmt.Sprintf("%d 1754733600.M1P1.host\n", uid))
+	assert.Contains(t, string(list), "1754000000.M9P9.host", "removed messages keep their UID")
+
+	maildir := NewMaildir(dir)
+	messages, err = maildir.GetMessages(ctx, "lists", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, uid, messages[0].UID, "the UID given is kept")
+	content, err := maildir.GetMessageContent(ctx, "lists", uid)
+	require.NoError(t, err)
+	assert.Equal(t, "body\r\n", content.TextBody)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, maildirUIDList), []byte("not a uid\n"), 0644))
+	_, err = NewMaildir(dir).GetMessages(ctx, "lists", time.Time{})
+	assert.Error(t, err, "a damaged UID list is not silently replaced")
+}
@@ -0,0 +1,163 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+)
+
+// separator matches the "From sender date" line that starts each message. Requiring the
+// time of day keeps unescaped body lines starting with "From " from splitting a message.
+var separator = regexp.MustCompile(`^From \S+ .*\d\d:\d\d`)
+
+// escapedFrom matches body lines that mboxrd and mboxo writers quote with '>'
+var escapedFrom = regexp.MustCompile(`(?m)^>(>*From )`)
+
+// Mbox reads messages from an mbox file. Messages are numbered from 1 in file order, so
+// their UIDs stay stable as long as the file is only appended to.
+type Mbox struct {
+	path string
+
+	mu    sync.Mutex
+	index []mboxEntry // location of each message by UID-1, from the last scan
+}
+
+// mboxEntry locates a message in the file, excluding its "From " separator line
+type mboxEntry struct {
+	offset int64
+	length int64
+}
+
+// NewMbox returns a source for the mbox file at path
+func NewMbox(path string) *Mbox {
+	return &Mbox{path: path}
+}
+
+// GetMessages scans the whole file and returns the messages dated since the given day
+func (m *Mbox) GetMessages(ctx context.Context, folder string, since time.Time) ([]imap.Message, error) {
+	log := logging.FromContext(ctx, logger)
+
+	f, err := os.Open(m.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mbox: %v", err)
+	}
+	defer f.Close()
+
+	var index []mboxEntry
+	var messages []imap.Message
+	err = scanMbox(f, func(entry mboxEntry, header []byte) {
+		index = append(index, entry)
+		uid := uint32(len(index))
+
+		msg, err := imap.ParseRawHeader(uid, unescapeFrom(header))
+		if err != nil {
+			log.Warn("Skipping unparseable mbox message", "uid", uid, "error", err)
+			return
+		}
+		if receivedSince(msg.Date, since) {
+			messages = append(messages, msg)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mbox: %v", err)
+	}
+
+	m.mu.Lock()
+	m.index = index
+	m.mu.Unlock()
+
+	log.Debug("Scanned mbox", "path", m.path, "messages", len(index), "matching", len(messages))
+	return messages, nil
+}
+
+// GetMessageContent reads a message found by the last GetMessages call
+func (m *Mbox) GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error) {
+	m.mu.Lock()
+	if uid == 0 || int(uid) > len(m.index) {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("unknown mbox message %d", uid)
+	}
+	entry := m.index[uid-1]
+	m.mu.Unlock()
+
+	f, err := os.Open(m.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mbox: %v", err)
+	}
+	defer f.Close()
+
+	raw := make([]byte, entry.length)
+	if _, err := f.ReadAt(raw, entry.offset); err != nil {
+		return nil, fmt.Errorf("failed to read mbox message %d: %v", uid, err)
+	}
+
+	_, content, err := imap.ParseRaw(ctx, uid, unescapeFrom(raw))
+	return content, err
+}
+
+// scanMbox calls fn for each message in r with its location and raw header. A separator
+// line starts a message when it opens the file or follows an empty line.
+func scanMbox(r io.Reader, fn func(entry mboxEntry, header []byte)) error {
+	br := bufio.NewReader(r)
+
+	var (
+		offset   int64
+		current  *mboxEntry
+		header   bytes.Buffer
+		inHeader bool
+		lastLen  int64 // length of the previous line, to drop the blank line before a separator
+		blank    = true
+	)
+	finish := func(end int64) {
+		if current == nil {
+			return
+		}
+		current.length = end - current.offset
+		if blank && current.length >= lastLen {
+			current.length -= lastLen
+		}
+		fn(*current, header.Bytes())
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if blank && separator.Match(line) {
+				finish(offset)
+				current = &mboxEntry{offset: offset + int64(len(line))}
+				header.Reset()
+				inHeader = true
+			} else if inHeader {
+				if len(bytes.TrimRight(line, "\r\n")) == 0 {
+					inHeader = false
+				}
+				header.Write(line)
+			}
+			blank = len(bytes.TrimRight(line, "\r\n")) == 0
+			lastLen = int64(len(line))
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			// A trailing blank line ends the last message rather than belonging to it
+			finish(offset)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unescapeFrom removes the '>' mbox writers add before body lines starting with "From "
+func unescapeFrom(raw []byte) []byte {
+	return escapedFrom.ReplaceAll(raw, []byte("$1"))
+}
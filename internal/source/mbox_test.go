@@ -0,0 +1,102 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMbox = `From alice@example.com Sat Aug  9 10:00:00 2025
+From: Alice <alice@example.com>
+Subject: First
+Date: Sat, 09 Aug 2025 10:00:00 +0000
+
+Hello from the archive.
+>From the quoting department.
+
+From bob@example.com Mon Aug 11 09:00:00 2025
+From: bob@example.com
+Subject: Second
+Date: Mon, 11 Aug 2025 09:00:00 +0000
+Content-Type: text/plain; charset=utf-8
+
+Second body
+From inside a paragraph is not a separator
+
+`
+
+func TestMbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.mbox")
+	require.NoError(t, os.WriteFile(path, []byte(testMbox), 0644))
+
+	mbox := NewMbox(path)
+	ctx := context.Background()
+
+	messages, err := mbox.GetMessages(ctx, "list", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, uint32(1), messages[0].UID)
+	assert.Equal(t, "First", messages[0].Subject)
+	assert.Equal(t, "Alice <alice@example.com>", messages[0].From)
+	assert.Equal(t, uint32(2), messages[1].UID)
+	assert.Equal(t, "bob@example.com", messages[1].From)
+
+	content, err := mbox.GetMessageContent(ctx, "list", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello from the archive.\r\nFrom the quoting department.\r\n", content.TextBody)
+
+	content, err = mbox.GetMessageContent(ctx, "list", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Second body\r\nFrom inside a paragraph is not a separator\r\n", content.TextBody)
+
+	// SINCE counts whole days, like IMAP
+	messages, err = mbox.GetMessages(ctx, "list", time.Date(2025, 8, 11, 18, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Second", messages[0].Subject)
+
+	_, err = mbox.GetMessageContent(ctx, "list", 3)
+	assert.Error(t, err)
+}
+
+func TestMboxAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.mbox")
+	require.NoError(t, os.WriteFile(path, []byte(testMbox), 0644))
+
+	mbox := NewMbox(path)
+	_, err := mbox.GetMessages(context.Background(), "list", time.Time{})
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("From carol@example.com Tue Aug 12 08:00:00 2025\nFrom: carol@example.com\nSubject: Third\n\nThird body\n\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	messages, err := mbox.GetMessages(context.Background(), "list", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "First", messages[0].Subject, "existing messages keep their UIDs")
+	assert.Equal(t, uint32(3), messages[2].UID)
+	assert.Equal(t, "Third", messages[2].Subject)
+}
+
+func TestOpen(t *testing.T) {
+	src, err := Open("mbox:///var/mail/archive.mbox")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/mail/archive.mbox", src.(*Mbox).path)
+
+	src, err = Open("maildir:Mail/lists")
+	require.NoError(t, err)
+	assert.Equal(t, "Mail/lists", src.(*Maildir).path)
+
+	for _, uri := range []string{"mbox:", "maildir://host/path", "imap:///INBOX", "/var/mail/archive.mbox"} {
+		_, err := Open(uri)
+		assert.Error(t, err, uri)
+	}
+}
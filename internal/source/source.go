@@ -0,0 +1,59 @@
+// Package source reads messages from local mail stores, so archived mbox files and Maildir
+// folders can be published like IMAP folders.
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"emailrss/internal/imap"
+	"emailrss/internal/logging"
+)
+
+var logger = logging.For("source")
+
+// Source provides one folder's messages with the same methods as the IMAP client
+type Source interface {
+	GetMessages(ctx context.Context, folder string, since time.Time) ([]imap.Message, error)
+	GetMessageContent(ctx context.Context, folder string, uid uint32) (*imap.MessageContent, error)
+}
+
+// Open returns the source for a mbox:PATH or maildir:PATH URI. Absolute paths may also be
+// written as mbox:///path.
+func Open(uri string) (Source, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source %q: %v", uri, err)
+	}
+	if u.Host != "" {
+		return nil, fmt.Errorf("invalid source %q: use %s:PATH or %s:///PATH", uri, u.Scheme, u.Scheme)
+	}
+	path := u.Path
+	if u.Opaque != "" {
+		path = u.Opaque
+	}
+	if path == "" {
+		return nil, fmt.Errorf("invalid source %q: missing path", uri)
+	}
+
+	switch u.Scheme {
+	case "mbox":
+		return NewMbox(path), nil
+	case "maildir":
+		return NewMaildir(path), nil
+	default:
+		return nil, fmt.Errorf("unsupported source %q (expected mbox: or maildir:)", uri)
+	}
+}
+
+// receivedSince mirrors the IMAP SINCE search the IMAP client uses: since only counts by
+// day, and messages without a date are always included
+func receivedSince(date, since time.Time) bool {
+	if since.IsZero() || date.IsZero() {
+		return true
+	}
+	day := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, since.Location())
+	return !date.Before(day)
+}